@@ -0,0 +1,188 @@
+package packer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+// SetMaxPackedRequests changes the maximum API calls inside one batch
+// of the running packer, pending batches are not affected.
+func (p *Packer) SetMaxPackedRequests(max int) error {
+	if max < 1 || max > maxExecuteCalls {
+		return fmt.Errorf("packer: max packed requests must be from 1 to %d, got %d", maxExecuteCalls, max)
+	}
+	return p.do(func() {
+		p.maxPackedRequests = max
+	})
+}
+
+// EvictToken removes the token from the pool, e.g. when it is revoked.
+// The last token can not be evicted.
+func (p *Packer) EvictToken(token string) error {
+	if !p.tokenPool.Remove(token) {
+		return fmt.Errorf("packer: token %s can not be evicted", tokenAlias(token))
+	}
+	return nil
+}
+
+// pendingRequests returns requests waiting in pending batches
+// without access tokens. Params of spilled requests are not read.
+func (p *Packer) pendingRequests() []Request {
+	var reqs []Request
+	p.do(func() {
+		for _, pending := range p.batches {
+			for _, queue := range pending.queues {
+				for _, req := range queue {
+					if req.group != nil {
+						req = req.group.request()
+					}
+					params := api.Params{}
+					for name, value := range mergeParams(req.params...) {
+						if name != "access_token" && !strings.HasPrefix(name, ":") {
+							params[name] = value
+						}
+					}
+					reqs = append(reqs, Request{Method: req.method, Params: params})
+				}
+			}
+		}
+	})
+	return reqs
+}
+
+// AdminHandler returns the HTTP handler to manage the running packer.
+// Every request passes through auth, which must reject unauthorized ones;
+// if auth is nil all requests are forbidden. Endpoints:
+//
+//	GET  /status                    state of the packer
+//	GET  /pending                   pending requests without tokens
+//	POST /flush                     Send
+//	POST /pause, /resume            Pause and Resume
+//	POST /disable, /enable          Disable and Enable
+//	POST /batch-size?max=N          SetMaxPackedRequests
+//	POST /tokens/evict?token=T      EvictToken by the token or its alias
+//
+// The handler is usually mounted with a prefix:
+//
+//	http.Handle("/packer/", http.StripPrefix("/packer", p.AdminHandler(basicAuth)))
+func (p *Packer) AdminHandler(auth func(http.Handler) http.Handler) http.Handler {
+	if auth == nil {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+		})
+	}
+
+	mux := http.NewServeMux()
+	get := func(path string, fn func(r *http.Request) (interface{}, error)) {
+		mux.HandleFunc(path, adminEndpoint(http.MethodGet, fn))
+	}
+	post := func(path string, fn func(r *http.Request) (interface{}, error)) {
+		mux.HandleFunc(path, adminEndpoint(http.MethodPost, fn))
+	}
+	action := func(fn func()) func(r *http.Request) (interface{}, error) {
+		return func(r *http.Request) (interface{}, error) {
+			fn()
+			return p.adminStatus(), nil
+		}
+	}
+
+	get("/status", func(r *http.Request) (interface{}, error) {
+		return p.adminStatus(), nil
+	})
+	get("/pending", func(r *http.Request) (interface{}, error) {
+		type pendingRequest struct {
+			Method string     `json:"method"`
+			Params api.Params `json:"params"`
+		}
+		reqs := []pendingRequest{}
+		for _, req := range p.pendingRequests() {
+			reqs = append(reqs, pendingRequest{req.Method, req.Params})
+		}
+		return reqs, nil
+	})
+	post("/flush", action(p.Send))
+	post("/pause", action(p.Pause))
+	post("/resume", action(p.Resume))
+	post("/disable", action(p.Disable))
+	post("/enable", action(p.Enable))
+	post("/batch-size", func(r *http.Request) (interface{}, error) {
+		max, err := strconv.Atoi(r.FormValue("max"))
+		if err != nil {
+			return nil, fmt.Errorf("packer: bad max: %w", err)
+		}
+		if err := p.SetMaxPackedRequests(max); err != nil {
+			return nil, err
+		}
+		return p.adminStatus(), nil
+	})
+	post("/tokens/evict", func(r *http.Request) (interface{}, error) {
+		value := r.FormValue("token")
+		var matched []string
+		for _, token := range p.tokenPool.All() {
+			if token == value || tokenAlias(token) == value {
+				matched = append(matched, token)
+			}
+		}
+		if len(matched) != 1 {
+			return nil, fmt.Errorf("packer: %d tokens match %q", len(matched), value)
+		}
+		if err := p.EvictToken(matched[0]); err != nil {
+			return nil, err
+		}
+		return p.adminStatus(), nil
+	})
+	return auth(mux)
+}
+
+type adminStatus struct {
+	Enabled           bool     `json:"enabled"`
+	Paused            bool     `json:"paused"`
+	Pending           int      `json:"pending"`
+	MaxPackedRequests int      `json:"max_packed_requests"`
+	Tokens            []string `json:"tokens"`
+	Health            string   `json:"health,omitempty"`
+}
+
+func (p *Packer) adminStatus() adminStatus {
+	st := adminStatus{
+		Enabled:           p.Enabled(),
+		Paused:            p.Paused(),
+		Pending:           p.Pending(),
+		MaxPackedRequests: p.batchSize(),
+		Tokens:            []string{},
+	}
+	for _, token := range p.tokenPool.All() {
+		st.Tokens = append(st.Tokens, tokenAlias(token))
+	}
+	sort.Strings(st.Tokens)
+	if err := p.Healthy(); err != nil {
+		st.Health = err.Error()
+	}
+	return st
+}
+
+// adminEndpoint writes the result of fn as JSON, errors are written
+// as {"error": "..."} with status 400.
+func adminEndpoint(method string, fn func(r *http.Request) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		result, err := fn(r)
+		w.Header().Set("Content-Type", "application/json")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			result = map[string]string{"error": err.Error()}
+		}
+		_ = json.NewEncoder(w).Encode(result)
+	}
+}
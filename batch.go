@@ -2,10 +2,12 @@ package packer
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"log"
-	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/SevereCloud/vksdk/v2/api"
 	"github.com/SevereCloud/vksdk/v2/object"
@@ -15,79 +17,175 @@ type request struct {
 	method   string
 	params   []api.Params
 	callback func(api.Response, error)
+	group    *mergeGroup
+	spilled  *spillRef
+	expiry   *expiry
 }
 
-type batch map[string]request
+type batch []request
 
-func (b batch) appendRequest(req request) {
-	b["r"+strconv.Itoa(len(b))] = req
+// pendingBatch holds requests which are being collected,
+// one queue per priority.
+type pendingBatch struct {
+	queues  [numPriorities]batch
+	cost    int
+	created time.Time
 }
 
-func (b batch) code() string {
-	var sb strings.Builder
-	sb.WriteString("return {")
-	for id, request := range b {
-		sb.WriteString(`"` + id + `":API.` + request.method + "({")
+// batchKey holds params which apply to the whole execute call,
+// only requests with equal keys can share a batch.
+// Empty field means that the param is not set.
+type batchKey struct {
+	version  string
+	lang     string
+	https    string
+	testMode string
+	class    MethodClass
+}
 
-		iterateAll(func(name string, value interface{}) {
-			if name == "access_token" {
-				return
-			}
-			valueString := ""
-			if s, ok := value.(string); ok {
-				valueString = `"` + s + `"`
-			} else {
-				valueString = api.FmtValue(value, 0)
-			}
-			sb.WriteString(`"` + name + `":` + valueString + ",")
-		}, request.params...)
+// isExecuteParam reports whether the param belongs to execute call itself
+// and must not be passed to the packed method.
+func isExecuteParam(name string) bool {
+	switch name {
+	case "access_token", "v", "lang", "https", "test_mode":
+		return true
+	}
+	// vksdk internal params like ":context"
+	return strings.HasPrefix(name, ":")
+}
 
-		sb.WriteString("}),")
+func (p *Packer) batchKey(params ...api.Params) batchKey {
+	key := batchKey{version: p.version}
+	iterateAll(func(name string, value interface{}) {
+		switch name {
+		case "v":
+			key.version = encodeParam(p.paramEncoders, value)
+		case "lang":
+			key.lang = encodeParam(p.paramEncoders, value)
+		case "https":
+			key.https = encodeParam(p.paramEncoders, value)
+		case "test_mode":
+			key.testMode = encodeParam(p.paramEncoders, value)
+		}
+	}, params...)
+	return key
+}
+
+func (k batchKey) params() api.Params {
+	params := api.Params{"v": k.version}
+	if k.lang != "" {
+		params["lang"] = k.lang
+	}
+	if k.https != "" {
+		params["https"] = k.https
+	}
+	if k.testMode != "" {
+		params["test_mode"] = k.testMode
 	}
-	sb.WriteString("};")
-	return sb.String()
+	return params
 }
 
-func (p *Packer) sendBatch(bat batch) {
-	if err := p.trySendBatch(bat); err != nil {
+func (b batch) code(w *codeWriter) (string, error) {
+	w.raw("return")
+	w.space(" ")
+	w.raw("[")
+	w.list(len(b), func(i int) {
+		w.call(b[i].method, b[i].params...)
+	})
+	w.raw("];")
+	return w.String(), w.err
+}
+
+// finalize replaces merge groups with the requests which will be sent.
+func (b batch) finalize() {
+	for i := range b {
+		if b[i].group != nil {
+			b[i] = b[i].group.request()
+		}
+	}
+}
+
+func (p *Packer) sendBatch(key batchKey, info BatchInfo, bat batch) {
+	atomic.AddInt32(&p.sending, 1)
+	defer atomic.AddInt32(&p.sending, -1)
+	if bat = p.unexpired(p.unspill(bat)); len(bat) == 0 {
+		return
+	}
+	bat.finalize()
+	info.Requests = len(bat)
+	bat.place(info)
+	err := p.trySendBatch(key, &info, bat)
+	if err != nil {
+		err = &BatchError{Info: info, Err: err}
+		if p.debug {
+			log.Printf("packer: batch %s: %v\n", info, err)
+		}
 		for _, request := range bat {
 			request.callback(api.Response{}, err)
 		}
 	}
+
+	if p.onBatch != nil {
+		p.onBatch(info, err)
+	}
 }
 
-func (p *Packer) trySendBatch(bat batch) error {
-	code := bat.code()
-	if p.debug {
-		log.Printf("packer: batch: code: \n%s\n", code)
+func (p *Packer) trySendBatch(key batchKey, info *BatchInfo, bat batch) error {
+	var journalID string
+	if p.journal != nil {
+		var err error
+		if journalID, err = p.journalBatch(bat); err != nil {
+			return err
+		}
 	}
 
-	pack, err := p.execute(code)
+	start := time.Now()
+	retries, backoff := p.retryPolicy()
+	resp, err := p.sendPacked(key, info, bat)
+	for err != nil && info.Attempt <= retries && p.retryable(bat, err) {
+		if p.debug {
+			log.Printf("packer: batch %s: retry: %v\n", info, err)
+		}
+		time.Sleep(backoff * time.Duration(info.Attempt))
+		info.Attempt++
+		resp, err = p.sendPacked(key, info, bat)
+	}
+	info.Duration = time.Since(start)
 	if err != nil {
 		return err
 	}
 
+	if journalID != "" {
+		if err := p.journal.Completed(journalID); err != nil && p.debug {
+			log.Printf("packer: batch %s: journal: %v\n", info, err)
+		}
+	}
+
 	failedRequestIndex := 0
-	for name, body := range pack.Responses {
-		request, ok := bat[name]
-		if !ok {
+	n, err := p.eachResponse(resp.Response, func(i int, body json.RawMessage) {
+		if i >= len(bat) {
 			if p.debug {
-				log.Printf("packer: batch: handler %s not registered\n", name)
+				log.Printf("packer: batch %s: unexpected response %d: %s\n", info, i, body)
 			}
-			continue
+			return
 		}
 
+		request := bat[i]
 		methodResponse := api.Response{
 			Response: body,
 		}
-		if bytes.Equal(body, []byte("false")) {
-			methodErr := executeErrorToMethodError(request, pack.ExecuteErrors[failedRequestIndex])
+		if bytes.Equal(body, []byte("false")) && failedRequestIndex < len(resp.ExecuteErrors) {
+			methodErr := executeErrorToMethodError(request, resp.ExecuteErrors[failedRequestIndex])
 			methodResponse.Error = methodErr
 			failedRequestIndex++
 		}
 
 		if p.debug {
-			log.Printf("packer: batch: call handler %s (method %s): resp: %s, err: %s\n", name, request.method, body, err)
+			log.Printf("packer: batch %s: call handler %d (method %s): resp: %s\n", info, i, request.method, body)
+		}
+
+		if p.onRawResponse != nil {
+			p.onRawResponse(*info, Request{request.method, mergeParams(request.params...)}, body)
 		}
 
 		if methodResponse.Error.Code == api.ErrNoType {
@@ -95,23 +193,56 @@ func (p *Packer) trySendBatch(bat batch) error {
 		} else {
 			request.callback(methodResponse, methodResponse.Error)
 		}
-
-		delete(bat, name)
+	})
+	if n == 0 && err != nil {
+		return err
 	}
 
-	if len(bat) > 0 {
-		err := fmt.Errorf("packer: no response")
-		for _, req := range bat {
-			req.callback(api.Response{}, err)
+	if n < len(bat) {
+		if err == nil {
+			err = fmt.Errorf("packer: expected %d responses, got %d", len(bat), n)
+		}
+		err = &BatchError{Info: *info, Err: err}
+		for _, request := range bat[n:] {
+			request.callback(api.Response{}, err)
 		}
-		bat = nil
 	}
 
 	return nil
 }
 
+// sendPacked sends the batch either as inline code or
+// as arguments of the stored procedure.
+func (p *Packer) sendPacked(key batchKey, info *BatchInfo, bat batch) (api.Response, error) {
+	token := p.tokenPool.Get()
+	info.Token = tokenAlias(token)
+
+	if p.procedure != "" {
+		args := bat.procedureArgs(p.paramEncoders)
+		if p.debug {
+			log.Printf("packer: batch %s: procedure %s args: %v\n", info, p.procedure, args)
+		}
+
+		return p.executeWithToken(token, "execute."+p.procedure, key.params(), args)
+	}
+
+	w := p.codeWriter()
+	code, err := bat.code(w)
+	w.release()
+	if err != nil {
+		return api.Response{}, err
+	}
+	info.CodeSize = len(code)
+
+	if p.debug {
+		log.Printf("packer: batch %s: code: \n%s\n", info, code)
+	}
+
+	return p.executeWithToken(token, p.execMethod, key.params(), api.Params{"code": code})
+}
+
 func executeErrorToMethodError(req request, err api.ExecuteError) api.Error {
-	params := make([]object.BaseRequestParam, len(req.params))
+	params := make([]object.BaseRequestParam, 0, len(req.params))
 	iterateAll(func(key string, value interface{}) {
 		params = append(params, object.BaseRequestParam{
 			Key:   key,
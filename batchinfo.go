@@ -0,0 +1,112 @@
+package packer
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// FlushTrigger is the reason why the batch was sent.
+type FlushTrigger int
+
+const (
+	// FlushFull means that the batch reached MaxPackedRequests.
+	FlushFull FlushTrigger = iota
+	// FlushSend means that the batch was sent by Send call.
+	FlushSend
+	// FlushClose means that the batch was sent by Close call.
+	FlushClose
+	// FlushLarge means that the batch contains a single large request
+	// (see LargeRequests).
+	FlushLarge
+	// FlushHint means that the batch was sent after the request
+	// marked with FlushAfter.
+	FlushHint
+	// FlushExecute means that the request is VKScript code sent by Execute.
+	FlushExecute
+)
+
+func (t FlushTrigger) String() string {
+	switch t {
+	case FlushFull:
+		return "full"
+	case FlushSend:
+		return "send"
+	case FlushClose:
+		return "close"
+	case FlushLarge:
+		return "large"
+	case FlushHint:
+		return "hint"
+	case FlushExecute:
+		return "execute"
+	}
+	return fmt.Sprintf("FlushTrigger(%d)", int(t))
+}
+
+// BatchInfo describes the execute request of the batch.
+type BatchInfo struct {
+	// ID is the sequence number of the batch, unique for the packer.
+	ID uint64
+	// Created is the time when the first request was added to the batch.
+	Created time.Time
+	// Trigger is the reason why the batch was sent.
+	Trigger FlushTrigger
+	// Token is the masked token which was used for the execute.
+	Token string
+	// Requests is the number of API calls in the execute.
+	Requests int
+	// CodeSize is the size of the generated code in bytes
+	// (zero when the batch is sent through a stored procedure).
+	CodeSize int
+	// Duration is the time the execute request took.
+	Duration time.Duration
+	// Attempt is the number of the attempt to send the batch, starting from 1.
+	Attempt int
+}
+
+func (b BatchInfo) String() string {
+	return fmt.Sprintf("%d [%s, %d requests, %d bytes, token %s, attempt %d, %s]",
+		b.ID, b.Trigger, b.Requests, b.CodeSize, b.Token, b.Attempt, b.Duration)
+}
+
+// BatchError is the error of the whole batch
+// which is returned to every request of the batch.
+type BatchError struct {
+	Info BatchInfo
+	Err  error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("packer: batch %d: %v", e.Info.ID, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// OnBatch sets the hook which is called after each batch is sent.
+// err is the error of the whole batch, errors of single requests
+// are returned only to callers.
+func OnBatch(fn func(info BatchInfo, err error)) Option {
+	return func(p *Packer) {
+		p.onBatch = fn
+	}
+}
+
+func (p *Packer) batchInfo(pending *pendingBatch, trigger FlushTrigger) BatchInfo {
+	return BatchInfo{
+		ID:      atomic.AddUint64(&p.batchSeq, 1),
+		Created: pending.created,
+		Trigger: trigger,
+		Attempt: 1,
+	}
+}
+
+// tokenAlias masks the token so it can be logged.
+func tokenAlias(token string) string {
+	if len(token) <= 8 {
+		return "***"
+	}
+	return "..." + token[len(token)-4:]
+}
@@ -0,0 +1,120 @@
+package packer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"golang.org/x/time/rate"
+)
+
+// DefaultBroadcastRate is the default number of messages
+// sent by Broadcast per second per token.
+const DefaultBroadcastRate = 20
+
+type broadcastConfig struct {
+	rate         rate.Limit
+	peerInterval time.Duration
+}
+
+// BroadcastOption - Broadcast option
+type BroadcastOption func(*broadcastConfig)
+
+// BroadcastRate sets the number of messages per second per token
+// (DefaultBroadcastRate by default).
+func BroadcastRate(perToken float64) BroadcastOption {
+	return func(c *broadcastConfig) {
+		c.rate = rate.Limit(perToken)
+	}
+}
+
+// BroadcastPeerInterval sets the minimum interval between messages
+// to the same peer (1 second by default).
+func BroadcastPeerInterval(d time.Duration) BroadcastOption {
+	return func(c *broadcastConfig) {
+		c.peerInterval = d
+	}
+}
+
+// BroadcastResult is the result of the message sent by Broadcast.
+type BroadcastResult struct {
+	PeerID    int
+	MessageID int
+	Err       error
+}
+
+// Broadcast sends messages.send with params built for each peer
+// and returns results in the order of peerIDs. Calls are packed,
+// random_id is set if build does not set it and messages are paced
+// per token of the pool and per peer to avoid flood control.
+func (p *Packer) Broadcast(peerIDs []int, build func(peer int) api.Params, opts ...BroadcastOption) []BroadcastResult {
+	cfg := broadcastConfig{rate: DefaultBroadcastRate, peerInterval: time.Second}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	tokens := p.tokenPool.Len()
+	if tokens < 1 {
+		tokens = 1
+	}
+	limiter := rate.NewLimiter(cfg.rate*rate.Limit(tokens), tokens)
+
+	var (
+		mtx      sync.Mutex
+		peerNext = make(map[int]time.Time)
+	)
+	// reserve returns the time when the message to the peer may be sent.
+	reserve := func(peer int) time.Time {
+		mtx.Lock()
+		defer mtx.Unlock()
+		at := time.Now()
+		if next, ok := peerNext[peer]; ok && next.After(at) {
+			at = next
+		}
+		peerNext[peer] = at.Add(cfg.peerInterval)
+		return at
+	}
+
+	results := make([]BroadcastResult, len(peerIDs))
+	p.forEach(len(peerIDs), 0, func(i int, _ <-chan struct{}) error {
+		peer := peerIDs[i]
+		results[i].PeerID = peer
+
+		params := api.Params{"peer_id": peer}
+		for name, value := range build(peer) {
+			params[name] = value
+		}
+		if _, ok := params["random_id"]; !ok {
+			params["random_id"] = randomID()
+		}
+
+		time.Sleep(time.Until(reserve(peer)))
+		if err := limiter.Wait(context.Background()); err != nil {
+			results[i].Err = err
+			return nil
+		}
+
+		resp, err := p.Handler("messages.send", params)
+		if err != nil {
+			results[i].Err = err
+			return nil
+		}
+		_ = p.decoder.Unmarshal(resp.Response, &results[i].MessageID)
+		return nil
+	})
+	return results
+}
+
+// randomID returns random_id of the message. It is read from crypto/rand,
+// so ids do not repeat after restart like the fixed-seed math/rand ones,
+// which VK would drop as duplicates.
+func randomID() int32 {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return int32(time.Now().UnixNano() & 0x7fffffff)
+	}
+	return int32(binary.LittleEndian.Uint32(b[:]) & 0x7fffffff)
+}
@@ -0,0 +1,174 @@
+package packer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+type bulkConfig struct {
+	parallelism int
+}
+
+// BulkOption - BulkCall option
+type BulkOption func(*bulkConfig)
+
+// BulkParallelism sets the maximum number of requests of BulkCall
+// waiting for responses at the same time (4 batches by default).
+func BulkParallelism(n int) BulkOption {
+	return func(c *bulkConfig) {
+		if n > 0 {
+			c.parallelism = n
+		}
+	}
+}
+
+// BulkCall proceeds many requests and returns their results in the same order.
+// Batches are sent as soon as all running requests are waiting for responses,
+// so no flush timer is needed. Requests which are not started
+// before ctx is done are failed with ctx.Err().
+func (p *Packer) BulkCall(ctx context.Context, reqs []Request, opts ...BulkOption) []Result {
+	cfg := bulkConfig{parallelism: p.batchSize() * 4}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.parallelism > len(reqs) {
+		cfg.parallelism = len(reqs)
+	}
+
+	results := make([]Result, len(reqs))
+	next := make(chan int, len(reqs))
+	for i := range reqs {
+		next <- i
+	}
+	close(next)
+
+	group := p.NewFlushGroup()
+	for w := 0; w < cfg.parallelism; w++ {
+		group.Go(func() {
+			for i := range next {
+				if err := ctx.Err(); err != nil {
+					results[i].Err = err
+					continue
+				}
+				resp, err := p.Handler(reqs[i].Method, reqs[i].Params, api.Params{":context": ctx})
+				results[i] = Result{Response: resp, Err: err}
+			}
+		})
+	}
+	group.Wait()
+	return results
+}
+
+// PackMany calls one method with each of params and returns responses
+// and errors in the same order, see BulkCall.
+func (p *Packer) PackMany(method string, paramsList []api.Params) ([]api.Response, []error) {
+	reqs := make([]Request, len(paramsList))
+	for i, params := range paramsList {
+		reqs[i] = Request{Method: method, Params: params}
+	}
+
+	responses := make([]api.Response, len(reqs))
+	errs := make([]error, len(reqs))
+	for i, res := range p.BulkCall(context.Background(), reqs) {
+		responses[i], errs[i] = res.Response, res.Err
+	}
+	return responses, errs
+}
+
+// forEach calls fn for indexes up to n with at most parallelism calls
+// running at the same time (4 batches by default) in the FlushGroup.
+// After the first error stop is closed, remaining indexes are skipped
+// and the error is returned.
+func (p *Packer) forEach(n, parallelism int, fn func(i int, stop <-chan struct{}) error) error {
+	if parallelism < 1 {
+		parallelism = p.batchSize() * 4
+	}
+	if parallelism > n {
+		parallelism = n
+	}
+
+	next := make(chan int, n)
+	for i := 0; i < n; i++ {
+		next <- i
+	}
+	close(next)
+
+	var (
+		once     sync.Once
+		firstErr error
+		stop     = make(chan struct{})
+	)
+	group := p.NewFlushGroup()
+	for w := 0; w < parallelism; w++ {
+		group.Go(func() {
+			for i := range next {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if err := fn(i, stop); err != nil {
+					once.Do(func() {
+						firstErr = err
+						close(stop)
+					})
+				}
+			}
+		})
+	}
+	group.Wait()
+	return firstErr
+}
+
+// fetchPaged passes pages of the method which returns {"count": N, "items": [...]}
+// to fn through Handler, limit is the maximum number of items (zero means all).
+func fetchPaged[T any](p *Packer, method string, params api.Params, pageSize, limit int,
+	stop <-chan struct{}, fn func(items []T) error) error {
+	pageParams := make(api.Params, len(params)+2)
+	for name, value := range params {
+		pageParams[name] = value
+	}
+
+	offset := 0
+	for limit == 0 || offset < limit {
+		count := pageSize
+		if limit > 0 && limit-offset < count {
+			count = limit - offset
+		}
+		pageParams["offset"] = offset
+		pageParams["count"] = count
+
+		resp, err := p.Handler(method, pageParams)
+		if err != nil {
+			return err
+		}
+		var page struct {
+			Count int `json:"count"`
+			Items []T `json:"items"`
+		}
+		if err := p.decoder.Unmarshal(resp.Response, &page); err != nil {
+			return fmt.Errorf("packer: %s: %w", method, err)
+		}
+		if len(page.Items) == 0 {
+			return nil
+		}
+
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+		if err := fn(page.Items); err != nil {
+			return err
+		}
+
+		offset += len(page.Items)
+		if offset >= page.Count {
+			return nil
+		}
+	}
+	return nil
+}
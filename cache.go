@@ -0,0 +1,137 @@
+package packer
+
+import (
+	"container/list"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+// CacheStore stores responses of cached methods.
+// Implementations must be safe for concurrent use.
+type CacheStore interface {
+	Get(key string) (json.RawMessage, bool)
+	Set(key string, value json.RawMessage, ttl time.Duration)
+}
+
+// DefaultCacheSize is the number of entries of the default cache store.
+const DefaultCacheSize = 1024
+
+var cacheableMethods = []string{
+	"users.get",
+	"groups.getById",
+	"utils.resolveScreenName",
+}
+
+// Cache enables caching of successful responses of users.get, groups.getById
+// and utils.resolveScreenName for ttl. Cached responses are returned
+// without packing, requests are matched by method and params.
+func Cache(ttl time.Duration) Option {
+	return func(p *Packer) {
+		for _, method := range cacheableMethods {
+			p.cacheTTLs[method] = ttl
+		}
+	}
+}
+
+// CacheMethod enables caching of the method responses for ttl.
+// Zero ttl disables caching for the method.
+func CacheMethod(method string, ttl time.Duration) Option {
+	return func(p *Packer) {
+		p.cacheTTLs[method] = ttl
+	}
+}
+
+// CacheStorage sets the cache store, by default in-memory LRU
+// with DefaultCacheSize entries is used.
+func CacheStorage(store CacheStore) Option {
+	return func(p *Packer) {
+		p.cache = store
+	}
+}
+
+// cached returns the cached response or calls fn and caches its result.
+func (p *Packer) cached(method string, params []api.Params, fn func() (api.Response, error)) (api.Response, error) {
+	ttl := p.cacheTTLs[method]
+	if ttl <= 0 {
+		return fn()
+	}
+
+	key := p.requestKey(method, params...)
+	if body, ok := p.cache.Get(key); ok {
+		return api.Response{Response: body}, nil
+	}
+
+	resp, err := fn()
+	if err == nil {
+		// copy so the cache does not keep the whole execute response
+		p.cache.Set(key, append(json.RawMessage(nil), resp.Response...), ttl)
+	}
+	return resp, err
+}
+
+type lruEntry struct {
+	key     string
+	value   json.RawMessage
+	expires time.Time
+}
+
+type lruCache struct {
+	size    int
+	entries map[string]*list.Element
+	order   *list.List
+	mtx     sync.Mutex
+}
+
+// NewLRUCache creates in-memory cache store which keeps
+// up to size most recently used entries.
+func NewLRUCache(size int) CacheStore {
+	if size < 1 {
+		size = DefaultCacheSize
+	}
+	return &lruCache{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+func (c *lruCache) Get(key string) (json.RawMessage, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*lruEntry)
+	if time.Now().After(entry.expires) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	c.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+func (c *lruCache) Set(key string, value json.RawMessage, ttl time.Duration) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	entry := &lruEntry{key: key, value: value, expires: time.Now().Add(ttl)}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+}
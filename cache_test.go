@@ -0,0 +1,27 @@
+package packer
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRUCache(t *testing.T) {
+	c := NewLRUCache(2)
+	c.Set("a", json.RawMessage("1"), time.Minute)
+	c.Set("b", json.RawMessage("2"), time.Minute)
+	_, _ = c.Get("a")
+	c.Set("c", json.RawMessage("3"), time.Minute)
+
+	_, ok := c.Get("b")
+	assert.False(t, ok)
+	value, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "1", string(value))
+
+	c.Set("d", json.RawMessage("4"), -time.Second)
+	_, ok = c.Get("d")
+	assert.False(t, ok)
+}
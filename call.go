@@ -0,0 +1,20 @@
+package packer
+
+import "github.com/SevereCloud/vksdk/v2/api"
+
+// Call packs the request and decodes its response into T.
+//
+//	users, err := packer.Call[[]object.UsersUser](p, "users.get", api.Params{"user_ids": 1})
+func Call[T any](p *Packer, method string, params api.Params) (T, error) {
+	var result T
+	resp, err := p.Handler(method, params)
+	if err != nil {
+		return result, err
+	}
+
+	if err := p.decoder.Unmarshal(resp.Response, &result); err != nil {
+		return result, p.decorate(method, err)
+	}
+
+	return result, nil
+}
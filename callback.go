@@ -0,0 +1,37 @@
+package packer
+
+import "net/http"
+
+// FlushMiddleware flushes the packer at the end of each HTTP request,
+// so API calls triggered by Callback API events are sent promptly
+// and the flush timer is not needed:
+//
+//	cb := callback.NewCallback()
+//	http.Handle("/callback", p.FlushMiddleware(http.HandlerFunc(cb.HandleFunc), true))
+//
+// If wait is true, the handler runs in the FlushGroup: its packed calls are sent
+// as soon as it waits for them and the response is written after they complete.
+// If wait is false, the handler must not wait for packed calls
+// (e.g. events are handled in goroutines), pending batches are sent after it returns.
+// A panic of the handler is repeated on the goroutine of the request,
+// so net/http recovers it as usual.
+func (p *Packer) FlushMiddleware(next http.Handler, wait bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wait {
+			var recovered interface{}
+			group := p.NewFlushGroup()
+			group.Go(func() {
+				defer func() { recovered = recover() }()
+				next.ServeHTTP(w, r)
+			})
+			group.Wait()
+			if recovered != nil {
+				p.Send()
+				panic(recovered)
+			}
+		} else {
+			next.ServeHTTP(w, r)
+		}
+		p.Send()
+	})
+}
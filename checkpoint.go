@@ -0,0 +1,170 @@
+package packer
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+)
+
+// JobState is the progress of the bulk job which is enough to resume it.
+type JobState struct {
+	// Offset is the offset of the next item (FetchWall).
+	Offset int `json:"offset,omitempty"`
+	// Next is the index of the first peer or post which is not completed
+	// (FetchHistory, FetchLikes, FetchComments), the job must be resumed
+	// with the same list.
+	Next int `json:"next,omitempty"`
+	// Done are keys of peers or posts after Next which are completed.
+	Done []string `json:"done,omitempty"`
+}
+
+// Checkpointer stores the state of the bulk job, so it can be resumed
+// after restart instead of starting from zero.
+type Checkpointer interface {
+	Save(state JobState) error
+	// Load returns false if there is no saved state.
+	Load() (JobState, bool, error)
+}
+
+type fileCheckpointer struct {
+	path string
+}
+
+// NewFileCheckpointer creates the checkpointer which keeps the state in the file.
+func NewFileCheckpointer(path string) Checkpointer {
+	return fileCheckpointer{path: path}
+}
+
+func (c fileCheckpointer) Save(state JobState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+func (c fileCheckpointer) Load() (JobState, bool, error) {
+	var state JobState
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, false, nil
+	}
+	if err != nil {
+		return state, false, err
+	}
+	return state, true, json.Unmarshal(data, &state)
+}
+
+// jobCheckpoint tracks the state of the running job, nil is a no-op.
+// Items completed in order only move state.Next, so the saved state
+// stays small however many items are done.
+type jobCheckpoint struct {
+	cp    Checkpointer
+	mtx   sync.Mutex
+	saved bool
+	state JobState
+	// done are keys of state.Done, ahead are indexes of keys
+	// completed after state.Next.
+	done  map[string]struct{}
+	ahead map[int]string
+}
+
+func loadCheckpoint(cp Checkpointer) (*jobCheckpoint, error) {
+	if cp == nil {
+		return nil, nil
+	}
+	state, saved, err := cp.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &jobCheckpoint{cp: cp, saved: saved, state: state, done: make(map[string]struct{}), ahead: make(map[int]string)}
+	for _, key := range state.Done {
+		c.done[key] = struct{}{}
+	}
+	return c, nil
+}
+
+func (c *jobCheckpoint) offset(def int) int {
+	if c == nil || !c.saved {
+		return def
+	}
+	return c.state.Offset
+}
+
+func (c *jobCheckpoint) saveOffset(offset int) error {
+	if c == nil {
+		return nil
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.state.Offset = offset
+	return c.cp.Save(c.state)
+}
+
+func (c *jobCheckpoint) isDone(i int, key string) bool {
+	if c == nil {
+		return false
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	_, ok := c.done[key]
+	return ok || i < c.state.Next
+}
+
+// complete marks the item completed, the state is saved if save is set.
+func (c *jobCheckpoint) complete(i int, key string, save bool) error {
+	if c == nil {
+		return nil
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if i < c.state.Next {
+		return nil
+	}
+	c.done[key] = struct{}{}
+	c.ahead[i] = key
+	for {
+		next, ok := c.ahead[c.state.Next]
+		if !ok {
+			break
+		}
+		delete(c.ahead, c.state.Next)
+		delete(c.done, next)
+		c.state.Next++
+	}
+	if !save {
+		return nil
+	}
+
+	c.state.Done = make([]string, 0, len(c.done))
+	for key := range c.done {
+		c.state.Done = append(c.state.Done, key)
+	}
+	sort.Strings(c.state.Done)
+	return c.cp.Save(c.state)
+}
+
+// run calls fn for the item unless it is completed and marks it completed
+// if fn succeeded and the job was not stopped in the middle of it.
+func (c *jobCheckpoint) run(i int, key string, stop <-chan struct{}, fn func() error) error {
+	if c.isDone(i, key) {
+		// completed by the previous run, only the cursor is moved
+		return c.complete(i, key, false)
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	select {
+	case <-stop:
+		return nil
+	default:
+	}
+	return c.complete(i, key, true)
+}
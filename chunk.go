@@ -0,0 +1,164 @@
+package packer
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+type chunkRule struct {
+	param string
+	limit int
+}
+
+// defaultChunkRules contains per-call limits of id list params.
+var defaultChunkRules = map[string]chunkRule{
+	"users.get":          {"user_ids", 1000},
+	"groups.getById":     {"group_ids", 500},
+	"wall.getById":       {"posts", 100},
+	"video.get":          {"videos", 200},
+	"photos.getById":     {"photos", 500},
+	"friends.areFriends": {"user_ids", 1000},
+	"messages.getById":   {"message_ids", 100},
+}
+
+// ChunkLimit sets the maximum number of ids in the param of the method.
+// Requests with longer lists are split into several packed calls
+// and their responses are merged. Zero limit disables splitting for the method.
+func ChunkLimit(method, param string, limit int) Option {
+	return func(p *Packer) {
+		p.chunkRules[method] = chunkRule{param, limit}
+	}
+}
+
+// chunk splits params if the id list exceeds the method limit,
+// it returns nil if no split is required.
+func (p *Packer) chunk(method string, params ...api.Params) []api.Params {
+	rule, ok := p.chunkRules[method]
+	if !ok || rule.limit < 1 {
+		return nil
+	}
+
+	merged := mergeParams(params...)
+	value, ok := merged[rule.param]
+	if !ok {
+		return nil
+	}
+
+	ids := strings.Split(encodeParam(p.paramEncoders, value), ",")
+	if len(ids) <= rule.limit {
+		return nil
+	}
+
+	var chunks []api.Params
+	for start := 0; start < len(ids); start += rule.limit {
+		end := start + rule.limit
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		chunk := make(api.Params, len(merged))
+		for k, v := range merged {
+			chunk[k] = v
+		}
+		chunk[rule.param] = strings.Join(ids[start:end], ",")
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks
+}
+
+// enqueueChunks packs all chunks and merges their responses.
+func (p *Packer) enqueueChunks(method string, chunks []api.Params) (api.Response, error) {
+	responses := make([]api.Response, len(chunks))
+	errs := make([]error, len(chunks))
+
+	var wg sync.WaitGroup
+	wg.Add(len(chunks))
+	for i, chunk := range chunks {
+		go func(i int, chunk api.Params) {
+			defer wg.Done()
+			responses[i], errs[i] = p.enqueue(method, chunk)
+		}(i, chunk)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return responses[i], err
+		}
+	}
+
+	bodies := make([]json.RawMessage, len(responses))
+	for i, resp := range responses {
+		bodies[i] = resp.Response
+	}
+
+	merged, err := mergeResponses(bodies)
+	if err != nil {
+		return api.Response{}, err
+	}
+
+	return api.Response{Response: merged}, nil
+}
+
+// mergeResponses concatenates array responses. Object responses are merged
+// by concatenating array fields and summing "count", other fields are taken
+// from the first response.
+func mergeResponses(bodies []json.RawMessage) (json.RawMessage, error) {
+	var arrays [][]json.RawMessage
+	for _, body := range bodies {
+		var arr []json.RawMessage
+		if err := json.Unmarshal(body, &arr); err != nil {
+			arrays = nil
+			break
+		}
+		arrays = append(arrays, arr)
+	}
+
+	if arrays != nil {
+		var all []json.RawMessage
+		for _, arr := range arrays {
+			all = append(all, arr...)
+		}
+		return json.Marshal(all)
+	}
+
+	var result map[string]json.RawMessage
+	for _, body := range bodies {
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(body, &obj); err != nil {
+			return nil, err
+		}
+
+		if result == nil {
+			result = obj
+			continue
+		}
+
+		for key, value := range obj {
+			prev, ok := result[key]
+			if !ok {
+				result[key] = value
+				continue
+			}
+
+			if key == "count" {
+				var a, b int
+				if json.Unmarshal(prev, &a) == nil && json.Unmarshal(value, &b) == nil {
+					result[key], _ = json.Marshal(a + b)
+				}
+				continue
+			}
+
+			var prevArr, arr []json.RawMessage
+			if json.Unmarshal(prev, &prevArr) == nil && json.Unmarshal(value, &arr) == nil {
+				result[key], _ = json.Marshal(append(prevArr, arr...))
+			}
+		}
+	}
+
+	return json.Marshal(result)
+}
@@ -0,0 +1,96 @@
+package packer
+
+import (
+	"strings"
+	"time"
+)
+
+// MethodClass is the class of the method used to keep
+// reads and writes in separate batches.
+type MethodClass int
+
+const (
+	// ClassRead is the class of methods which do not change anything.
+	ClassRead MethodClass = iota
+	// ClassWrite is the class of mutating methods.
+	ClassWrite
+)
+
+var readPrefixes = []string{"get", "search", "is", "check", "resolve"}
+
+// ClassOf returns the class of the method guessed by its name:
+// methods like users.get, groups.search or utils.resolveScreenName are reads,
+// everything else is a write.
+func ClassOf(method string) MethodClass {
+	name := method[strings.LastIndexByte(method, '.')+1:]
+	for _, prefix := range readPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return ClassRead
+		}
+	}
+	return ClassWrite
+}
+
+// SeparateClasses keeps reads and writes in separate batches,
+// so heavy reads do not delay writes and failures of one batch
+// do not affect the other class. classify overrides ClassOf if not nil.
+func SeparateClasses(classify func(method string) MethodClass) Option {
+	return func(p *Packer) {
+		if classify == nil {
+			classify = ClassOf
+		}
+		p.classify = classify
+	}
+}
+
+// ClassMaxPackedRequests sets the maximum API calls inside one batch
+// of the class from 1 to 25, see SeparateClasses.
+func ClassMaxPackedRequests(class MethodClass, max int) Option {
+	return func(p *Packer) {
+		p.classMax[class] = max
+	}
+}
+
+// ClassFlushInterval sends batches of the class every interval
+// with SendClass, so e.g. writes may be flushed sooner than reads.
+// It works alongside FlushInterval, which sends batches of all classes.
+// Requires SeparateClasses.
+func ClassFlushInterval(class MethodClass, interval time.Duration) Option {
+	return func(p *Packer) {
+		p.classFlush[class] = interval
+	}
+}
+
+// classFlushLoop calls SendClass every interval until the packer is closed.
+func (p *Packer) classFlushLoop(class MethodClass, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.SendClass(class)
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// SendClass sends current batches of the class,
+// so each class may be flushed on its own schedule.
+func (p *Packer) SendClass(class MethodClass) {
+	if p.Paused() {
+		return
+	}
+	p.do(func() {
+		for key, pending := range p.batches {
+			if key.class != class {
+				continue
+			}
+			limits := p.limits(key)
+			for pending.len() > 0 {
+				p.dispatchBatch(key, p.batchInfo(pending, FlushSend), p.take(pending, limits))
+			}
+			delete(p.batches, key)
+		}
+	})
+}
@@ -0,0 +1,224 @@
+// Command vkpack runs VK API calls through the packer.
+//
+// Calls are read from the JSONL file (or stdin) as {"method": ..., "params": {...}} lines
+// or taken from flags, results are written to stdout as JSONL in the same order:
+//
+//	VK_TOKENS=token1,token2 vkpack -in calls.jsonl > results.jsonl
+//	VK_TOKEN=token vkpack -method users.get -params '{"user_ids": [1, 2]}'
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	packer "github.com/zweihander/vk-execute-packer/v2"
+)
+
+// chunkSize is the number of calls read before they are sent,
+// so big files are proceeded in constant memory.
+const chunkSize = 1000
+
+type call struct {
+	Method string                 `json:"method"`
+	Params map[string]interface{} `json:"params"`
+}
+
+type result struct {
+	Method        string            `json:"method"`
+	Response      json.RawMessage   `json:"response,omitempty"`
+	ExecuteErrors api.ExecuteErrors `json:"execute_errors,omitempty"`
+	Error         *resultError      `json:"error,omitempty"`
+}
+
+type resultError struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message"`
+}
+
+func main() {
+	var (
+		in          = flag.String("in", "-", "JSONL file with calls, - for stdin")
+		method      = flag.String("method", "", "method of a single call instead of the file")
+		params      = flag.String("params", "{}", "JSON object with params of the single call")
+		configPath  = flag.String("config", "", "packer config file (JSON or YAML)")
+		version     = flag.String("v", "", "API version")
+		parallelism = flag.Int("parallelism", 0, "maximum number of calls waiting for responses")
+	)
+	flag.Parse()
+	log.SetFlags(0)
+	log.SetPrefix("vkpack: ")
+
+	p, err := newPacker(*configPath, *version)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer p.Close()
+
+	var opts []packer.BulkOption
+	if *parallelism > 0 {
+		opts = append(opts, packer.BulkParallelism(*parallelism))
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	enc := json.NewEncoder(out)
+	run := func(calls []call) error {
+		reqs := make([]packer.Request, len(calls))
+		for i, c := range calls {
+			reqs[i] = packer.Request{Method: c.Method, Params: api.Params(c.Params)}
+		}
+		for i, res := range p.BulkCall(context.Background(), reqs, opts...) {
+			if err := enc.Encode(newResult(calls[i].Method, res)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if *method != "" {
+		c := call{Method: *method}
+		if err := decode(strings.NewReader(*params), &c.Params); err != nil {
+			log.Fatalf("params: %v", err)
+		}
+		err = run([]call{c})
+	} else {
+		err = readCalls(*in, run)
+	}
+	if err != nil {
+		out.Flush()
+		log.Fatal(err)
+	}
+}
+
+// newPacker creates the packer from the config, tokens are taken
+// from VK_TOKENS (comma separated) or VK_TOKEN if the config has none.
+func newPacker(configPath, version string) (*packer.Packer, error) {
+	var cfg packer.Config
+	if configPath != "" {
+		var err error
+		if cfg, err = packer.LoadConfig(configPath); err != nil {
+			return nil, err
+		}
+	}
+	if len(cfg.Tokens) == 0 {
+		for _, token := range strings.Split(os.Getenv("VK_TOKENS")+","+os.Getenv("VK_TOKEN"), ",") {
+			if token = strings.TrimSpace(token); token != "" {
+				cfg.Tokens = append(cfg.Tokens, token)
+			}
+		}
+	}
+	if len(cfg.Tokens) == 0 {
+		return nil, errors.New("no tokens: set VK_TOKENS or VK_TOKEN")
+	}
+	if version != "" {
+		cfg.Version = version
+	}
+
+	return packerFor(api.NewVK(cfg.Tokens[0]), cfg)
+}
+
+// packerFor creates the packer over vk. The handler of vk does not add
+// access_token and v, so they are added to requests sent without packing.
+func packerFor(vk *api.VK, cfg packer.Config) (*packer.Packer, error) {
+	version := cfg.Version
+	if version == "" {
+		version = api.Version
+	}
+	var next uint32
+	handler := func(method string, params ...api.Params) (api.Response, error) {
+		defaults := api.Params{}
+		if !hasParam(params, "access_token") {
+			defaults["access_token"] = cfg.Tokens[int(atomic.AddUint32(&next, 1)-1)%len(cfg.Tokens)]
+		}
+		if !hasParam(params, "v") {
+			defaults["v"] = version
+		}
+		return vk.Handler(method, append([]api.Params{defaults}, params...)...)
+	}
+	return packer.NewFromConfig(handler, cfg)
+}
+
+func hasParam(params []api.Params, name string) bool {
+	for _, p := range params {
+		if _, ok := p[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// readCalls reads calls from the file and passes them to run by chunks.
+func readCalls(path string, run func([]call) error) error {
+	r := io.Reader(os.Stdin)
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var calls []call
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var c call
+		if err := decode(strings.NewReader(scanner.Text()), &c); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if c.Method == "" {
+			return fmt.Errorf("line %d: no method", line)
+		}
+		calls = append(calls, c)
+		if len(calls) == chunkSize {
+			if err := run(calls); err != nil {
+				return err
+			}
+			calls = calls[:0]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(calls) == 0 {
+		return nil
+	}
+	return run(calls)
+}
+
+// decode keeps numbers as written, so big ids are not rounded.
+func decode(r io.Reader, v interface{}) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+func newResult(method string, res packer.Result) result {
+	out := result{
+		Method:        method,
+		Response:      res.Response.Response,
+		ExecuteErrors: res.Response.ExecuteErrors,
+	}
+	if res.Err != nil {
+		out.Error = &resultError{Message: res.Err.Error()}
+		var vkErr *api.Error
+		if errors.As(res.Err, &vkErr) {
+			out.Error.Code = int(vkErr.Code)
+		}
+	}
+	return out
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/stretchr/testify/assert"
+	packer "github.com/zweihander/vk-execute-packer/v2"
+	"github.com/zweihander/vk-execute-packer/v2/packertest"
+)
+
+func TestPackerForBypassedMethod(t *testing.T) {
+	s := packertest.NewServer().Respond("users.get", 1)
+	ts := packertest.NewHTTPServer(s)
+	defer ts.Close()
+
+	cfg := packer.Config{Tokens: []string{"token"}, Version: "5.131", Ignore: []string{"users.get"}}
+	p, err := packerFor(packertest.NewVK(ts, ""), cfg)
+	assert.Nil(t, err)
+	defer p.Close()
+
+	resp, err := p.Handler("users.get", api.Params{"user_ids": 1})
+	assert.Nil(t, err)
+	assert.Equal(t, "1", string(resp.Response))
+	calls := s.Calls()
+	if assert.Len(t, calls, 1) {
+		assert.Equal(t, "token", calls[0].String("access_token"))
+		assert.Equal(t, "5.131", calls[0].String("v"))
+	}
+	assert.Empty(t, s.Batches())
+}
@@ -0,0 +1,327 @@
+package packer
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+// Request is an API request.
+type Request struct {
+	Method string
+	Params api.Params
+}
+
+// Splitter splits the response of the merged request
+// into responses of the original requests (in the same order).
+type Splitter func(body json.RawMessage) ([]json.RawMessage, error)
+
+// Merger merges compatible requests of the method into one request.
+//
+// Params of requests passed to Merger are merged into one map
+// and their values are encoded to strings.
+type Merger interface {
+	// CanMerge reports whether b can be merged into a,
+	// where a is the result of merging previous requests.
+	CanMerge(a, b Request) bool
+	// Merge returns the request combining all reqs
+	// and the function splitting its response.
+	Merge(reqs []Request) (Request, Splitter)
+}
+
+var builtinMergers = map[string]Merger{
+	"users.get":        idListMerger{param: "user_ids", limit: 1000},
+	"groups.getById":   idListMerger{param: "group_ids", limit: 500},
+	"messages.getById": idListMerger{param: "message_ids", limit: 100, items: true},
+	"video.get":        idListMerger{param: "videos", limit: 200, ownerIDs: true, items: true},
+	"wall.getById":     idListMerger{param: "posts", limit: 100, ownerIDs: true},
+	"photos.getById":   idListMerger{param: "photos", limit: 500, ownerIDs: true},
+	"docs.getById":     idListMerger{param: "docs", limit: 500, ownerIDs: true},
+}
+
+// Coalesce enables merging of compatible requests waiting in the same batch
+// into one call, the response is split back to each caller.
+// Supported methods are users.get, groups.getById, messages.getById,
+// video.get, wall.getById, photos.getById and docs.getById.
+func Coalesce() Option {
+	return func(p *Packer) {
+		for method, m := range builtinMergers {
+			p.mergers[method] = m
+		}
+	}
+}
+
+// CoalesceMethod registers the merger for the method.
+// It can be used together with Coalesce to override built-in mergers.
+func CoalesceMethod(method string, m Merger) Option {
+	return func(p *Packer) {
+		p.mergers[method] = m
+	}
+}
+
+type mergeGroup struct {
+	m         Merger
+	reqs      []Request
+	callbacks []func(api.Response, error)
+	merged    Request
+	split     Splitter
+}
+
+func (g *mergeGroup) add(req Request, callback func(api.Response, error)) {
+	g.reqs = append(g.reqs, req)
+	g.callbacks = append(g.callbacks, callback)
+	g.merged, g.split = g.m.Merge(g.reqs)
+}
+
+// request returns the request which will be sent instead of the group.
+func (g *mergeGroup) request() request {
+	if len(g.reqs) == 1 {
+		return request{
+			method:   g.reqs[0].Method,
+			params:   []api.Params{g.reqs[0].Params},
+			callback: g.callbacks[0],
+		}
+	}
+
+	callbacks, split := g.callbacks, g.split
+	return request{
+		method: g.merged.Method,
+		params: []api.Params{g.merged.Params},
+		callback: func(resp api.Response, err error) {
+			if err != nil {
+				for _, callback := range callbacks {
+					callback(resp, err)
+				}
+				return
+			}
+
+			parts, err := split(resp.Response)
+			if err == nil && len(parts) != len(callbacks) {
+				err = fmt.Errorf("packer: coalesce: expected %d parts, got %d", len(callbacks), len(parts))
+			}
+			for i, callback := range callbacks {
+				if err != nil {
+					callback(api.Response{}, err)
+				} else {
+					callback(api.Response{Response: parts[i]}, nil)
+				}
+			}
+		},
+	}
+}
+
+// normalize merges params and encodes their values to strings.
+// vksdk internal params are dropped.
+func (p *Packer) normalize(params ...api.Params) api.Params {
+	normalized := make(api.Params)
+	iterateAll(func(key string, value interface{}) {
+		// vksdk internal params like ":context" are not sent
+		if !strings.HasPrefix(key, ":") {
+			normalized[key] = encodeParam(p.paramEncoders, value)
+		}
+	}, params...)
+	return normalized
+}
+
+// storedParams is normalize without the access token,
+// it is used for requests written to files or shared storage.
+func (p *Packer) storedParams(params ...api.Params) api.Params {
+	normalized := p.normalize(params...)
+	delete(normalized, "access_token")
+	return normalized
+}
+
+// coalesce tries to merge the request into one of the groups of the batch.
+// It creates a new group if there is no suitable one.
+func (p *Packer) coalesce(bat batch, m Merger, method string, params []api.Params, callback func(api.Response, error)) (batch, bool) {
+	req := Request{method, p.normalize(params...)}
+	for _, r := range bat {
+		if r.group != nil && r.method == method && m.CanMerge(r.group.merged, req) {
+			r.group.add(req, callback)
+			return bat, true
+		}
+	}
+
+	group := &mergeGroup{m: m}
+	group.add(req, callback)
+	return append(bat, request{method: method, group: group}), false
+}
+
+// idListMerger merges requests which differ only in the list of ids.
+// Extended requests are never merged since their responses
+// contain additional shared data.
+type idListMerger struct {
+	param string
+	limit int
+	// ownerIDs means that ids have "<owner_id>_<id>[_<access_key>]" form
+	// and items are matched by owner_id and id fields, otherwise
+	// ids are numeric and matched by id field.
+	ownerIDs bool
+	// items means that the response is {"count": N, "items": [...]}
+	// instead of plain array.
+	items bool
+}
+
+var ownerIDRegexp = regexp.MustCompile(`^-?[0-9]+_[0-9]+(_[a-zA-Z0-9]+)?$`)
+
+func (m idListMerger) splitIDs(s string) ([]string, bool) {
+	if s == "" {
+		return nil, false
+	}
+	ids := strings.Split(s, ",")
+	for i, id := range ids {
+		ids[i] = strings.TrimSpace(id)
+		if m.ownerIDs {
+			if !ownerIDRegexp.MatchString(ids[i]) {
+				return nil, false
+			}
+		} else if _, err := strconv.Atoi(ids[i]); err != nil {
+			return nil, false
+		}
+	}
+	return ids, true
+}
+
+// itemKey returns the key which is used to match the item to the requested id.
+func (m idListMerger) itemKey(item json.RawMessage) (string, error) {
+	var obj struct {
+		ID      int `json:"id"`
+		OwnerID int `json:"owner_id"`
+	}
+	if err := json.Unmarshal(item, &obj); err != nil {
+		return "", err
+	}
+	if m.ownerIDs {
+		return strconv.Itoa(obj.OwnerID) + "_" + strconv.Itoa(obj.ID), nil
+	}
+	return strconv.Itoa(obj.ID), nil
+}
+
+// idKey strips the access key from the id.
+func (m idListMerger) idKey(id string) string {
+	if m.ownerIDs {
+		if parts := strings.SplitN(id, "_", 3); len(parts) == 3 {
+			return parts[0] + "_" + parts[1]
+		}
+	}
+	return id
+}
+
+func (m idListMerger) ids(req Request) string {
+	s, _ := req.Params[m.param].(string)
+	return s
+}
+
+func (m idListMerger) CanMerge(a, b Request) bool {
+	if a.Method != b.Method || len(a.Params) != len(b.Params) {
+		return false
+	}
+
+	for key, value := range a.Params {
+		if key == m.param || key == "access_token" {
+			continue
+		}
+		if other, ok := b.Params[key]; !ok || other != value {
+			return false
+		}
+	}
+
+	if a.Params["extended"] == "1" {
+		return false
+	}
+
+	aIDs, ok := m.splitIDs(m.ids(a))
+	if !ok {
+		return false
+	}
+	bIDs, ok := m.splitIDs(m.ids(b))
+	if !ok {
+		return false
+	}
+
+	return len(union(aIDs, bIDs)) <= m.limit
+}
+
+func (m idListMerger) Merge(reqs []Request) (Request, Splitter) {
+	merged := Request{Method: reqs[0].Method, Params: make(api.Params)}
+	for key, value := range reqs[0].Params {
+		merged.Params[key] = value
+	}
+
+	var all []string
+	parts := make([][]string, len(reqs))
+	for i, req := range reqs {
+		parts[i], _ = m.splitIDs(m.ids(req))
+		all = union(all, parts[i])
+	}
+	merged.Params[m.param] = strings.Join(all, ",")
+
+	return merged, func(body json.RawMessage) ([]json.RawMessage, error) {
+		if m.items {
+			var obj struct {
+				Items json.RawMessage `json:"items"`
+			}
+			if err := json.Unmarshal(body, &obj); err != nil {
+				return nil, err
+			}
+			body = obj.Items
+		}
+
+		var items []json.RawMessage
+		if err := json.Unmarshal(body, &items); err != nil {
+			return nil, err
+		}
+
+		byKey := make(map[string]json.RawMessage, len(items))
+		for _, item := range items {
+			key, err := m.itemKey(item)
+			if err != nil {
+				return nil, err
+			}
+			byKey[key] = item
+		}
+
+		result := make([]json.RawMessage, len(parts))
+		for i, ids := range parts {
+			found := make([]json.RawMessage, 0, len(ids))
+			for _, id := range ids {
+				if item, ok := byKey[m.idKey(id)]; ok {
+					found = append(found, item)
+				}
+			}
+
+			var (
+				part interface{} = found
+				err  error
+			)
+			if m.items {
+				part = struct {
+					Count int               `json:"count"`
+					Items []json.RawMessage `json:"items"`
+				}{len(found), found}
+			}
+			if result[i], err = json.Marshal(part); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	}
+}
+
+func union(a, b []string) []string {
+	seen := make(map[string]struct{}, len(a)+len(b))
+	result := make([]string, 0, len(a)+len(b))
+	for _, list := range [][]string{a, b} {
+		for _, s := range list {
+			if _, ok := seen[s]; !ok {
+				seen[s] = struct{}{}
+				result = append(result, s)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,250 @@
+package packer
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+var (
+	methodRegexp  = regexp.MustCompile(`^[a-zA-Z0-9_]+(\.[a-zA-Z0-9_]+)*$`)
+	refPathRegexp = regexp.MustCompile(`^[a-zA-Z0-9_@.\[\]]*$`)
+)
+
+// writerPool keeps writers with their buffers, so validation
+// of each request and code generation do not allocate.
+var writerPool = sync.Pool{
+	New: func() interface{} {
+		return &codeWriter{buf: new(bytes.Buffer)}
+	},
+}
+
+// maxPooledBufferSize prevents huge buffers from being kept in the pool.
+const maxPooledBufferSize = 64 << 10
+
+// EncodeParams encodes params into VKScript object literal
+// the same way the packer does for batched calls.
+// It returns an error if params can't be safely encoded.
+func EncodeParams(params ...api.Params) (string, error) {
+	w := newCodeWriter(true, nil)
+	defer w.release()
+	w.params(params...)
+	return w.String(), w.err
+}
+
+func (p *Packer) validateCall(method string, params ...api.Params) error {
+	w := p.codeWriter()
+	defer w.release()
+	w.call(method, params...)
+	return w.err
+}
+
+// codeWriter generates VKScript code.
+// If minify is false the code is formatted for readability.
+type codeWriter struct {
+	buf      *bytes.Buffer
+	minify   bool
+	encoders []ParamEncoder
+	sorted   bool
+	err      error
+	scratch  [20]byte
+}
+
+func newCodeWriter(minify bool, encoders []ParamEncoder) *codeWriter {
+	w := writerPool.Get().(*codeWriter)
+	w.buf.Reset()
+	w.minify, w.encoders, w.sorted, w.err = minify, encoders, false, nil
+	return w
+}
+
+func (p *Packer) codeWriter() *codeWriter {
+	w := newCodeWriter(p.minify, p.paramEncoders)
+	w.sorted = p.deterministic
+	return w
+}
+
+// release returns the writer to the pool, it must not be used after.
+func (w *codeWriter) release() {
+	if w.buf.Cap() <= maxPooledBufferSize {
+		w.encoders = nil
+		writerPool.Put(w)
+	}
+}
+
+func (w *codeWriter) String() string {
+	return w.buf.String()
+}
+
+func (w *codeWriter) raw(s string) {
+	w.buf.WriteString(s)
+}
+
+// space writes s only in non-minified mode.
+func (w *codeWriter) space(s string) {
+	if !w.minify {
+		w.buf.WriteString(s)
+	}
+}
+
+func (w *codeWriter) int(i int64) {
+	w.buf.Write(strconv.AppendInt(w.scratch[:0], i, 10))
+}
+
+func (w *codeWriter) varName(step int) {
+	if w.minify {
+		w.raw("s")
+	} else {
+		w.raw("step")
+	}
+	w.int(int64(step))
+}
+
+func (w *codeWriter) setErr(err error) {
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+func (w *codeWriter) ref(r Ref) {
+	if !refPathRegexp.MatchString(r.Path) {
+		w.setErr(fmt.Errorf("packer: bad reference path %q", r.Path))
+		w.raw("null")
+		return
+	}
+	w.varName(r.Step)
+	if r.Path != "" {
+		w.raw(".")
+		w.raw(r.Path)
+	}
+}
+
+// call writes API call expression.
+func (w *codeWriter) call(method string, params ...api.Params) {
+	if !methodRegexp.MatchString(method) {
+		w.setErr(fmt.Errorf("packer: bad method name %q", method))
+	}
+	w.raw("API.")
+	w.raw(method)
+	w.raw("(")
+	w.params(params...)
+	w.raw(")")
+}
+
+// params writes params object literal.
+func (w *codeWriter) params(params ...api.Params) {
+	if len(params) > 1 {
+		params = []api.Params{mergeParams(params...)}
+	}
+
+	iterate := iterateAll
+	if w.sorted {
+		iterate = iterateSorted
+	}
+
+	w.raw("{")
+	first := true
+	iterate(func(name string, value interface{}) {
+		if isExecuteParam(name) {
+			return
+		}
+		if !first {
+			w.raw(",")
+			w.space(" ")
+		}
+		first = false
+		w.quote(name)
+		w.raw(":")
+		w.space(" ")
+		w.value(value)
+	}, params...)
+	w.raw("}")
+}
+
+// list writes comma separated items, every item on its own line in non-minified mode.
+func (w *codeWriter) list(n int, item func(i int)) {
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			w.raw(",")
+		}
+		w.space("\n\t")
+		item(i)
+	}
+	if n > 0 {
+		w.space("\n")
+	}
+}
+
+func (w *codeWriter) value(value interface{}) {
+	switch v := value.(type) {
+	case Ref:
+		w.ref(v)
+		return
+	case expr:
+		w.raw(string(v))
+		return
+	}
+	if len(w.encoders) == 0 {
+		// fast paths which match encodeParam, custom encoders may override them
+		switch v := value.(type) {
+		case string:
+			w.quote(v)
+			return
+		case int:
+			w.int(int64(v))
+			return
+		}
+	}
+	w.encoded(encodeParam(w.encoders, value))
+}
+
+// encoded writes the encoded param, numbers are written as is.
+func (w *codeWriter) encoded(s string) {
+	if _, err := strconv.ParseInt(s, 10, 64); err == nil {
+		w.raw(s)
+		return
+	}
+	w.quote(s)
+}
+
+// quote writes s as a double-quoted string literal
+// which is valid both in VKScript and JSON.
+func (w *codeWriter) quote(s string) {
+	if !utf8.ValidString(s) {
+		w.setErr(fmt.Errorf("packer: invalid UTF-8 string %q", s))
+		w.raw(`""`)
+		return
+	}
+
+	const hex = "0123456789abcdef"
+	w.buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"', '\\':
+			w.buf.WriteByte('\\')
+			w.buf.WriteRune(r)
+		case '\n':
+			w.raw(`\n`)
+		case '\r':
+			w.raw(`\r`)
+		case '\t':
+			w.raw(`\t`)
+		case '\u2028', '\u2029':
+			w.raw(`\u202`)
+			w.buf.WriteByte(hex[r&0xf])
+		default:
+			if r < 0x20 || r == 0x7f {
+				w.raw(`\u00`)
+				w.buf.WriteByte(hex[r>>4])
+				w.buf.WriteByte(hex[r&0xf])
+			} else {
+				w.buf.WriteRune(r)
+			}
+		}
+	}
+	w.buf.WriteByte('"')
+}
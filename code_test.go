@@ -0,0 +1,125 @@
+package packer_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/stretchr/testify/assert"
+	packer "github.com/zweihander/vk-execute-packer/v2"
+)
+
+func TestEncodeParams(t *testing.T) {
+	values := []string{
+		`"});API.account.ban({"owner_id":1});//`,
+		`back\slash`,
+		"new\nline\r\ttab",
+		"\x00\x1f\x7f",
+		"юникод 🙂",
+		"  ",
+	}
+
+	for _, v := range values {
+		code, err := packer.EncodeParams(api.Params{"message": v})
+		assert.Nil(t, err)
+
+		var decoded map[string]string
+		assert.Nil(t, json.Unmarshal([]byte(code), &decoded), code)
+		assert.Equal(t, v, decoded["message"])
+	}
+}
+
+func TestEncodeParamsInvalid(t *testing.T) {
+	_, err := packer.EncodeParams(api.Params{"message": "\xff"})
+	assert.Error(t, err)
+
+	_, err = packer.EncodeParams(api.Params{"user_ids": packer.Step(0, "id});API.wall.post({")})
+	assert.Error(t, err)
+}
+
+func TestEncodeParamsSkipsToken(t *testing.T) {
+	code, err := packer.EncodeParams(api.Params{"access_token": "secret", "count": 5})
+	assert.Nil(t, err)
+	assert.Equal(t, `{"count":5}`, code)
+}
+
+type screenName string
+
+func (s screenName) String() string { return "id" + string(s) }
+
+func TestEncodeParamsRichTypes(t *testing.T) {
+	code, err := packer.EncodeParams(api.Params{
+		"user_ids": []int{1, 2, 3},
+		"fields":   []string{"photo_50", "city"},
+		"extended": true,
+		"publish":  time.Unix(1600000000, 0),
+		"owner":    screenName("1"),
+	})
+	assert.Nil(t, err)
+
+	var decoded map[string]interface{}
+	assert.Nil(t, json.Unmarshal([]byte(code), &decoded), code)
+	assert.Equal(t, map[string]interface{}{
+		"user_ids": "1,2,3",
+		"fields":   "photo_50,city",
+		"extended": float64(1),
+		"publish":  float64(1600000000),
+		"owner":    "id1",
+	}, decoded)
+}
+
+func TestValidateBatch(t *testing.T) {
+	p := packer.MustNew(api.NewVK("").Handler)
+	assert.Nil(t, p.ValidateBatch([]packer.Request{
+		{Method: "users.get", Params: api.Params{"user_ids": []int{1, 2}}},
+		{Method: "wall.post", Params: api.Params{"message": "\"});API.account.ban({"}},
+	}))
+
+	assert.Error(t, p.ValidateBatch([]packer.Request{{Method: "users.get(", Params: api.Params{}}}))
+	assert.Error(t, p.ValidateBatch([]packer.Request{{Method: "wall.post", Params: api.Params{"message": "\xff"}}}))
+	assert.Error(t, p.ValidateBatch([]packer.Request{{Method: "users.get", Params: api.Params{"user_ids": packer.Step(0, "id")}}}))
+	assert.Error(t, p.ValidateBatch(make([]packer.Request, 26)))
+}
+
+func TestNewValidatesOptions(t *testing.T) {
+	handler := api.NewVK("").Handler
+	for name, opts := range map[string][]packer.Option{
+		"max packed requests": {packer.MaxPackedRequests(26)},
+		"no tokens":           {packer.Tokens()},
+		"empty token":         {packer.Tokens("token", "")},
+		"malformed token":     {packer.Tokens("token\n")},
+		"conflicting rules":   {packer.Rules(packer.Allow, "users.get"), packer.Rules(packer.Ignore, "users.get")},
+		"flush interval":      {packer.FlushInterval(-time.Second)},
+		"retry":               {packer.Retry(-1, 0)},
+		"max pending bytes":   {packer.MaxPendingBytes(0)},
+	} {
+		p, err := packer.New(handler, opts...)
+		assert.Error(t, err, name)
+		assert.Nil(t, p, name)
+	}
+
+	_, err := packer.New(nil)
+	assert.EqualError(t, err, "packer: nil handler")
+	assert.Panics(t, func() { packer.MustNew(handler, packer.MaxPackedRequests(0)) })
+
+	p, err := packer.New(handler, packer.Tokens("token"), packer.MaxPackedRequests(25),
+		packer.Rules(packer.Allow, "users.*"), packer.Rules(packer.Ignore, "users.get"))
+	assert.NoError(t, err)
+	assert.NoError(t, p.Close())
+}
+
+func FuzzValidateBatch(f *testing.F) {
+	f.Add("users.get", "user_ids", "1,2")
+	f.Add("wall.post", "message", `"});API.account.ban({"owner_id":1});//`)
+	p := packer.MustNew(api.NewVK("").Handler)
+	f.Fuzz(func(t *testing.T, method, name, value string) {
+		if p.ValidateBatch([]packer.Request{{Method: method, Params: api.Params{name: value}}}) != nil {
+			return
+		}
+		code, err := packer.EncodeParams(api.Params{name: value})
+		assert.Nil(t, err)
+		var decoded map[string]string
+		assert.Nil(t, json.Unmarshal([]byte(code), &decoded), code)
+	})
+}
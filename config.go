@@ -0,0 +1,370 @@
+package packer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"golang.org/x/time/rate"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the declarative packer configuration,
+// it can be unmarshaled from JSON or YAML.
+//
+//	max_packed_requests: 20
+//	flush_interval: 2s
+//	tokens: ["${VK_TOKEN}"]
+//	allow: ["messages.*"]
+//	ignore: ["messages.send"]
+//	retries: 3
+//	retry_backoff: 500ms
+//	rate_limit: 20
+//	method_limits:
+//	  messages.send: 5
+//
+// Options which take functions or interfaces (Use, OnBatch,
+// CacheStorage, PersistentQueue, ...) can only be passed in code.
+type Config struct {
+	MaxPackedRequests int      `json:"max_packed_requests" yaml:"max_packed_requests"`
+	FlushInterval     Duration `json:"flush_interval" yaml:"flush_interval"`
+	Version           string   `json:"version" yaml:"version"`
+	InjectVersion     bool     `json:"inject_version" yaml:"inject_version"`
+	StrictVersion     bool     `json:"strict_version" yaml:"strict_version"`
+	// Tokens may reference environment variables like "${VK_TOKEN}".
+	Tokens []string `json:"tokens" yaml:"tokens"`
+	Allow  []string `json:"allow" yaml:"allow"`
+	Ignore []string `json:"ignore" yaml:"ignore"`
+	// Profiles are named rule sets (see RuleProfile),
+	// Profile is the one which is activated on start.
+	Profiles     map[string]Profile `json:"profiles" yaml:"profiles"`
+	Profile      string             `json:"profile" yaml:"profile"`
+	Retries      int                `json:"retries" yaml:"retries"`
+	RetryBackoff Duration           `json:"retry_backoff" yaml:"retry_backoff"`
+	// RateLimit is the number of execute requests per second.
+	RateLimit    float64        `json:"rate_limit" yaml:"rate_limit"`
+	RateBurst    int            `json:"rate_burst" yaml:"rate_burst"`
+	MaxBatchCost int            `json:"max_batch_cost" yaml:"max_batch_cost"`
+	MethodCosts  map[string]int `json:"method_costs" yaml:"method_costs"`
+	MethodLimits map[string]int `json:"method_limits" yaml:"method_limits"`
+
+	Debug           bool    `json:"debug" yaml:"debug"`
+	NoMinify        bool    `json:"no_minify" yaml:"no_minify"`
+	NoDefaultBypass bool    `json:"no_default_bypass" yaml:"no_default_bypass"`
+	TokenRateLimit  float64 `json:"token_rate_limit" yaml:"token_rate_limit"`
+	TokenRateBurst  int     `json:"token_rate_burst" yaml:"token_rate_burst"`
+	Procedure       string  `json:"procedure" yaml:"procedure"`
+	ExecuteMethod   string  `json:"execute_method" yaml:"execute_method"`
+	// BatchParams are added to every execute request.
+	BatchParams   map[string]string `json:"batch_params" yaml:"batch_params"`
+	Coalesce      bool              `json:"coalesce" yaml:"coalesce"`
+	Deduplicate   bool              `json:"deduplicate" yaml:"deduplicate"`
+	Deterministic bool              `json:"deterministic" yaml:"deterministic"`
+	Disabled      bool              `json:"disabled" yaml:"disabled"`
+	// Cache enables Cache, CacheMethods and MethodTTLs map methods to TTLs.
+	Cache        Duration               `json:"cache" yaml:"cache"`
+	CacheMethods map[string]Duration    `json:"cache_methods" yaml:"cache_methods"`
+	MethodTTLs   map[string]Duration    `json:"method_ttls" yaml:"method_ttls"`
+	ChunkLimits  map[string]ChunkConfig `json:"chunk_limits" yaml:"chunk_limits"`
+	// LargePolicy is "bypass" (default) or "solo".
+	LargeRequestSize int    `json:"large_request_size" yaml:"large_request_size"`
+	LargePolicy      string `json:"large_policy" yaml:"large_policy"`
+	// PriorityShares are slots of normal and bulk requests.
+	PriorityShares []int `json:"priority_shares" yaml:"priority_shares"`
+	// ShutdownPolicy is "flush" (default), "fail" or "persist".
+	ShutdownPolicy   string   `json:"shutdown_policy" yaml:"shutdown_policy"`
+	ShutdownDeadline Duration `json:"shutdown_deadline" yaml:"shutdown_deadline"`
+	SpilloverDir     string   `json:"spillover_dir" yaml:"spillover_dir"`
+	SpilloverLimit   int      `json:"spillover_limit" yaml:"spillover_limit"`
+	Snapshot         string   `json:"snapshot" yaml:"snapshot"`
+	MaxPendingBytes  int      `json:"max_pending_bytes" yaml:"max_pending_bytes"`
+	QueueShards      int      `json:"queue_shards" yaml:"queue_shards"`
+
+	// keys are the keys present in the source of the config,
+	// nil if it was built in code.
+	keys map[string]struct{}
+}
+
+// has reports whether the key is set in the config: present in the file
+// or the environment, or non-zero if the config was built in code.
+func (cfg Config) has(key string) bool {
+	if cfg.keys != nil {
+		_, ok := cfg.keys[key]
+		return ok
+	}
+	v := reflect.ValueOf(cfg)
+	for i := 0; i < v.NumField(); i++ {
+		if configKey(v.Type().Field(i)) == key {
+			return !v.Field(i).IsZero()
+		}
+	}
+	return false
+}
+
+func configKey(field reflect.StructField) string {
+	return strings.Split(field.Tag.Get("yaml"), ",")[0]
+}
+
+// ChunkConfig is the config of ChunkLimit.
+type ChunkConfig struct {
+	Param string `json:"param" yaml:"param"`
+	Limit int    `json:"limit" yaml:"limit"`
+}
+
+// Duration is time.Duration which is unmarshaled from strings like "1.5s".
+type Duration time.Duration
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("packer: duration must be a string: %w", err)
+	}
+	return d.parse(s)
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	return d.parse(value.Value)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// MarshalYAML implements yaml.Marshaler.
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return time.Duration(d).String(), nil
+}
+
+func (d *Duration) parse(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("packer: %w", err)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// LoadConfig reads the config from JSON or YAML file,
+// the format is chosen by the file extension.
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+
+	cfg.keys = make(map[string]struct{})
+	switch ext := filepath.Ext(path); ext {
+	case ".json":
+		var keys map[string]json.RawMessage
+		if err = json.Unmarshal(data, &cfg); err == nil {
+			err = json.Unmarshal(data, &keys)
+		}
+		for key := range keys {
+			cfg.keys[key] = struct{}{}
+		}
+	case ".yaml", ".yml":
+		var keys map[string]interface{}
+		if err = yaml.Unmarshal(data, &cfg); err == nil {
+			err = yaml.Unmarshal(data, &keys)
+		}
+		for key := range keys {
+			cfg.keys[key] = struct{}{}
+		}
+	default:
+		return cfg, fmt.Errorf("packer: unknown config format %q", ext)
+	}
+	if err != nil {
+		return cfg, fmt.Errorf("packer: config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// NewFromConfig creates a new Packer configured by cfg.
+// Options are applied after the config and may override it.
+func NewFromConfig(handler VKHandler, cfg Config, opts ...Option) (*Packer, error) {
+	cfgOpts, err := cfg.options()
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := New(handler, append(cfgOpts, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Profile != "" {
+		if err := p.UseProfile(cfg.Profile); err != nil {
+			p.Close()
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func (cfg Config) options() ([]Option, error) {
+	var opts []Option
+	if cfg.MaxPackedRequests != 0 {
+		opts = append(opts, MaxPackedRequests(cfg.MaxPackedRequests))
+	}
+	if cfg.FlushInterval > 0 {
+		opts = append(opts, FlushInterval(time.Duration(cfg.FlushInterval)))
+	}
+	if cfg.Version != "" {
+		opts = append(opts, Version(cfg.Version))
+	}
+	if cfg.InjectVersion {
+		opts = append(opts, InjectVersion())
+	}
+	if cfg.StrictVersion {
+		opts = append(opts, StrictVersion())
+	}
+
+	if len(cfg.Tokens) > 0 {
+		tokens := make([]string, len(cfg.Tokens))
+		for i, token := range cfg.Tokens {
+			tokens[i] = os.ExpandEnv(token)
+			if strings.TrimSpace(tokens[i]) == "" {
+				return nil, fmt.Errorf("packer: token %q is empty", token)
+			}
+		}
+		opts = append(opts, Tokens(tokens...))
+	}
+
+	if len(cfg.Allow) > 0 {
+		opts = append(opts, Rules(Allow, cfg.Allow...))
+	}
+	if len(cfg.Ignore) > 0 {
+		opts = append(opts, Rules(Ignore, cfg.Ignore...))
+	}
+	for name, profile := range cfg.Profiles {
+		opts = append(opts, RuleProfile(name, profile))
+	}
+
+	if cfg.Retries > 0 {
+		opts = append(opts, Retry(cfg.Retries, time.Duration(cfg.RetryBackoff)))
+	}
+	if cfg.RateLimit > 0 {
+		burst := cfg.RateBurst
+		if burst < 1 {
+			burst = 1
+		}
+		opts = append(opts, RateLimit(rate.NewLimiter(rate.Limit(cfg.RateLimit), burst)))
+	}
+	if cfg.MaxBatchCost > 0 {
+		opts = append(opts, MaxBatchCost(cfg.MaxBatchCost))
+	}
+	for method, cost := range cfg.MethodCosts {
+		opts = append(opts, MethodCost(method, cost))
+	}
+	for method, max := range cfg.MethodLimits {
+		opts = append(opts, MethodLimit(method, max))
+	}
+
+	if cfg.Debug {
+		opts = append(opts, Debug())
+	}
+	if cfg.NoMinify {
+		opts = append(opts, NoMinify())
+	}
+	if cfg.NoDefaultBypass {
+		opts = append(opts, NoDefaultBypass())
+	}
+	if cfg.TokenRateLimit > 0 {
+		burst := cfg.TokenRateBurst
+		if burst < 1 {
+			burst = 1
+		}
+		opts = append(opts, TokenRateLimit(rate.Limit(cfg.TokenRateLimit), burst))
+	}
+	if cfg.Procedure != "" {
+		opts = append(opts, Procedure(cfg.Procedure))
+	}
+	if cfg.ExecuteMethod != "" {
+		opts = append(opts, ExecuteMethod(cfg.ExecuteMethod))
+	}
+	if len(cfg.BatchParams) > 0 {
+		params := api.Params{}
+		for name, value := range cfg.BatchParams {
+			params[name] = value
+		}
+		opts = append(opts, BatchParams(params))
+	}
+	if cfg.Coalesce {
+		opts = append(opts, Coalesce())
+	}
+	if cfg.Deduplicate {
+		opts = append(opts, Deduplicate())
+	}
+	if cfg.Deterministic {
+		opts = append(opts, Deterministic())
+	}
+	if cfg.Disabled {
+		opts = append(opts, Disabled())
+	}
+	if cfg.Cache > 0 {
+		opts = append(opts, Cache(time.Duration(cfg.Cache)))
+	}
+	for method, ttl := range cfg.CacheMethods {
+		opts = append(opts, CacheMethod(method, time.Duration(ttl)))
+	}
+	for method, ttl := range cfg.MethodTTLs {
+		opts = append(opts, MethodTTL(method, time.Duration(ttl)))
+	}
+	for method, chunk := range cfg.ChunkLimits {
+		opts = append(opts, ChunkLimit(method, chunk.Param, chunk.Limit))
+	}
+
+	if cfg.LargeRequestSize > 0 {
+		var policy LargePolicy
+		switch cfg.LargePolicy {
+		case "", "bypass":
+			policy = LargeBypass
+		case "solo":
+			policy = LargeSolo
+		default:
+			return nil, fmt.Errorf("packer: unknown large policy %q", cfg.LargePolicy)
+		}
+		opts = append(opts, LargeRequests(cfg.LargeRequestSize, policy))
+	}
+	if len(cfg.PriorityShares) > 0 {
+		if len(cfg.PriorityShares) != 2 {
+			return nil, fmt.Errorf("packer: priority shares must be [normal, bulk], got %v", cfg.PriorityShares)
+		}
+		opts = append(opts, PriorityShares(cfg.PriorityShares[0], cfg.PriorityShares[1]))
+	}
+	if cfg.ShutdownPolicy != "" || cfg.ShutdownDeadline > 0 {
+		var policy DrainPolicy
+		switch cfg.ShutdownPolicy {
+		case "", "flush":
+			policy = DrainFlush
+		case "fail":
+			policy = DrainFail
+		case "persist":
+			policy = DrainPersist
+		default:
+			return nil, fmt.Errorf("packer: unknown shutdown policy %q", cfg.ShutdownPolicy)
+		}
+		opts = append(opts, Shutdown(policy, time.Duration(cfg.ShutdownDeadline)))
+	}
+	if cfg.SpilloverLimit > 0 {
+		opts = append(opts, Spillover(cfg.SpilloverDir, cfg.SpilloverLimit))
+	}
+	if cfg.Snapshot != "" {
+		opts = append(opts, Snapshot(cfg.Snapshot))
+	}
+	if cfg.MaxPendingBytes > 0 {
+		opts = append(opts, MaxPendingBytes(cfg.MaxPendingBytes))
+	}
+	if cfg.QueueShards > 1 {
+		opts = append(opts, QueueShards(cfg.QueueShards))
+	}
+	return opts, nil
+}
@@ -0,0 +1,195 @@
+package packer
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "packer.yaml")
+	assert.NoError(t, os.WriteFile(yamlPath, []byte(`
+max_packed_requests: 10
+flush_interval: 2s
+tokens: ["${TEST_VK_TOKEN}"]
+ignore: ["messages.*"]
+profiles:
+  degraded:
+    allow: ["users.get"]
+retries: 3
+retry_backoff: 500ms
+method_limits:
+  messages.send: 5
+`), 0o600))
+
+	cfg, err := LoadConfig(yamlPath)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, cfg.MaxPackedRequests)
+	assert.Equal(t, Duration(2*time.Second), cfg.FlushInterval)
+	assert.Equal(t, Duration(500*time.Millisecond), cfg.RetryBackoff)
+	assert.Equal(t, []string{"users.get"}, cfg.Profiles["degraded"].Allow)
+	assert.Equal(t, 5, cfg.MethodLimits["messages.send"])
+
+	jsonPath := filepath.Join(dir, "packer.json")
+	assert.NoError(t, os.WriteFile(jsonPath, []byte(`{"max_packed_requests": 10, "flush_interval": "2s"}`), 0o600))
+	jsonCfg, err := LoadConfig(jsonPath)
+	assert.NoError(t, err)
+	assert.Equal(t, cfg.FlushInterval, jsonCfg.FlushInterval)
+
+	_, err = NewFromConfig(nopHandler, cfg)
+	assert.Error(t, err)
+
+	t.Setenv("TEST_VK_TOKEN", "token")
+	cfg.FlushInterval = 0
+	cfg.Profile = "degraded"
+	p, err := NewFromConfig(nopHandler, cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, p.maxPackedRequests)
+	assert.Equal(t, 1, p.tokenPool.Len())
+	assert.Equal(t, 3, p.retries)
+	assert.Equal(t, "degraded", p.ActiveProfile())
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "packer.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("max_packed_requests: 10\nretries: 3\n"), 0o600))
+
+	t.Setenv("APP_CONFIG", path)
+	t.Setenv("APP_MAX_BATCH", "20")
+	t.Setenv("APP_FLUSH_INTERVAL", "1s")
+	t.Setenv("APP_TOKENS", "token1, token2")
+	t.Setenv("APP_DEDUPLICATE", "true")
+	t.Setenv("APP_METHOD_LIMITS", `{"messages.send": 5}`)
+	t.Setenv("APP_CACHE_METHODS", `{"users.get": "1m"}`)
+	t.Setenv("APP_PRIORITY_SHARES", "3,2")
+	t.Setenv("APP_SHUTDOWN_POLICY", "fail")
+
+	cfg, err := ConfigFromEnv("APP")
+	assert.NoError(t, err)
+	assert.Equal(t, 20, cfg.MaxPackedRequests)
+	assert.Equal(t, 3, cfg.Retries)
+	assert.Equal(t, Duration(time.Second), cfg.FlushInterval)
+	assert.Equal(t, []string{"token1", "token2"}, cfg.Tokens)
+	assert.True(t, cfg.Deduplicate)
+	assert.Equal(t, map[string]int{"messages.send": 5}, cfg.MethodLimits)
+	assert.Equal(t, Duration(time.Minute), cfg.CacheMethods["users.get"])
+	assert.Equal(t, []int{3, 2}, cfg.PriorityShares)
+
+	p, err := NewFromEnv(nopHandler, "APP_")
+	assert.NoError(t, err)
+	defer p.Close()
+	assert.Equal(t, 20, p.maxPackedRequests)
+	assert.Equal(t, 2, p.tokenPool.Len())
+	assert.Equal(t, DrainFail, p.drainPolicy)
+
+	t.Setenv("APP_MAX_PACKED_REQUESTS", "5")
+	t.Setenv("APP_RETRIES", "many")
+	cfg, err = ConfigFromEnv("APP")
+	assert.EqualError(t, err, `packer: APP_RETRIES: strconv.Atoi: parsing "many": invalid syntax`)
+	assert.Equal(t, 5, cfg.MaxPackedRequests)
+
+	t.Setenv("APP_SHUTDOWN_POLICY", "later")
+	t.Setenv("APP_RETRIES", "1")
+	_, err = NewFromEnv(nopHandler, "APP")
+	assert.EqualError(t, err, `packer: unknown shutdown policy "later"`)
+}
+
+func TestApplyConfig(t *testing.T) {
+	p := MustNew(nopHandler, Tokens("token"), RuleProfile("degraded", Profile{Allow: []string{"users.get"}}))
+	defer p.Close()
+
+	err := p.ApplyConfig(Config{Profile: "unknown", MaxPackedRequests: 5})
+	assert.EqualError(t, err, `packer: unknown rule profile "unknown"`)
+	assert.Equal(t, 25, p.batchSize())
+
+	assert.NoError(t, p.ApplyConfig(Config{
+		MaxPackedRequests: 5,
+		FlushInterval:     Duration(time.Second),
+		Profile:           "degraded",
+		Retries:           2,
+		RetryBackoff:      Duration(time.Millisecond),
+		TokenRateLimit:    3,
+		MethodLimits:      map[string]int{"messages.send": 1},
+	}))
+	assert.Equal(t, 5, p.batchSize())
+	assert.Equal(t, "degraded", p.ActiveProfile())
+	retries, backoff := p.retryPolicy()
+	assert.Equal(t, 2, retries)
+	assert.Equal(t, time.Millisecond, backoff)
+	assert.NotNil(t, p.tokenLimiter("token"))
+	assert.Equal(t, time.Second, p.flushInterval)
+
+	assert.NoError(t, p.ApplyConfig(Config{FlushInterval: Duration(time.Minute)}))
+	assert.NoError(t, p.ApplyConfig(Config{}))
+	assert.Equal(t, 5, p.batchSize())
+	assert.Equal(t, "degraded", p.ActiveProfile())
+	assert.Equal(t, time.Minute, p.flushInterval)
+
+	path := filepath.Join(t.TempDir(), "packer.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(
+		"max_packed_requests: 0\nflush_interval: 0s\nprofile: \"\"\ntoken_rate_limit: 0\n"), 0o600))
+	cfg, err := LoadConfig(path)
+	assert.NoError(t, err)
+	assert.NoError(t, p.ApplyConfig(cfg))
+	assert.Equal(t, 25, p.batchSize())
+	assert.Equal(t, "", p.ActiveProfile())
+	assert.Nil(t, p.tokenLimiter("token"))
+	assert.Equal(t, time.Duration(0), p.flushInterval)
+	retries, _ = p.retryPolicy()
+	assert.Equal(t, 2, retries)
+}
+
+func TestWatchConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "packer.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("max_packed_requests: 10\n"), 0o600))
+
+	p := MustNew(nopHandler, Tokens("token"), Rules(Ignore, "users.get"), Retry(3, time.Second))
+	defer p.Close()
+	errs := make(chan error, 1)
+	stop := p.WatchConfig(path, time.Millisecond, func(err error) { errs <- err })
+	defer stop()
+
+	// the file is replaced atomically, so the watcher never sees it half written
+	write := func(data string) {
+		assert.NoError(t, os.WriteFile(path+".tmp", []byte(data), 0o600))
+		assert.NoError(t, os.Rename(path+".tmp", path))
+	}
+	write("max_packed_requests: 5\n")
+	assert.Eventually(t, func() bool { return p.batchSize() == 5 }, time.Second, time.Millisecond)
+	assert.True(t, p.bypass("users.get"))
+	retries, _ := p.retryPolicy()
+	assert.Equal(t, 3, retries)
+
+	write("profile: unknown\n")
+	assert.EqualError(t, <-errs, `packer: unknown rule profile "unknown"`)
+	assert.Equal(t, 5, p.batchSize())
+	stop()
+	stop()
+}
+
+func TestPackerConfig(t *testing.T) {
+	p := MustNew(nopHandler, Tokens("token1234567890"), MaxPackedRequests(10),
+		Rules(Allow, "messages.*", "users.get"), Retry(2, time.Second), MaxPendingBytes(1<<20))
+	defer p.Close()
+	assert.NoError(t, p.SetMaxPackedRequests(5))
+
+	cfg := p.Config()
+	assert.Equal(t, 5, cfg.MaxPackedRequests)
+	assert.Equal(t, []string{"...7890"}, cfg.Tokens)
+	assert.Equal(t, []string{"messages.*", "users.get"}, cfg.Allow)
+	assert.Equal(t, 2, cfg.Retries)
+	assert.Equal(t, 1<<20, cfg.MaxPendingBytes)
+	assert.Equal(t, "flush", cfg.ShutdownPolicy)
+	assert.Contains(t, cfg.ChunkLimits, "users.get")
+	assert.Contains(t, cfg.String(), `"retry_backoff":"1s"`)
+
+	var decoded Config
+	assert.NoError(t, json.Unmarshal([]byte(cfg.String()), &decoded))
+	assert.Equal(t, cfg.RetryBackoff, decoded.RetryBackoff)
+}
@@ -0,0 +1,37 @@
+package packer
+
+import (
+	"context"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+// ContextHandler is the handler signature which takes the context
+// explicitly instead of the ":context" param.
+type ContextHandler = func(ctx context.Context, method string, params ...api.Params) (api.Response, error)
+
+// FromContextHandler adapts the context-aware handler so it can be passed to New.
+// The context is taken from the request params (see api.Params.WithContext),
+// execute requests of packed batches get context.Background().
+func FromContextHandler(h ContextHandler) VKHandler {
+	return func(method string, params ...api.Params) (api.Response, error) {
+		ctx := paramsContext(params...)
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		return h(ctx, method, params...)
+	}
+}
+
+// ToContextHandler adapts the handler (e.g. p.Handler) to the context-aware signature.
+// The context is passed as the ":context" param.
+func ToContextHandler(h VKHandler) ContextHandler {
+	return func(ctx context.Context, method string, params ...api.Params) (api.Response, error) {
+		return h(method, append(params, api.Params{":context": ctx})...)
+	}
+}
+
+// HandlerContext proceeds the request with the context, see Handler.
+func (p *Packer) HandlerContext(ctx context.Context, method string, params ...api.Params) (api.Response, error) {
+	return ToContextHandler(p.Handler)(ctx, method, params...)
+}
@@ -0,0 +1,65 @@
+package packer
+
+// MethodCost sets the cost of the method call, by default every call costs 1.
+// Together with MaxBatchCost it keeps heavy calls (search, newsfeed)
+// from being packed into one execute which exceeds VKScript time limits.
+func MethodCost(method string, cost int) Option {
+	return func(p *Packer) {
+		p.costs[method] = cost
+	}
+}
+
+// MaxBatchCost sets the maximum total cost of calls inside one batch,
+// zero means no limit. The call which costs more than the limit is sent alone.
+func MaxBatchCost(cost int) Option {
+	return func(p *Packer) {
+		p.maxCost = cost
+	}
+}
+
+// MethodLimit sets the maximum number of calls of the method inside one batch.
+// Limit less than 1 removes the limit.
+func MethodLimit(method string, max int) Option {
+	return func(p *Packer) {
+		if max < 1 {
+			delete(p.methodLimits, method)
+			return
+		}
+		p.methodLimits[method] = max
+	}
+}
+
+// batchLimits limit batches taken from pending requests.
+type batchLimits struct {
+	requests     int
+	cost         int
+	costs        map[string]int
+	methodLimits map[string]int
+	shares       [numPriorities]int
+}
+
+func (l batchLimits) costOf(method string) int {
+	if cost, ok := l.costs[method]; ok {
+		return cost
+	}
+	return 1
+}
+
+func (p *Packer) limits(key batchKey) batchLimits {
+	requests := p.maxPackedRequests
+	if max, ok := p.classMax[key.class]; ok {
+		requests = max
+	}
+	return batchLimits{
+		requests:     requests,
+		cost:         p.maxCost,
+		costs:        p.costs,
+		methodLimits: p.methodLimits,
+		shares:       p.shares,
+	}
+}
+
+// full reports whether pending requests fill the whole batch.
+func (b *pendingBatch) full(l batchLimits) bool {
+	return b.len() >= l.requests || (l.cost > 0 && b.cost >= l.cost)
+}
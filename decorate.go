@@ -0,0 +1,23 @@
+package packer
+
+// DecorateErrors sets the function applied to every error of API requests
+// returned by the packer: Handler (and helpers built on it), Execute,
+// FetchPages, Pipeline.Run and Call, e.g. to add service-specific fields,
+// localize messages or map errors to the application taxonomy.
+// errors.Is and errors.As keep working if fn wraps the error with %w:
+//
+//	packer.DecorateErrors(func(method string, err error) error {
+//		return fmt.Errorf("vk %s: %w", method, err)
+//	})
+func DecorateErrors(fn func(method string, err error) error) Option {
+	return func(p *Packer) {
+		p.decorateErr = fn
+	}
+}
+
+func (p *Packer) decorate(method string, err error) error {
+	if err == nil || p.decorateErr == nil {
+		return err
+	}
+	return p.decorateErr(method, err)
+}
@@ -0,0 +1,80 @@
+package packer
+
+import "github.com/SevereCloud/vksdk/v2/api"
+
+// Deduplicate makes identical requests (same method, params and access token)
+// to be sent once while the first one is waiting in the batch or for the VK response,
+// the result is returned to every caller. Only the listed methods are
+// deduplicated, or reads by ClassOf if none are listed, so writes like
+// messages.send are always sent as many times as they are called.
+func Deduplicate(methods ...string) Option {
+	return func(p *Packer) {
+		p.dedup = true
+		p.flights = make(map[string]*flight)
+		if len(methods) > 0 {
+			p.dedupMethods = make(map[string]struct{}, len(methods))
+		}
+		for _, method := range methods {
+			p.dedupMethods[method] = struct{}{}
+		}
+	}
+}
+
+// deduplicates reports whether identical requests of the method are sent once.
+func (p *Packer) deduplicates(method string) bool {
+	if !p.dedup {
+		return false
+	}
+	if p.dedupMethods != nil {
+		_, ok := p.dedupMethods[method]
+		return ok
+	}
+	return ClassOf(method) == ClassRead
+}
+
+// flightKey identifies the request for deduplication, unlike requestKey
+// it includes the token, so calls on behalf of different users are not shared.
+func (p *Packer) flightKey(method string, params ...api.Params) string {
+	key := p.requestKey(method, params...)
+	if token, ok := mergeParams(params...)["access_token"].(string); ok {
+		key += "\x00" + token
+	}
+	return key
+}
+
+// flight holds callers waiting for the result of the same request.
+type flight struct {
+	callbacks []func(api.Response, error)
+}
+
+// joinFlight attaches the callback to the identical request if it is
+// pending or in flight and the method is deduplicated, so a write never
+// attaches to an already sent one. Runs on the dispatcher.
+func (p *Packer) joinFlight(method, key string, callback func(api.Response, error)) bool {
+	if !p.deduplicates(method) {
+		return false
+	}
+	f, ok := p.flights[key]
+	if ok {
+		f.callbacks = append(f.callbacks, callback)
+	}
+	return ok
+}
+
+// startFlight registers the request and returns the callback
+// which completes it. Runs on the dispatcher.
+func (p *Packer) startFlight(key string, callback func(api.Response, error)) func(api.Response, error) {
+	f := &flight{callbacks: []func(api.Response, error){callback}}
+	p.flights[key] = f
+	return func(resp api.Response, err error) {
+		var callbacks []func(api.Response, error)
+		p.doLate(func() {
+			delete(p.flights, key)
+			callbacks = f.callbacks
+		})
+
+		for _, callback := range callbacks {
+			callback(resp, err)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package packer
+
+import (
+	"sort"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+// Deterministic makes batching reproducible for tests: batches are sent
+// only by Send (full batches and FlushInterval do not trigger sending),
+// Send sends batches one by one ordered by their common params and waits for them,
+// and params are written to the code sorted by name.
+func Deterministic() Option {
+	return func(p *Packer) {
+		p.deterministic = true
+	}
+}
+
+// Pending returns the number of requests waiting for the batch to be sent.
+func (p *Packer) Pending() int {
+	var n int
+	p.do(func() {
+		n = p.pendingCount
+	})
+	return n
+}
+
+// sendOrdered sends current batches one by one in the order of their keys.
+func (p *Packer) sendOrdered() {
+	type sending struct {
+		key  batchKey
+		info BatchInfo
+		bat  batch
+	}
+	var batches []sending
+	p.do(func() {
+		keys := make([]batchKey, 0, len(p.batches))
+		for key := range p.batches {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i].less(keys[j]) })
+
+		for _, key := range keys {
+			pending, limits := p.batches[key], p.limits(key)
+			for pending.len() > 0 {
+				batches = append(batches, sending{key, p.batchInfo(pending, FlushSend), p.take(pending, limits)})
+			}
+		}
+		p.batches = make(map[batchKey]*pendingBatch)
+		p.inflight.Add(len(batches))
+	})
+
+	for _, s := range batches {
+		p.sendBatch(s.key, s.info, s.bat)
+		p.inflight.Done()
+	}
+}
+
+func (k batchKey) less(o batchKey) bool {
+	switch {
+	case k.version != o.version:
+		return k.version < o.version
+	case k.lang != o.lang:
+		return k.lang < o.lang
+	case k.https != o.https:
+		return k.https < o.https
+	case k.testMode != o.testMode:
+		return k.testMode < o.testMode
+	}
+	return k.class < o.class
+}
+
+// iterateSorted works like iterateAll, params are iterated sorted by name
+// after merging.
+func iterateSorted(iterFn func(key string, value interface{}), params ...api.Params) {
+	merged := mergeParams(params...)
+	names := make([]string, 0, len(merged))
+	for name := range merged {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		iterFn(name, merged[name])
+	}
+}
@@ -0,0 +1,189 @@
+package packer
+
+import (
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+// Pending batches are owned by the dispatcher goroutine: flushes
+// and shutdown are sent to it as commands and run one by one,
+// so the state is never shared between goroutines. Requests are pushed
+// to lock-free queues (see pushQueue) drained by the dispatcher
+// before every command. The dispatcher exits after the command of Close,
+// then commands fail with ErrShutdown and requests pushed
+// too late are failed by their producers (see failLate).
+
+// commandBuffer is the number of commands which may be queued
+// without blocking senders.
+const commandBuffer = 256
+
+func (p *Packer) dispatcherLoop() {
+	for cmd := range p.commands {
+		p.drainQueues()
+		cmd()
+		if p.isClosed() {
+			break
+		}
+	}
+
+	p.lateMtx.Lock()
+	close(p.exited)
+	atomic.StoreInt32(&p.late, 1)
+	p.lateMtx.Unlock()
+	p.failLate()
+}
+
+// post sends the command to the dispatcher without waiting for it.
+// It fails with ErrShutdown if the dispatcher has exited.
+func (p *Packer) post(cmd func()) error {
+	select {
+	case p.commands <- cmd:
+		return nil
+	case <-p.exited:
+		return ErrShutdown
+	}
+}
+
+// do runs the command on the dispatcher and waits for it.
+// It fails with ErrShutdown if the dispatcher has exited
+// before running the command. It must not be called by commands.
+func (p *Packer) do(cmd func()) error {
+	done := make(chan struct{})
+	err := p.post(func() {
+		cmd()
+		close(done)
+	})
+	if err != nil {
+		return err
+	}
+	select {
+	case <-done:
+		return nil
+	case <-p.exited:
+		select {
+		case <-done:
+			return nil
+		default:
+			return ErrShutdown
+		}
+	}
+}
+
+// doLate is like do, but runs the command on the calling goroutine
+// if the dispatcher has exited.
+func (p *Packer) doLate(cmd func()) {
+	if p.do(cmd) == nil {
+		return
+	}
+	p.lateMtx.Lock()
+	defer p.lateMtx.Unlock()
+	cmd()
+}
+
+// pushCommand adds the request to the pending batch. Commands are pooled
+// with their run funcs, so pushing does not allocate.
+type pushCommand struct {
+	p        *Packer
+	key      batchKey
+	solo     bool
+	method   string
+	params   []api.Params
+	callback func(api.Response, error)
+	run      func()
+	next     unsafe.Pointer // *pushCommand in pushQueue
+}
+
+var pushPool sync.Pool
+
+func init() {
+	pushPool.New = func() interface{} {
+		cmd := &pushCommand{}
+		cmd.run = cmd.exec
+		return cmd
+	}
+}
+
+// QueueShards spreads requests on their way to the dispatcher over n queues
+// (e.g. runtime.GOMAXPROCS(0)) to reduce contention of goroutines calling
+// Handler on many cores for the head of the single queue. The gain
+// depends on the machine, measure it with BenchmarkContention. The dispatcher drains
+// all queues before every command and adds their requests together.
+// Requests of different goroutines may be packed in a different order
+// than they were made. n less than 2 disables sharding.
+func QueueShards(n int) Option {
+	return func(p *Packer) {
+		p.queues = make([]pushQueue, maxInt(n, 1))
+		p.queueHints.New = func() interface{} {
+			i := int(atomic.AddUint32(&p.queueSeq, 1))
+			return &i
+		}
+	}
+}
+
+// wakeDispatcher is posted to make the dispatcher drain queues.
+var wakeDispatcher = func() {}
+
+// postPush adds the command to the queue of the current P
+// (the hint is taken from a sync.Pool which is local to P)
+// and wakes the dispatcher unless the queue is already scheduled.
+func (p *Packer) postPush(cmd *pushCommand) {
+	q := &p.queues[0]
+	if len(p.queues) > 1 {
+		hint := p.queueHints.Get().(*int)
+		q = &p.queues[*hint%len(p.queues)]
+		p.queueHints.Put(hint)
+	}
+	if q.push(cmd) {
+		_ = p.post(wakeDispatcher)
+	}
+	if atomic.LoadInt32(&p.late) == 1 {
+		p.failLate()
+	}
+}
+
+// failLate fails requests pushed after the dispatcher has exited.
+// Queues are popped under lateMtx, callbacks are called without it.
+func (p *Packer) failLate() {
+	var cmds []*pushCommand
+	p.lateMtx.Lock()
+	for i := range p.queues {
+		q := &p.queues[i]
+		for cmd := q.pop(); cmd != nil; cmd = q.pop() {
+			cmds = append(cmds, cmd)
+		}
+	}
+	p.lateMtx.Unlock()
+
+	for _, cmd := range cmds {
+		cmd.exec()
+	}
+}
+
+// drainQueues adds requests of all queues. Runs on the dispatcher.
+func (p *Packer) drainQueues() {
+	for i := range p.queues {
+		q := &p.queues[i]
+		if atomic.LoadInt32(&q.scheduled) == 0 {
+			continue
+		}
+		atomic.StoreInt32(&q.scheduled, 0)
+		for cmd := q.pop(); cmd != nil; cmd = q.pop() {
+			cmd.exec()
+		}
+	}
+}
+
+func (cmd *pushCommand) exec() {
+	p, key, solo, method, params, callback := cmd.p, cmd.key, cmd.solo, cmd.method, cmd.params, cmd.callback
+	*cmd = pushCommand{run: cmd.run}
+	pushPool.Put(cmd)
+
+	if p.isClosed() {
+		callback(api.Response{}, ErrShutdown)
+		return
+	}
+	p.add(key, solo, method, params, p.hold(callback))
+}
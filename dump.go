@@ -0,0 +1,135 @@
+package packer
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// Config returns the effective configuration of the packer: values set
+// by options and ApplyConfig, defaults (e.g. built-in chunk limits)
+// and active rules, so logs and support tickets show how the packer is set up.
+// Tokens are masked, Cache is reported per method in CacheMethods.
+// Options which take functions or interfaces and regexp rules are not reported.
+func (p *Packer) Config() Config {
+	cfg := Config{
+		Version:          p.version,
+		InjectVersion:    p.injectVersion,
+		StrictVersion:    p.strictVersion,
+		Tokens:           []string{},
+		Debug:            p.debug,
+		NoMinify:         !p.minify,
+		NoDefaultBypass:  !p.defaultBypass,
+		Procedure:        p.procedure,
+		ExecuteMethod:    p.execMethod,
+		Coalesce:         len(p.mergers) > 0,
+		Deduplicate:      p.dedup,
+		Deterministic:    p.deterministic,
+		Disabled:         !p.Enabled(),
+		CacheMethods:     durations(p.cacheTTLs),
+		MethodTTLs:       durations(p.ttls),
+		ChunkLimits:      make(map[string]ChunkConfig, len(p.chunkRules)),
+		PriorityShares:   []int{p.shares[PriorityNormal.index()], p.shares[PriorityBulk.index()]},
+		ShutdownDeadline: Duration(p.drainDeadline),
+		SpilloverLimit:   p.spillLimit,
+		Snapshot:         p.snapshotPath,
+	}
+
+	p.doLate(func() {
+		cfg.MaxPackedRequests = p.maxPackedRequests
+		cfg.MaxBatchCost = p.maxCost
+		cfg.MethodCosts = copyInts(p.costs)
+		cfg.MethodLimits = copyInts(p.methodLimits)
+	})
+	p.flushMtx.Lock()
+	cfg.FlushInterval = Duration(p.flushInterval)
+	p.flushMtx.Unlock()
+
+	for _, token := range p.tokenPool.All() {
+		cfg.Tokens = append(cfg.Tokens, tokenAlias(token))
+	}
+	sort.Strings(cfg.Tokens)
+
+	p.rulesMtx.RLock()
+	cfg.Allow = p.rules.allowed.names()
+	cfg.Ignore = p.rules.ignored.names()
+	cfg.Profile = p.profile
+	cfg.Profiles = make(map[string]Profile, len(p.profiles))
+	for name, profile := range p.profiles {
+		cfg.Profiles[name] = profile
+	}
+	p.rulesMtx.RUnlock()
+
+	p.tuneMtx.RLock()
+	cfg.Retries, cfg.RetryBackoff = p.retries, Duration(p.retryBackoff)
+	if p.limiter != nil {
+		cfg.RateLimit, cfg.RateBurst = float64(p.limiter.Limit()), p.limiter.Burst()
+	}
+	p.tuneMtx.RUnlock()
+
+	p.tokenLimMtx.Lock()
+	if p.tokenLimit > 0 {
+		cfg.TokenRateLimit, cfg.TokenRateBurst = float64(p.tokenLimit), p.tokenBurst
+	}
+	p.tokenLimMtx.Unlock()
+
+	if len(p.batchParams) > 0 {
+		cfg.BatchParams = make(map[string]string, len(p.batchParams))
+		for name, value := range p.batchParams {
+			cfg.BatchParams[name] = encodeParam(p.paramEncoders, value)
+		}
+	}
+	for method, rule := range p.chunkRules {
+		cfg.ChunkLimits[method] = ChunkConfig{Param: rule.param, Limit: rule.limit}
+	}
+	if p.largeSize > 0 {
+		cfg.LargeRequestSize = p.largeSize
+		cfg.LargePolicy = map[LargePolicy]string{LargeBypass: "bypass", LargeSolo: "solo"}[p.largePolicy]
+	}
+	cfg.ShutdownPolicy = map[DrainPolicy]string{DrainFlush: "flush", DrainFail: "fail", DrainPersist: "persist"}[p.drainPolicy]
+	if p.spill != nil {
+		cfg.SpilloverDir = p.spill.dir
+	}
+	if p.memory != nil {
+		cfg.MaxPendingBytes = p.memory.max
+	}
+	if len(p.queues) > 1 {
+		cfg.QueueShards = len(p.queues)
+	}
+	return cfg
+}
+
+// String returns the config as JSON.
+func (cfg Config) String() string {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
+
+// names returns exact names and patterns of the set sorted.
+func (s *methodSet) names() []string {
+	names := append([]string(nil), s.patterns...)
+	for name := range s.exact {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func durations(m map[string]time.Duration) map[string]Duration {
+	d := make(map[string]Duration, len(m))
+	for k, v := range m {
+		d[k] = Duration(v)
+	}
+	return d
+}
+
+func copyInts(m map[string]int) map[string]int {
+	c := make(map[string]int, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,95 @@
+package e2e
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/stretchr/testify/assert"
+	packer "github.com/zweihander/vk-execute-packer/v2"
+)
+
+func TestAdminHandler(t *testing.T) {
+	vk := &fakeVK{response: "1"}
+	p := packer.MustNew(vk.Handler, packer.Tokens("token-one-1111", "token-two-2222"))
+	defer p.Close()
+
+	auth := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "secret" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	ts := httptest.NewServer(http.StripPrefix("/packer", p.AdminHandler(auth)))
+	defer ts.Close()
+
+	call := func(method, path string) (int, map[string]interface{}) {
+		req, err := http.NewRequest(method, ts.URL+"/packer"+path, nil)
+		assert.Nil(t, err)
+		req.Header.Set("Authorization", "secret")
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		var body map[string]interface{}
+		_ = json.Unmarshal(data, &body)
+		return resp.StatusCode, body
+	}
+
+	resp, err := http.Get(ts.URL + "/packer/status")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	code, status := call(http.MethodPost, "/pause")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, true, status["paused"])
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := p.Handler("users.get", api.Params{"user_ids": 1})
+		result <- err
+	}()
+	waitPending()
+	p.Send()
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/packer/pending", nil)
+	req.Header.Set("Authorization", "secret")
+	resp, err = http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	var pending []map[string]interface{}
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&pending))
+	resp.Body.Close()
+	assert.Equal(t, []map[string]interface{}{{"method": "users.get", "params": map[string]interface{}{"user_ids": float64(1)}}}, pending)
+
+	code, status = call(http.MethodPost, "/resume")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Nil(t, <-result)
+	assert.Equal(t, float64(0), status["pending"])
+
+	code, status = call(http.MethodPost, "/batch-size?max=5")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(5), status["max_packed_requests"])
+	code, status = call(http.MethodPost, "/batch-size?max=50")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "packer: max packed requests must be from 1 to 25, got 50", status["error"])
+
+	code, status = call(http.MethodPost, "/tokens/evict?token=...1111")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []interface{}{"...2222"}, status["tokens"])
+	code, _ = call(http.MethodPost, "/tokens/evict?token=...2222")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = call(http.MethodGet, "/flush")
+	assert.Equal(t, http.StatusMethodNotAllowed, code)
+
+	forbidden := httptest.NewRecorder()
+	p.AdminHandler(nil).ServeHTTP(forbidden, httptest.NewRequest(http.MethodGet, "/status", nil))
+	assert.Equal(t, http.StatusForbidden, forbidden.Code)
+}
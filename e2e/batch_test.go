@@ -0,0 +1,621 @@
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/SevereCloud/vksdk/v2/object"
+	"github.com/stretchr/testify/assert"
+	packer "github.com/zweihander/vk-execute-packer/v2"
+	"golang.org/x/time/rate"
+)
+
+func TestBatchesSplitByVersion(t *testing.T) {
+	vk := &fakeVK{response: "1"}
+	p := packer.MustNew(vk.Handler, packer.Tokens("token"), packer.MaxPackedRequests(2))
+
+	var wg sync.WaitGroup
+	wg.Add(4)
+	for _, v := range []string{"5.100", "5.131", "5.100", "5.131"} {
+		go func(v string) {
+			defer wg.Done()
+			_, err := p.Handler("users.get", api.Params{"v": v})
+			assert.Nil(t, err)
+		}(v)
+	}
+	wg.Wait()
+
+	var versions []string
+	for _, exec := range vk.Executes() {
+		versions = append(versions, exec["v"].(string))
+		assert.NotContains(t, exec["code"], `"v"`)
+	}
+	sort.Strings(versions)
+	assert.Equal(t, []string{"5.100", "5.131"}, versions)
+}
+
+func TestInjectVersion(t *testing.T) {
+	vk := &fakeVK{response: "1"}
+	p := packer.MustNew(vk.Handler, packer.Tokens("token"), packer.MaxPackedRequests(1),
+		packer.Version("5.131"), packer.InjectVersion(), packer.StrictVersion())
+
+	_, err := p.Handler("users.get", api.Params{"user_ids": 1})
+	assert.Nil(t, err)
+	_, err = p.Handler("photos.getMessagesUploadServer", api.Params{"peer_id": 1})
+	assert.Nil(t, err)
+	executes := vk.Executes()
+	assert.Equal(t, "5.131", executes[0]["v"])
+	assert.NotContains(t, executes[1], "code")
+	assert.Equal(t, "5.131", executes[1]["v"])
+
+	_, err = p.Handler("users.get", api.Params{"user_ids": 1, "v": "5.100"})
+	assert.EqualError(t, err, "packer: users.get: api version 5.100 differs from 5.131")
+}
+
+func TestBatchesSplitByCommonParams(t *testing.T) {
+	vk := &fakeVK{response: "1"}
+	p := packer.MustNew(vk.Handler, packer.Tokens("token"))
+
+	var wg sync.WaitGroup
+	calls := []api.Params{
+		{"lang": "ru"},
+		{"lang": "en"},
+		{"lang": "en", "test_mode": true},
+		{"lang": "ru"},
+	}
+	wg.Add(len(calls))
+	for _, params := range calls {
+		go func(params api.Params) {
+			defer wg.Done()
+			_, err := p.Handler("users.get", params)
+			assert.Nil(t, err)
+		}(params)
+	}
+	for len(vk.Executes()) < 3 {
+		p.Send()
+	}
+	wg.Wait()
+
+	for _, exec := range vk.Executes() {
+		assert.NotContains(t, exec["code"], `"lang"`)
+		assert.NotContains(t, exec["code"], `"test_mode"`)
+	}
+}
+
+func TestProcedure(t *testing.T) {
+	var (
+		method string
+		args   api.Params
+	)
+	handler := func(m string, params ...api.Params) (api.Response, error) {
+		method = m
+		args = api.Params{}
+		for _, p := range params {
+			for k, v := range p {
+				args[k] = v
+			}
+		}
+		return api.Response{Response: []byte(`[1,2]`)}, nil
+	}
+	p := packer.MustNew(handler, packer.Tokens("token"), packer.Procedure("packed"), packer.MaxPackedRequests(2))
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, err := p.Handler("users.get", api.Params{"user_ids": []int{1, 2}})
+		assert.Nil(t, err)
+	}()
+	go func() {
+		defer wg.Done()
+		_, err := p.Handler("messages.send", api.Params{"peer_id": 1})
+		assert.Nil(t, err)
+	}()
+	wg.Wait()
+
+	assert.Equal(t, "execute.packed", method)
+	assert.NotContains(t, args, "code")
+	if args["methods"] == "users.get,messages.send" {
+		assert.Equal(t, "1,2", args["c0_user_ids"])
+		assert.Equal(t, "1", args["c1_peer_id"])
+	} else {
+		assert.Equal(t, "messages.send,users.get", args["methods"])
+		assert.Equal(t, "1", args["c0_peer_id"])
+		assert.Equal(t, "1,2", args["c1_user_ids"])
+	}
+}
+
+func TestExecuteMethod(t *testing.T) {
+	var methods []string
+	vk := &fakeVK{response: "1"}
+	handler := func(method string, params ...api.Params) (api.Response, error) {
+		methods = append(methods, method)
+		return vk.Handler(method, params...)
+	}
+	p := packer.MustNew(handler, packer.Tokens("token"), packer.MaxPackedRequests(1),
+		packer.ExecuteMethod("app.execute"), packer.BatchParams(api.Params{"client": "bot", "v": "5.0"}))
+
+	_, err := p.Handler("users.get", api.Params{"user_ids": 1})
+	assert.Nil(t, err)
+	_, err = p.Handler("app.execute", api.Params{"code": "return 1;"})
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{"app.execute", "app.execute"}, methods)
+	executes := vk.Executes()
+	assert.Equal(t, "bot", executes[0]["client"])
+	assert.Equal(t, api.Version, executes[0]["v"])
+	assert.Equal(t, "token", executes[0]["access_token"])
+	assert.NotContains(t, executes[1], "client")
+}
+
+func TestChunkIDs(t *testing.T) {
+	vk := &fakeVK{response: `[{"id":1}]`}
+	p := packer.MustNew(vk.Handler, packer.Tokens("token"))
+
+	ids := make([]int, 2500)
+	for i := range ids {
+		ids[i] = i + 1
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		resp, err := p.Handler("users.get", api.Params{"user_ids": ids})
+		assert.Nil(t, err)
+		assert.JSONEq(t, `[{"id":1},{"id":1},{"id":1}]`, string(resp.Response))
+	}()
+
+	for {
+		select {
+		case <-done:
+			calls := 0
+			for _, exec := range vk.Executes() {
+				calls += strings.Count(exec["code"].(string), "API.users.get")
+			}
+			assert.Equal(t, 3, calls)
+			return
+		default:
+			p.Send()
+		}
+	}
+}
+
+func TestParamEncoders(t *testing.T) {
+	vk := &fakeVK{response: "1"}
+	alias := packer.ParamEncoderFunc(func(value interface{}) (string, bool) {
+		switch v := value.(type) {
+		case string:
+			if v == "me" {
+				return "42", true
+			}
+		case int:
+			if v == 0 {
+				return "all", true
+			}
+		}
+		return "", false
+	})
+	p := packer.MustNew(vk.Handler, packer.Tokens("token"), packer.MaxPackedRequests(1), packer.ParamEncoders(alias))
+	defer p.Close()
+
+	_, err := p.Handler("users.get", api.Params{"user_ids": "me", "fields": "city", "offset": 0, "count": 5})
+	assert.Nil(t, err)
+	code := vk.Executes()[0]["code"]
+	assert.Contains(t, code, `"user_ids":42`)
+	assert.Contains(t, code, `"fields":"city"`)
+	assert.Contains(t, code, `"offset":"all"`)
+	assert.Contains(t, code, `"count":5`)
+}
+
+func TestMergedParams(t *testing.T) {
+	vk := &fakeVK{response: "1"}
+	p := packer.MustNew(vk.Handler, packer.MaxPackedRequests(1))
+
+	_, err := p.Handler("users.get",
+		api.Params{"access_token": "first", "user_ids": 1, "fields": "city"},
+		api.Params{"access_token": "second", "user_ids": 2},
+		api.Params{}.WithContext(context.Background()),
+	)
+	assert.Nil(t, err)
+
+	executes := vk.Executes()
+	assert.Len(t, executes, 1)
+	assert.Equal(t, "second", executes[0]["access_token"])
+	code := executes[0]["code"].(string)
+	assert.Equal(t, 1, strings.Count(code, `"user_ids"`))
+	assert.Contains(t, code, `"user_ids":2`)
+	assert.Contains(t, code, `"fields":"city"`)
+	assert.NotContains(t, code, `:context`)
+}
+
+func TestCall(t *testing.T) {
+	vk := &fakeVK{response: `[{"id":1,"first_name":"Pavel"}]`}
+	p := packer.MustNew(vk.Handler, packer.Tokens("token"), packer.MaxPackedRequests(1))
+
+	users, err := packer.Call[[]object.UsersUser](p, "users.get", api.Params{"user_ids": 1})
+	assert.Nil(t, err)
+	assert.Len(t, users, 1)
+	assert.Equal(t, "Pavel", users[0].FirstName)
+}
+
+func TestOnRawResponse(t *testing.T) {
+	vk := &fakeVK{response: `{"id": 1}`}
+	var raw json.RawMessage
+	p := packer.MustNew(vk.Handler, packer.Tokens("token"), packer.MaxPackedRequests(1),
+		packer.OnRawResponse(func(_ packer.BatchInfo, req packer.Request, body json.RawMessage) {
+			assert.Equal(t, "users.get", req.Method)
+			raw = append(raw[:0], body...)
+		}),
+	)
+
+	_, err := p.Handler("users.get", api.Params{"user_ids": 1})
+	assert.Nil(t, err)
+	assert.Equal(t, `{"id": 1}`, string(raw))
+}
+
+func TestFlushAfter(t *testing.T) {
+	vk := &fakeVK{response: "1"}
+	triggers := make(chan packer.FlushTrigger, 1)
+	p := packer.MustNew(vk.Handler, packer.Tokens("token"),
+		packer.OnBatch(func(info packer.BatchInfo, _ error) { triggers <- info.Trigger }))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := p.Handler("users.get", api.Params{"user_ids": 1})
+		assert.Nil(t, err)
+	}()
+	assert.Eventually(t, func() bool { return p.Pending() == 1 }, time.Second, time.Millisecond)
+
+	_, err := p.Handler("messages.send", api.Params{"peer_id": 1}.WithContext(packer.FlushAfter(context.Background())))
+	assert.Nil(t, err)
+	<-done
+	assert.Equal(t, packer.FlushHint, <-triggers)
+	assert.Len(t, vk.Executes(), 1)
+}
+
+func TestWithPlacement(t *testing.T) {
+	vk := &fakeVK{response: "1"}
+	batches := make(chan packer.BatchInfo, 1)
+	p := packer.MustNew(vk.Handler, packer.Tokens("token"), packer.MaxPackedRequests(2),
+		packer.OnBatch(func(info packer.BatchInfo, _ error) { batches <- info }))
+
+	var first, second packer.Placement
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := p.Handler("users.get", api.Params{"user_ids": 1}.WithContext(packer.WithPlacement(context.Background(), &first)))
+		assert.Nil(t, err)
+	}()
+	assert.Eventually(t, func() bool { return p.Pending() == 1 }, time.Second, time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+
+	_, err := p.Handler("users.get", api.Params{"user_ids": 2}.WithContext(packer.WithPlacement(context.Background(), &second)))
+	assert.Nil(t, err)
+	<-done
+
+	info := <-batches
+	assert.Equal(t, info.ID, first.BatchID)
+	assert.Equal(t, info.ID, second.BatchID)
+	assert.Equal(t, []int{0, 1}, []int{first.Index, second.Index})
+	assert.Equal(t, 2, first.Requests)
+	assert.Equal(t, packer.FlushFull, first.Trigger)
+	assert.GreaterOrEqual(t, first.Waited, 10*time.Millisecond)
+	assert.Less(t, second.Waited, first.Waited)
+}
+
+func TestOnBatch(t *testing.T) {
+	errVK := errors.New("vk is down")
+	p := packer.MustNew(func(method string, params ...api.Params) (api.Response, error) {
+		return api.Response{}, errVK
+	}, packer.Tokens("secret-token"), packer.MaxPackedRequests(1),
+		packer.OnBatch(func(info packer.BatchInfo, err error) {
+			assert.Equal(t, packer.FlushFull, info.Trigger)
+			assert.Equal(t, 1, info.Requests)
+			assert.Equal(t, "...oken", info.Token)
+			assert.NotZero(t, info.CodeSize)
+			assert.ErrorIs(t, err, errVK)
+		}),
+	)
+
+	_, err := p.Handler("users.get", api.Params{"user_ids": 1})
+	var batchErr *packer.BatchError
+	assert.ErrorAs(t, err, &batchErr)
+	assert.ErrorIs(t, err, errVK)
+	assert.Equal(t, uint64(1), batchErr.Info.ID)
+}
+
+func TestRateLimit(t *testing.T) {
+	p := packer.MustNew(fakeExecute("1"), packer.Tokens("token"), packer.MaxPackedRequests(1),
+		packer.RateLimit(rate.NewLimiter(20, 1)))
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		_, err := p.Handler("users.get", api.Params{"user_ids": i})
+		assert.Nil(t, err)
+	}
+	assert.True(t, time.Since(start) >= 90*time.Millisecond)
+}
+
+func TestSpillover(t *testing.T) {
+	vk := &fakeVK{response: "1"}
+	p := packer.MustNew(vk.Handler, packer.Tokens("token"), packer.MaxPackedRequests(3),
+		packer.Spillover(t.TempDir(), 1))
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	for i := 1; i <= 3; i++ {
+		go func(i int) {
+			defer wg.Done()
+			resp, err := p.Handler("messages.send", api.Params{"peer_id": i, "message": strings.Repeat("x", 100)})
+			assert.Nil(t, err)
+			assert.Equal(t, "1", string(resp.Response))
+		}(i)
+	}
+	wg.Wait()
+
+	code := vk.Executes()[0]["code"].(string)
+	for _, peer := range []string{"1", "2", "3"} {
+		assert.Regexp(t, `"peer_id":"?`+peer, code)
+	}
+}
+
+func TestSpilloverKeepsContext(t *testing.T) {
+	p := packer.MustNew(fakeExecute("1"), packer.Tokens("token"), packer.Spillover(t.TempDir(), 1))
+
+	placements := make([]packer.Placement, 3)
+	var wg sync.WaitGroup
+	wg.Add(3)
+	for i := range placements {
+		go func(i int) {
+			defer wg.Done()
+			params := api.Params{"peer_id": i, "message": "hi"}
+			_, err := p.Handler("messages.send", params.WithContext(packer.WithPlacement(context.Background(), &placements[i])))
+			assert.Nil(t, err)
+		}(i)
+	}
+	for p.Pending() < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	p.Send()
+	wg.Wait()
+
+	// the requests beyond the first one were spilled
+	for _, pl := range placements {
+		assert.Equal(t, 3, pl.Requests)
+	}
+}
+
+func TestMethodTTL(t *testing.T) {
+	vk := &fakeVK{response: "1"}
+	expired := make(chan packer.Request, 1)
+	p := packer.MustNew(vk.Handler, packer.Tokens("token"),
+		packer.MethodTTL("messages.setActivity", 10*time.Millisecond),
+		packer.OnExpire(func(req packer.Request) { expired <- req }),
+	)
+
+	_, err := p.Handler("messages.setActivity", api.Params{"peer_id": 1, "type": "typing"})
+	assert.ErrorIs(t, err, packer.ErrExpired)
+	assert.Equal(t, "messages.setActivity", (<-expired).Method)
+
+	p.Send()
+	time.Sleep(10 * time.Millisecond)
+	assert.Empty(t, vk.Executes())
+}
+
+func TestSeparateClasses(t *testing.T) {
+	assert.Equal(t, packer.ClassRead, packer.ClassOf("utils.resolveScreenName"))
+	assert.Equal(t, packer.ClassWrite, packer.ClassOf("messages.send"))
+
+	vk := &fakeVK{response: "1"}
+	p := packer.MustNew(vk.Handler, packer.Tokens("token"),
+		packer.SeparateClasses(nil),
+		packer.ClassMaxPackedRequests(packer.ClassWrite, 1),
+	)
+
+	read := make(chan error, 1)
+	go func() {
+		_, err := p.Handler("users.get", api.Params{"user_ids": 1})
+		read <- err
+	}()
+	_, err := p.Handler("messages.send", api.Params{"peer_id": 1})
+	assert.Nil(t, err)
+	assert.Len(t, vk.Executes(), 1)
+	assert.NotContains(t, vk.Executes()[0]["code"], "users.get")
+
+	for len(vk.Executes()) < 2 {
+		p.SendClass(packer.ClassRead)
+		time.Sleep(time.Millisecond)
+	}
+	assert.Nil(t, <-read)
+}
+
+func TestClassFlushInterval(t *testing.T) {
+	vk := &fakeVK{response: "1"}
+	p := packer.MustNew(vk.Handler, packer.Tokens("token"),
+		packer.SeparateClasses(nil),
+		packer.ClassFlushInterval(packer.ClassWrite, time.Millisecond),
+	)
+	defer p.Close()
+
+	read := make(chan error, 1)
+	go func() {
+		_, err := p.Handler("users.get", api.Params{"user_ids": 1})
+		read <- err
+	}()
+	_, err := p.Handler("messages.send", api.Params{"peer_id": 1})
+	assert.Nil(t, err)
+	for _, exec := range vk.Executes() {
+		assert.NotContains(t, exec["code"], "users.get")
+	}
+
+	for len(vk.Executes()) < 2 {
+		p.SendClass(packer.ClassRead)
+		time.Sleep(time.Millisecond)
+	}
+	assert.Nil(t, <-read)
+
+	_, err = packer.New(vk.Handler, packer.ClassFlushInterval(packer.ClassWrite, time.Second))
+	assert.EqualError(t, err, "packer: ClassFlushInterval requires SeparateClasses")
+}
+
+func TestLargeRequests(t *testing.T) {
+	for _, policy := range []packer.LargePolicy{packer.LargeBypass, packer.LargeSolo} {
+		vk := &fakeVK{response: "1"}
+		p := packer.MustNew(vk.Handler, packer.Tokens("token"), packer.LargeRequests(100, policy))
+
+		_, err := p.Handler("messages.send", api.Params{"peer_id": 1, "message": strings.Repeat("x", 200)})
+		assert.Nil(t, err)
+
+		executes := vk.Executes()
+		assert.Len(t, executes, 1)
+		assert.Equal(t, policy == packer.LargeSolo, executes[0]["code"] != nil)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	vk := &fakeVK{response: "1"}
+	var calls int32
+	handler := func(method string, params ...api.Params) (api.Response, error) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			return api.Response{}, errors.New("connection reset")
+		}
+		return vk.Handler(method, params...)
+	}
+
+	infos := make(chan packer.BatchInfo, 1)
+	p := packer.MustNew(handler, packer.Tokens("token"), packer.MaxPackedRequests(1),
+		packer.Retry(2, time.Millisecond),
+		packer.OnBatch(func(info packer.BatchInfo, err error) { infos <- info }))
+
+	resp, err := p.Handler("users.get", api.Params{"user_ids": 1})
+	assert.Nil(t, err)
+	assert.Equal(t, "1", string(resp.Response))
+	assert.Equal(t, 3, (<-infos).Attempt)
+}
+
+func TestRetryWrites(t *testing.T) {
+	errs := make(chan error, 2)
+	var calls int32
+	handler := func(method string, params ...api.Params) (api.Response, error) {
+		atomic.AddInt32(&calls, 1)
+		select {
+		case err := <-errs:
+			return api.Response{}, err
+		default:
+			return fakeExecute("1")(method, params...)
+		}
+	}
+	send := func(opts ...packer.Option) error {
+		atomic.StoreInt32(&calls, 0)
+		p := packer.MustNew(handler, append([]packer.Option{packer.Tokens("token"),
+			packer.MaxPackedRequests(1), packer.Retry(2, 0)}, opts...)...)
+		defer p.Close()
+		_, err := p.Handler("messages.send", api.Params{"peer_id": 1, "message": "hi"})
+		return err
+	}
+
+	errs <- errors.New("read: connection reset")
+	assert.Error(t, send())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	errs <- &api.Error{Code: api.ErrTooMany}
+	assert.Nil(t, send())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	errs <- errors.New("read: connection reset")
+	assert.Nil(t, send(packer.RetryIf(func(string) bool { return true })))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestExecuteRetry(t *testing.T) {
+	errs := make(chan error, 1)
+	var calls int32
+	handler := func(method string, params ...api.Params) (api.Response, error) {
+		atomic.AddInt32(&calls, 1)
+		select {
+		case err := <-errs:
+			return api.Response{}, err
+		default:
+			return api.Response{Response: json.RawMessage("1")}, nil
+		}
+	}
+	infos := make(chan packer.BatchInfo, 1)
+	p := packer.MustNew(handler, packer.Tokens("token"), packer.Retry(2, 0),
+		packer.OnBatch(func(info packer.BatchInfo, err error) { infos <- info }))
+	defer p.Close()
+
+	errs <- errors.New("read: connection reset")
+	resp, err := p.Execute(`return API.users.get({"user_ids":1});`)
+	assert.Nil(t, err)
+	assert.Equal(t, "1", string(resp.Response))
+	info := <-infos
+	assert.Equal(t, packer.FlushExecute, info.Trigger)
+	assert.Equal(t, 2, info.Attempt)
+	assert.Equal(t, 1, info.Requests)
+	assert.Equal(t, "***", info.Token)
+
+	atomic.StoreInt32(&calls, 0)
+	errs <- errors.New("read: connection reset")
+	_, err = p.Execute(`API.messages.send({"peer_id":1});return API.users.get({"user_ids":1});`)
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	assert.Equal(t, 2, (<-infos).Requests)
+}
+
+func TestFlushInterval(t *testing.T) {
+	p := packer.MustNew(fakeExecute("1"), packer.Tokens("token"),
+		packer.FlushInterval(10*time.Millisecond))
+	defer p.Close()
+
+	resp, err := p.Handler("users.get", api.Params{"user_ids": 1})
+	assert.Nil(t, err)
+	assert.Equal(t, "1", string(resp.Response))
+}
+
+func TestDeterministic(t *testing.T) {
+	vk := &fakeVK{response: "1"}
+	var ids []uint64
+	p := packer.MustNew(vk.Handler, packer.Tokens("token"), packer.MaxPackedRequests(2), packer.Deterministic(),
+		packer.OnBatch(func(info packer.BatchInfo, err error) {
+			ids = append(ids, info.ID)
+		}),
+	)
+
+	var wg sync.WaitGroup
+	for i, v := range []string{"5.131", "5.100", "5.131", "5.131"} {
+		wg.Add(1)
+		go func(i int, v string) {
+			defer wg.Done()
+			_, err := p.Handler("users.get", api.Params{"v": v, "user_ids": i, "fields": "photo", "name_case": "gen"})
+			assert.Nil(t, err)
+		}(i, v)
+		for p.Pending() <= i {
+			runtime.Gosched()
+		}
+	}
+	assert.Empty(t, vk.Executes())
+
+	p.Send()
+	wg.Wait()
+
+	var codes []string
+	for _, exec := range vk.Executes() {
+		codes = append(codes, exec["v"].(string)+" "+exec["code"].(string))
+	}
+	assert.Equal(t, []string{
+		`5.100 return[API.users.get({"fields":"photo","name_case":"gen","user_ids":1})];`,
+		`5.131 return[API.users.get({"fields":"photo","name_case":"gen","user_ids":0}),API.users.get({"fields":"photo","name_case":"gen","user_ids":2})];`,
+		`5.131 return[API.users.get({"fields":"photo","name_case":"gen","user_ids":3})];`,
+	}, codes)
+	assert.Equal(t, []uint64{1, 2, 3}, ids)
+}
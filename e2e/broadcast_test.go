@@ -0,0 +1,37 @@
+package e2e
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/stretchr/testify/assert"
+	packer "github.com/zweihander/vk-execute-packer/v2"
+)
+
+func TestBroadcast(t *testing.T) {
+	vk := &fakeVK{response: "123"}
+	p := packer.MustNew(vk.Handler, packer.Tokens("token"))
+
+	start := time.Now()
+	results := p.Broadcast([]int{1, 2, 3, 1}, func(peer int) api.Params {
+		return api.Params{"message": "hi"}
+	}, packer.BroadcastRate(1000), packer.BroadcastPeerInterval(50*time.Millisecond))
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+
+	assert.Len(t, results, 4)
+	for i, peer := range []int{1, 2, 3, 1} {
+		assert.Equal(t, peer, results[i].PeerID)
+		assert.Nil(t, results[i].Err)
+		assert.Equal(t, 123, results[i].MessageID)
+	}
+
+	calls := 0
+	for _, exec := range vk.Executes() {
+		code := exec["code"].(string)
+		calls += strings.Count(code, "API.messages.send")
+		assert.Equal(t, strings.Count(code, "API.messages.send"), strings.Count(code, "random_id"))
+	}
+	assert.Equal(t, 4, calls)
+}
@@ -0,0 +1,60 @@
+package e2e
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/stretchr/testify/assert"
+	packer "github.com/zweihander/vk-execute-packer/v2"
+)
+
+func TestBulkCall(t *testing.T) {
+	vk := &fakeVK{response: "1"}
+	p := packer.MustNew(vk.Handler, packer.Tokens("token"), packer.MaxPackedRequests(10))
+
+	reqs := make([]packer.Request, 35)
+	for i := range reqs {
+		reqs[i] = packer.Request{Method: "users.get", Params: api.Params{"user_ids": i}}
+	}
+	results := p.BulkCall(context.Background(), reqs, packer.BulkParallelism(20))
+	assert.Len(t, results, 35)
+	for _, res := range results {
+		assert.Nil(t, res.Err)
+		assert.Equal(t, "1", string(res.Response.Response))
+	}
+	_, ok := reqs[0].Params[":context"]
+	assert.False(t, ok)
+
+	calls := 0
+	for _, exec := range vk.Executes() {
+		n := strings.Count(exec["code"].(string), "API.users.get")
+		assert.LessOrEqual(t, n, 10)
+		calls += n
+	}
+	assert.Equal(t, 35, calls)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results = p.BulkCall(ctx, reqs)
+	assert.ErrorIs(t, results[34].Err, context.Canceled)
+}
+
+func TestPackMany(t *testing.T) {
+	vk := &fakeVK{response: "1"}
+	p := packer.MustNew(vk.Handler, packer.Tokens("token"))
+
+	paramsList := make([]api.Params, 50)
+	for i := range paramsList {
+		paramsList[i] = api.Params{"user_ids": i}
+	}
+	responses, errs := p.PackMany("users.get", paramsList)
+	assert.Len(t, responses, 50)
+	assert.Len(t, errs, 50)
+	for i := range responses {
+		assert.Nil(t, errs[i])
+		assert.Equal(t, "1", string(responses[i].Response))
+	}
+	assert.Len(t, vk.Executes(), 2)
+}
@@ -0,0 +1,29 @@
+package e2e
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/stretchr/testify/assert"
+	packer "github.com/zweihander/vk-execute-packer/v2"
+)
+
+func TestCache(t *testing.T) {
+	vk := &fakeVK{response: `{"type":"user","object_id":1}`}
+	p := packer.MustNew(vk.Handler,
+		packer.Tokens("token"),
+		packer.MaxPackedRequests(1),
+		packer.Cache(time.Minute),
+	)
+
+	for _, token := range []string{"a", "b"} {
+		resp, err := p.Handler("utils.resolveScreenName", api.Params{"screen_name": "durov", "access_token": token})
+		assert.Nil(t, err)
+		assert.Equal(t, `{"type":"user","object_id":1}`, string(resp.Response))
+	}
+	_, err := p.Handler("utils.resolveScreenName", api.Params{"screen_name": "apiclub"})
+	assert.Nil(t, err)
+
+	assert.Len(t, vk.Executes(), 2)
+}
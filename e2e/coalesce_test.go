@@ -0,0 +1,130 @@
+package e2e
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/stretchr/testify/assert"
+	packer "github.com/zweihander/vk-execute-packer/v2"
+)
+
+func TestCoalesceUsersGet(t *testing.T) {
+	var code string
+	handler := func(method string, params ...api.Params) (api.Response, error) {
+		for _, p := range params {
+			if c, ok := p["code"].(string); ok {
+				code = c
+			}
+		}
+		return api.Response{Response: []byte(`[[{"id":1},{"id":2},{"id":3}]]`)}, nil
+	}
+	p := packer.MustNew(handler, packer.Tokens("token"), packer.Coalesce())
+
+	calls := map[string]string{
+		"1":   `[{"id":1}]`,
+		"2":   `[{"id":2}]`,
+		"3,1": `[{"id":3},{"id":1}]`,
+	}
+	var wg sync.WaitGroup
+	wg.Add(len(calls))
+	for ids, expected := range calls {
+		go func(ids, expected string) {
+			defer wg.Done()
+			resp, err := p.Handler("users.get", api.Params{"user_ids": ids, "fields": "city"})
+			assert.Nil(t, err)
+			assert.JSONEq(t, expected, string(resp.Response))
+		}(ids, expected)
+	}
+	time.Sleep(100 * time.Millisecond)
+	p.Send()
+	wg.Wait()
+
+	assert.Equal(t, 1, strings.Count(code, "API.users.get"))
+}
+
+func TestCoalesceVideoGet(t *testing.T) {
+	handler := func(method string, params ...api.Params) (api.Response, error) {
+		return api.Response{Response: []byte(`[{"count":2,"items":[{"owner_id":-1,"id":10},{"owner_id":-1,"id":11}]}]`)}, nil
+	}
+	p := packer.MustNew(handler, packer.Tokens("token"), packer.Coalesce())
+
+	calls := map[string]string{
+		"-1_10":     `{"count":1,"items":[{"owner_id":-1,"id":10}]}`,
+		"-1_11_key": `{"count":1,"items":[{"owner_id":-1,"id":11}]}`,
+	}
+	var wg sync.WaitGroup
+	wg.Add(len(calls))
+	for ids, expected := range calls {
+		go func(ids, expected string) {
+			defer wg.Done()
+			resp, err := p.Handler("video.get", api.Params{"videos": ids})
+			assert.Nil(t, err)
+			assert.JSONEq(t, expected, string(resp.Response))
+		}(ids, expected)
+	}
+	time.Sleep(100 * time.Millisecond)
+	p.Send()
+	wg.Wait()
+}
+
+// storageMerger merges storage.get requests by keys.
+type storageMerger struct{}
+
+func (storageMerger) CanMerge(a, b packer.Request) bool {
+	return a.Params["user_id"] == b.Params["user_id"]
+}
+
+func (storageMerger) Merge(reqs []packer.Request) (packer.Request, packer.Splitter) {
+	keys := make([]string, len(reqs))
+	for i, req := range reqs {
+		keys[i] = req.Params["key"].(string)
+	}
+	merged := packer.Request{
+		Method: "storage.get",
+		Params: api.Params{"keys": strings.Join(keys, ","), "user_id": reqs[0].Params["user_id"]},
+	}
+	return merged, func(body json.RawMessage) ([]json.RawMessage, error) {
+		var items []json.RawMessage
+		err := json.Unmarshal(body, &items)
+		return items, err
+	}
+}
+
+func TestCoalesceCustomMerger(t *testing.T) {
+	var code string
+	handler := func(method string, params ...api.Params) (api.Response, error) {
+		for _, p := range params {
+			if c, ok := p["code"].(string); ok {
+				code = c
+			}
+		}
+		return api.Response{Response: []byte(`[[{"key":"a"},{"key":"b"}]]`)}, nil
+	}
+	p := packer.MustNew(handler, packer.Tokens("token"), packer.CoalesceMethod("storage.get", storageMerger{}))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		resp, err := p.Handler("storage.get", api.Params{"key": "a", "user_id": 1})
+		assert.Nil(t, err)
+		assert.JSONEq(t, `{"key":"a"}`, string(resp.Response))
+	}()
+	time.Sleep(50 * time.Millisecond)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		resp, err := p.Handler("storage.get", api.Params{"key": "b", "user_id": 1})
+		assert.Nil(t, err)
+		assert.JSONEq(t, `{"key":"b"}`, string(resp.Response))
+	}()
+	time.Sleep(50 * time.Millisecond)
+	p.Send()
+	wg.Wait()
+
+	assert.Contains(t, code, `"keys":"a,b"`)
+}
@@ -0,0 +1,49 @@
+package e2e
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	jsoniter "github.com/json-iterator/go"
+	packer "github.com/zweihander/vk-execute-packer/v2"
+)
+
+func usersResponse(n int) string {
+	users := make([]string, n)
+	for i := range users {
+		users[i] = `{"id":` + strconv.Itoa(i) + `,"first_name":"Pavel","last_name":"Durov","can_access_closed":true,"is_closed":false,"photo_50":"https://vk.com/images/camera_50.png"}`
+	}
+	return "[" + strings.Join(users, ",") + "]"
+}
+
+func benchmarkDecoder(b *testing.B, opts ...packer.Option) {
+	opts = append(opts, packer.Tokens("token"))
+	p := packer.MustNew(fakeExecute(usersResponse(1000)), opts...)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var wg sync.WaitGroup
+		wg.Add(25)
+		for j := 0; j < 25; j++ {
+			go func() {
+				defer wg.Done()
+				if _, err := p.Handler("users.get", api.Params{"user_ids": "1"}); err != nil {
+					b.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+func BenchmarkDecoderStd(b *testing.B) {
+	benchmarkDecoder(b)
+}
+
+func BenchmarkDecoderJsoniter(b *testing.B) {
+	benchmarkDecoder(b, packer.JSONDecoder(jsoniter.ConfigCompatibleWithStandardLibrary))
+}
@@ -0,0 +1,155 @@
+package e2e
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/stretchr/testify/assert"
+	packer "github.com/zweihander/vk-execute-packer/v2"
+)
+
+func TestDeduplicate(t *testing.T) {
+	vk := &fakeVK{response: `{"type":"user","object_id":1}`}
+	p := packer.MustNew(vk.Handler, packer.Tokens("token"), packer.MaxPackedRequests(2), packer.Deduplicate())
+
+	var wg sync.WaitGroup
+	wg.Add(10)
+	for i := 0; i < 10; i++ {
+		go func() {
+			defer wg.Done()
+			resp, err := p.Handler("utils.resolveScreenName", api.Params{"screen_name": "durov"})
+			assert.Nil(t, err)
+			assert.Equal(t, `{"type":"user","object_id":1}`, string(resp.Response))
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for sent := false; !sent; {
+		select {
+		case <-done:
+			sent = true
+		case <-time.After(10 * time.Millisecond):
+			p.Send()
+		}
+	}
+
+	for _, exec := range vk.Executes() {
+		assert.Equal(t, 1, strings.Count(exec["code"].(string), "API."))
+	}
+}
+
+func TestDeduplicateSkipsWrites(t *testing.T) {
+	vk := &fakeVK{response: "1"}
+	p := packer.MustNew(vk.Handler, packer.Tokens("token"), packer.MaxPackedRequests(4), packer.Deduplicate())
+	defer p.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(4)
+	for _, params := range []api.Params{
+		{"peer_id": 1, "message": "hi"},
+		{"peer_id": 1, "message": "hi"},
+		{"user_ids": 1, "access_token": "user1"},
+		{"user_ids": 1, "access_token": "user2"},
+	} {
+		method := "messages.send"
+		if params["user_ids"] != nil {
+			method = "users.get"
+		}
+		go func(params api.Params) {
+			defer wg.Done()
+			_, err := p.Handler(method, params)
+			assert.Nil(t, err)
+		}(params)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for sent := false; !sent; {
+		select {
+		case <-done:
+			sent = true
+		case <-time.After(10 * time.Millisecond):
+			p.Send()
+		}
+	}
+
+	var calls int
+	for _, exec := range vk.Executes() {
+		if code, ok := exec["code"].(string); ok {
+			calls += strings.Count(code, "API.")
+		} else {
+			calls++
+		}
+	}
+	assert.Equal(t, 4, calls)
+}
+
+func TestDeduplicateInFlight(t *testing.T) {
+	release := make(chan struct{})
+	vk := &fakeVK{response: "1"}
+	var calls int32
+	p := packer.MustNew(func(method string, params ...api.Params) (api.Response, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return vk.Handler(method, params...)
+	}, packer.Tokens("token"), packer.MaxPackedRequests(1), packer.Deduplicate())
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	call := func() {
+		defer wg.Done()
+		resp, err := p.Handler("users.get", api.Params{"user_ids": 1})
+		assert.Nil(t, err)
+		assert.Equal(t, "1", string(resp.Response))
+	}
+	go call()
+	for atomic.LoadInt32(&calls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	go call()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestDeduplicateInFlightWrites(t *testing.T) {
+	release := make(chan struct{})
+	vk := &fakeVK{response: "1"}
+	var calls int32
+	p := packer.MustNew(func(method string, params ...api.Params) (api.Response, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return vk.Handler(method, params...)
+	}, packer.Tokens("token"), packer.MaxPackedRequests(1), packer.Deduplicate())
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	call := func() {
+		defer wg.Done()
+		_, err := p.Handler("wall.post", api.Params{"owner_id": 1, "message": "hi"})
+		assert.Nil(t, err)
+	}
+	go call()
+	for atomic.LoadInt32(&calls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	go call()
+	for atomic.LoadInt32(&calls) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
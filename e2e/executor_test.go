@@ -0,0 +1,63 @@
+package e2e
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	packer "github.com/zweihander/vk-execute-packer/v2"
+)
+
+// fakeExecutor answers every call inside execute code with "1"
+// and records tokens and methods.
+type fakeExecutor struct {
+	mtx     sync.Mutex
+	tokens  []string
+	methods []string
+}
+
+func (f *fakeExecutor) Execute(code, token string, params map[string]interface{}) (packer.RawResponse, error) {
+	f.mtx.Lock()
+	f.tokens = append(f.tokens, token)
+	f.methods = append(f.methods, "execute")
+	f.mtx.Unlock()
+
+	n := strings.Count(code, "API.")
+	return packer.RawResponse{Response: json.RawMessage("[" + strings.TrimSuffix(strings.Repeat("1,", n), ",") + "]")}, nil
+}
+
+func (f *fakeExecutor) Call(method, token string, params map[string]interface{}) (packer.RawResponse, error) {
+	f.mtx.Lock()
+	f.tokens = append(f.tokens, token)
+	f.methods = append(f.methods, method)
+	f.mtx.Unlock()
+	return packer.RawResponse{Response: json.RawMessage(`"direct"`)}, nil
+}
+
+func TestExecutor(t *testing.T) {
+	e := &fakeExecutor{}
+	p, err := packer.NewWithExecutor(e, packer.Tokens("token"), packer.MaxPackedRequests(2),
+		packer.Rules(packer.Ignore, "messages.send"))
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	for i := 0; i < 2; i++ {
+		go func(i int) {
+			defer wg.Done()
+			resp, err := p.Do("users.get", map[string]interface{}{"user_ids": i})
+			assert.Nil(t, err)
+			assert.Equal(t, "1", string(resp))
+		}(i)
+	}
+	wg.Wait()
+
+	resp, err := p.Do("messages.send", map[string]interface{}{"peer_id": 1, "access_token": "user"})
+	assert.Nil(t, err)
+	assert.Equal(t, `"direct"`, string(resp))
+
+	assert.Equal(t, []string{"execute", "messages.send"}, e.methods)
+	assert.Equal(t, []string{"token", "user"}, e.tokens)
+}
@@ -0,0 +1,91 @@
+package e2e
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	packer "github.com/zweihander/vk-execute-packer/v2"
+	"github.com/zweihander/vk-execute-packer/v2/packertest"
+)
+
+// fakeVK answers every call inside execute code with the same response
+// and records params of execute requests.
+type fakeVK struct {
+	response string
+
+	mtx      sync.Mutex
+	executes []api.Params
+}
+
+func (f *fakeVK) Handler(method string, params ...api.Params) (api.Response, error) {
+	merged := api.Params{}
+	for _, p := range params {
+		for k, v := range p {
+			merged[k] = v
+		}
+	}
+
+	f.mtx.Lock()
+	f.executes = append(f.executes, merged)
+	f.mtx.Unlock()
+
+	code, _ := merged["code"].(string)
+	n := strings.Count(code, "API.")
+	var sb strings.Builder
+	sb.WriteString("[")
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString(f.response)
+	}
+	sb.WriteString("]")
+
+	return api.Response{Response: json.RawMessage(sb.String())}, nil
+}
+
+func (f *fakeVK) Executes() []api.Params {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return append([]api.Params(nil), f.executes...)
+}
+
+// fakeExecute returns handler which answers every call
+// inside execute code with the same response.
+func fakeExecute(response string) packer.VKHandler {
+	return (&fakeVK{response: response}).Handler
+}
+
+// testVK returns the client of the real VK and its token if USER_TOKEN is set,
+// otherwise the client of packertest server which serves methods used by tests.
+func testVK(t *testing.T) (*api.VK, string) {
+	if token := os.Getenv("USER_TOKEN"); token != "" {
+		vk := api.NewVK(token)
+		vk.Limit = api.LimitUserToken
+		return vk, token
+	}
+
+	srv := packertest.NewServer().
+		Handle("utils.resolveScreenName", func(call packertest.Call) (interface{}, error) {
+			if call.String("screen_name") == "" {
+				return nil, &api.Error{
+					Code:    api.ErrParam,
+					Message: "One of the parameters specified was missing or invalid: screen_name is undefined",
+				}
+			}
+			return map[string]interface{}{"object_id": 1, "type": "user"}, nil
+		}).
+		Handle("users.get", func(call packertest.Call) (interface{}, error) {
+			id, _ := strconv.Atoi(call.String("user_ids"))
+			return []map[string]int{{"id": id}}, nil
+		}).
+		Respond("account.getInfo", map[string]interface{}{})
+	ts := packertest.NewHTTPServer(srv)
+	t.Cleanup(ts.Close)
+	return packertest.NewVK(ts, "token"), "token"
+}
@@ -0,0 +1,70 @@
+package e2e
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/stretchr/testify/assert"
+	packer "github.com/zweihander/vk-execute-packer/v2"
+	"github.com/zweihander/vk-execute-packer/v2/packertest"
+)
+
+func TestInjectFaults(t *testing.T) {
+	srv := packertest.NewServer().Respond("users.get", 1)
+	calls := func(faults packer.Faults, n int) (failed []error) {
+		p := packer.MustNew(srv.Handler, packer.Tokens("token"), packer.InjectFaults(faults))
+		errs := make([]error, n)
+		group := p.NewFlushGroup()
+		for i := 0; i < n; i++ {
+			i := i
+			group.Go(func() {
+				_, errs[i] = p.Handler("users.get", api.Params{"user_ids": i})
+			})
+		}
+		group.Wait()
+		for _, err := range errs {
+			if err != nil {
+				failed = append(failed, err)
+			}
+		}
+		return failed
+	}
+
+	failed := calls(packer.Faults{ExecuteErrorRate: 0.5, Seed: 1}, 20)
+	assert.Greater(t, len(failed), 0)
+	assert.Less(t, len(failed), 20)
+	for _, err := range failed {
+		assert.True(t, errors.Is(err, api.ErrUnknown), err)
+	}
+
+	failed = calls(packer.Faults{TooManyRate: 1}, 5)
+	assert.Len(t, failed, 5)
+	assert.True(t, errors.Is(failed[0], api.ErrTooMany))
+
+	failed = calls(packer.Faults{TransportRate: 1}, 5)
+	assert.Len(t, failed, 5)
+	assert.True(t, errors.Is(failed[0], packer.ErrInjectedFault))
+
+	start := time.Now()
+	assert.Empty(t, calls(packer.Faults{SlowRate: 1, SlowDelay: 50 * time.Millisecond}, 5))
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestInjectFaultsRetry(t *testing.T) {
+	var sent int32
+	handler := func(method string, params ...api.Params) (api.Response, error) {
+		atomic.AddInt32(&sent, 1)
+		return api.Response{Response: []byte(`[1]`)}, nil
+	}
+	p := packer.MustNew(handler, packer.Tokens("token"), packer.MaxPackedRequests(1),
+		packer.InjectFaults(packer.Faults{TransportRate: 0.5, Seed: 1}), packer.Retry(10, 0))
+
+	for i := 0; i < 10; i++ {
+		_, err := p.Handler("users.get", api.Params{"user_ids": i})
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, int32(10), atomic.LoadInt32(&sent))
+}
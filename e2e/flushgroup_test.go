@@ -0,0 +1,68 @@
+package e2e
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/stretchr/testify/assert"
+	packer "github.com/zweihander/vk-execute-packer/v2"
+)
+
+func TestFlushGroup(t *testing.T) {
+	vk := &fakeVK{response: "1"}
+	p := packer.MustNew(vk.Handler, packer.Tokens("token"))
+
+	group := p.NewFlushGroup()
+	for i := 0; i < 5; i++ {
+		i := i
+		group.Go(func() {
+			// the second call is made after the response to the first one
+			for j := 0; j < 2; j++ {
+				resp, err := p.Handler("users.get", api.Params{"user_ids": i*10 + j})
+				assert.Nil(t, err)
+				assert.Equal(t, "1", string(resp.Response))
+			}
+		})
+	}
+	group.Wait()
+
+	executes := vk.Executes()
+	// the first calls of all functions are packed together
+	assert.Equal(t, 5, strings.Count(executes[0]["code"].(string), "API.users.get"))
+	calls := 0
+	for _, exec := range executes {
+		calls += strings.Count(exec["code"].(string), "API.users.get")
+	}
+	assert.Equal(t, 10, calls)
+}
+
+func TestFlushMiddleware(t *testing.T) {
+	vk := &fakeVK{response: "1"}
+	p := packer.MustNew(vk.Handler, packer.Tokens("token"))
+
+	handler := p.FlushMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp, err := p.Handler("messages.send", api.Params{"peer_id": 1, "message": "hi", "random_id": 0})
+		assert.Nil(t, err)
+		w.Write(resp.Response)
+	}), true)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/callback", nil))
+	assert.Equal(t, "1", rec.Body.String())
+}
+
+func TestFlushMiddlewarePanic(t *testing.T) {
+	p := packer.MustNew(fakeExecute("1"), packer.Tokens("token"))
+	handler := p.FlushMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}), true)
+
+	// the panic reaches the goroutine of the request, where net/http recovers it
+	rec := httptest.NewRecorder()
+	assert.PanicsWithValue(t, "boom", func() {
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/callback", nil))
+	})
+}
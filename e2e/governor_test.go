@@ -0,0 +1,56 @@
+package e2e
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/stretchr/testify/assert"
+	packer "github.com/zweihander/vk-execute-packer/v2"
+)
+
+func TestGovernor(t *testing.T) {
+	var inFlight, maxInFlight int32
+	handler := func(method string, params ...api.Params) (api.Response, error) {
+		n := atomic.AddInt32(&inFlight, 1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&inFlight, -1)
+		return fakeExecute("1")(method, params...)
+	}
+
+	g := packer.NewGovernor(2, 0, 0)
+	packers := []*packer.Packer{
+		packer.MustNew(handler, packer.Tokens("token1"), packer.MaxPackedRequests(1), packer.Govern(g)),
+		packer.MustNew(handler, packer.Tokens("token2"), packer.MaxPackedRequests(1), packer.Govern(g)),
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := packers[i%2].Handler("users.get", api.Params{"user_ids": i})
+			assert.Nil(t, err)
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&maxInFlight))
+	assert.Equal(t, 0, g.InFlight())
+
+	// direct requests are governed too
+	g = packer.NewGovernor(0, 100, 1)
+	p := packer.MustNew(fakeExecute("1"), packer.Tokens("token"), packer.Rules(packer.Ignore, "users.get"), packer.Govern(g))
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		_, err := p.Handler("users.get", api.Params{"user_ids": i})
+		assert.Nil(t, err)
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 35*time.Millisecond)
+}
@@ -0,0 +1,49 @@
+package e2e
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/stretchr/testify/assert"
+	packer "github.com/zweihander/vk-execute-packer/v2"
+	"github.com/zweihander/vk-execute-packer/v2/packertest"
+)
+
+func TestHealthy(t *testing.T) {
+	srv := packertest.NewServer().Respond("users.get", 1)
+	p := packer.MustNew(srv.Handler, packer.Tokens("token1", "token2"), packer.MaxPackedRequests(1),
+		packer.Health(packer.HealthCheck{MaxPending: 1, MaxFailures: 3, TokenFailures: 2, MaxSilence: 50 * time.Millisecond}))
+	assert.Nil(t, p.Healthy())
+
+	for i := 0; i < 4; i++ {
+		srv.FailNext(&api.Error{Code: api.ErrAuth, Message: "User authorization failed"})
+	}
+	for i := 0; i < 4; i++ {
+		_, err := p.Handler("users.get", api.Params{"user_ids": i})
+		assert.ErrorIs(t, err, api.ErrAuth)
+	}
+	assert.EqualError(t, p.Healthy(), "packer: unhealthy: 4 execute requests failed in a row; all tokens failed with auth errors")
+
+	_, err := p.Handler("users.get", api.Params{"user_ids": 1})
+	assert.Nil(t, err)
+	assert.Nil(t, p.Healthy())
+
+	assert.Nil(t, p.Close())
+	assert.ErrorIs(t, p.Healthy(), packer.ErrShutdown)
+}
+
+func TestHealthyStuck(t *testing.T) {
+	p := packer.MustNew(fakeExecute("1"), packer.Tokens("token"),
+		packer.Health(packer.HealthCheck{MaxPending: 1, MaxSilence: 20 * time.Millisecond}))
+	defer p.Close()
+
+	for i := 0; i < 2; i++ {
+		go func(i int) {
+			_, _ = p.Handler("users.get", api.Params{"user_ids": i})
+		}(i)
+	}
+	assert.Eventually(t, func() bool { return p.Pending() == 2 }, time.Second, time.Millisecond)
+	time.Sleep(30 * time.Millisecond)
+	assert.EqualError(t, p.Healthy(), "packer: unhealthy: 2 pending requests (max 1); no successful execute for more than 20ms")
+}
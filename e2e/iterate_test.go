@@ -0,0 +1,68 @@
+//go:build go1.23
+
+package e2e
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/stretchr/testify/assert"
+	packer "github.com/zweihander/vk-execute-packer/v2"
+)
+
+func TestIterate(t *testing.T) {
+	handler := func(method string, params ...api.Params) (api.Response, error) {
+		offset, _ := params[0]["offset"].(int)
+		var body string
+		switch method {
+		case "groups.getMembers":
+			items := []int{}
+			for i := offset; i < offset+2 && i < 5; i++ {
+				items = append(items, i)
+			}
+			data, _ := json.Marshal(items)
+			body = fmt.Sprintf(`{"count":5,"items":%s}`, data)
+		case "newsfeed.get":
+			if params[0]["start_from"] == nil {
+				body = `{"items":[1,2],"next_from":"x"}`
+			} else {
+				body = `{"items":[3],"next_from":""}`
+			}
+		}
+		return api.Response{Response: json.RawMessage(body)}, nil
+	}
+	p := packer.MustNew(handler, packer.Tokens("token"), packer.Rules(packer.Ignore, "groups.getMembers", "newsfeed.get"))
+
+	var got []int
+	for item, err := range packer.Iterate[int](p, "groups.getMembers", api.Params{"group_id": 1}, "items") {
+		assert.Nil(t, err)
+		got = append(got, item)
+	}
+	assert.Equal(t, []int{0, 1, 2, 3, 4}, got)
+
+	got = nil
+	for item, err := range packer.Iterate[int](p, "newsfeed.get", api.Params{}, "items") {
+		assert.Nil(t, err)
+		got = append(got, item)
+		if item == 3 {
+			break
+		}
+	}
+	assert.Equal(t, []int{1, 2, 3}, got)
+}
+
+func TestIteratePacked(t *testing.T) {
+	vk := &fakeVK{response: `{"count":2,"items":[7]}`}
+	p := packer.MustNew(vk.Handler, packer.Tokens("token"))
+	defer p.Close()
+
+	var got []int
+	for item, err := range packer.Iterate[int](p, "groups.getMembers", api.Params{"group_id": 1}, "items") {
+		assert.Nil(t, err)
+		got = append(got, item)
+	}
+	assert.Equal(t, []int{7, 7}, got)
+	assert.Len(t, vk.Executes(), 2)
+}
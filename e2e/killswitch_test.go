@@ -0,0 +1,50 @@
+package e2e
+
+import (
+	"testing"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/stretchr/testify/assert"
+	packer "github.com/zweihander/vk-execute-packer/v2"
+)
+
+func TestDisable(t *testing.T) {
+	vk := &fakeVK{response: "1"}
+	p := packer.MustNew(vk.Handler, packer.Tokens("token"))
+	defer p.Close()
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := p.Handler("users.get", api.Params{"user_ids": 1})
+		result <- err
+	}()
+	waitPending()
+
+	// the pending batch is flushed and new requests are sent directly
+	p.Disable()
+	assert.False(t, p.Enabled())
+	assert.Nil(t, <-result)
+	_, err := p.Handler("users.get", api.Params{"user_ids": 2})
+	assert.Nil(t, err)
+	executes := vk.Executes()
+	assert.Len(t, executes, 2)
+	assert.Contains(t, executes[0], "code")
+	assert.Equal(t, api.Params{"user_ids": 2}, executes[1])
+
+	p.Enable()
+	go func() {
+		_, err := p.Handler("users.get", api.Params{"user_ids": 3})
+		result <- err
+	}()
+	waitPending()
+	p.Send()
+	assert.Nil(t, <-result)
+	assert.Contains(t, vk.Executes()[2], "code")
+}
+
+func TestDisabledByEnv(t *testing.T) {
+	t.Setenv("VKPACKER_DISABLED", "true")
+	p := packer.MustNew(fakeExecute("1"), packer.Tokens("token"))
+	defer p.Close()
+	assert.False(t, p.Enabled())
+}
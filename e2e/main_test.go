@@ -1,7 +1,6 @@
 package e2e
 
 import (
-	"os"
 	"sync"
 	"testing"
 
@@ -11,14 +10,8 @@ import (
 )
 
 func TestMain(t *testing.T) {
-	token := os.Getenv("USER_TOKEN")
-	if token == "" {
-		t.Skip("USER_TOKEN empty")
-	}
-
-	vk := api.NewVK(token)
-	vk.Limit = api.LimitUserToken
-	packer.Default(vk)
+	vk, _ := testVK(t)
+	assert.NoError(t, packer.Default(vk))
 	var wg sync.WaitGroup
 	wg.Add(3)
 	go func() {
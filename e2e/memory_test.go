@@ -0,0 +1,49 @@
+package e2e
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/stretchr/testify/assert"
+	packer "github.com/zweihander/vk-execute-packer/v2"
+)
+
+func TestMaxPendingBytes(t *testing.T) {
+	vk := &fakeVK{response: "1"}
+	p := packer.MustNew(vk.Handler, packer.Tokens("token"), packer.MaxPendingBytes(250))
+	defer p.Close()
+
+	message := strings.Repeat("a", 100)
+	var done int32
+	group := p.NewFlushGroup()
+	for i := 0; i < 6; i++ {
+		group.Go(func() {
+			_, err := p.Handler("messages.send", api.Params{"message": message})
+			assert.Nil(t, err)
+			atomic.AddInt32(&done, 1)
+		})
+	}
+	group.Wait()
+	assert.Equal(t, int32(6), done)
+	assert.Equal(t, 0, p.PendingBytes())
+	// at most two messages fit into the limit
+	executes := vk.Executes()
+	assert.GreaterOrEqual(t, len(executes), 3)
+	for _, exec := range executes {
+		assert.LessOrEqual(t, strings.Count(exec["code"].(string), "API.messages.send"), 2)
+	}
+
+	go func() {
+		_, _ = p.Handler("messages.send", api.Params{"message": strings.Repeat("b", 300)})
+	}()
+	assert.Eventually(t, func() bool { return p.PendingBytes() > 0 }, time.Second, time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := p.Handler("messages.send", api.Params{"message": message}.WithContext(ctx))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	p.Send()
+}
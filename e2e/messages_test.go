@@ -0,0 +1,121 @@
+package e2e
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/SevereCloud/vksdk/v2/object"
+	"github.com/stretchr/testify/assert"
+	packer "github.com/zweihander/vk-execute-packer/v2"
+)
+
+func TestFetchConversations(t *testing.T) {
+	p := packer.MustNew(fakeWall(450), packer.Tokens("token"))
+
+	n := 0
+	err := p.FetchConversations(nil, func(object.MessagesConversationWithMessage) error {
+		n++
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 450, n)
+}
+
+func TestFetchHistory(t *testing.T) {
+	items := strings.TrimSuffix(strings.Repeat(`{"id":1},`, 150), ",")
+	vk := &fakeVK{response: `{"count":300,"items":[` + items + `]}`}
+	p := packer.MustNew(vk.Handler, packer.Tokens("token"))
+
+	var mtx sync.Mutex
+	got := make(map[int]int)
+	err := p.FetchHistory([]int{1, 2, 3}, packer.HistoryOptions{
+		OnMessages: func(peerID int, msgs []object.MessagesMessage) error {
+			mtx.Lock()
+			got[peerID] += len(msgs)
+			mtx.Unlock()
+			return nil
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, map[int]int{1: 300, 2: 300, 3: 300}, got)
+
+	calls := 0
+	for _, exec := range vk.Executes() {
+		calls += strings.Count(exec["code"].(string), "API.messages.getHistory")
+	}
+	assert.Equal(t, 6, calls)
+	assert.Equal(t, 3, strings.Count(vk.Executes()[0]["code"].(string), "API.messages.getHistory"))
+}
+
+func TestFetchLikes(t *testing.T) {
+	vk := &fakeVK{response: `{"count":1500,"items":[` + strings.TrimSuffix(strings.Repeat("1,", 1000), ",") + `]}`}
+	p := packer.MustNew(vk.Handler, packer.Tokens("token"))
+
+	posts := []packer.Post{{OwnerID: -1, ID: 1}, {OwnerID: -1, ID: 2}}
+	var mtx sync.Mutex
+	got := make(map[packer.Post]int)
+	err := p.FetchLikes(posts, packer.PostsOptions{Limit: 1200}, func(post packer.Post, ids []int) error {
+		mtx.Lock()
+		got[post] += len(ids)
+		mtx.Unlock()
+		return nil
+	})
+	assert.Nil(t, err)
+	// the fake ignores count, so the second page is full as well
+	assert.Equal(t, map[packer.Post]int{posts[0]: 2000, posts[1]: 2000}, got)
+	assert.Contains(t, vk.Executes()[1]["code"], `"count":200`)
+
+	p = packer.MustNew(fakeExecute(`{"count":1,"items":[{"id":1}]}`), packer.Tokens("token"))
+	stop := errors.New("stop")
+	err = p.FetchComments(posts, packer.PostsOptions{}, func(packer.Post, []object.WallWallComment) error {
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+}
+
+func TestFetchHistoryCheckpointer(t *testing.T) {
+	vk := &fakeVK{response: `{"count":1,"items":[{"id":1}]}`}
+	p := packer.MustNew(vk.Handler, packer.Tokens("token"))
+	cp := packer.NewFileCheckpointer(filepath.Join(t.TempDir(), "history.json"))
+	assert.Nil(t, cp.Save(packer.JobState{Done: []string{"1"}}))
+
+	var mtx sync.Mutex
+	var peers []int
+	err := p.FetchHistory([]int{1, 2}, packer.HistoryOptions{
+		Checkpointer: cp,
+		OnMessages: func(peerID int, msgs []object.MessagesMessage) error {
+			mtx.Lock()
+			peers = append(peers, peerID)
+			mtx.Unlock()
+			return nil
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []int{2}, peers)
+
+	state, _, err := cp.Load()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, state.Next)
+	assert.Empty(t, state.Done)
+
+	peers = nil
+	assert.Nil(t, cp.Save(packer.JobState{Next: 1, Done: []string{"3"}}))
+	err = p.FetchHistory([]int{1, 2, 3, 4}, packer.HistoryOptions{
+		Checkpointer: cp,
+		OnMessages: func(peerID int, msgs []object.MessagesMessage) error {
+			mtx.Lock()
+			peers = append(peers, peerID)
+			mtx.Unlock()
+			return nil
+		},
+	})
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []int{2, 4}, peers)
+	state, _, err = cp.Load()
+	assert.Nil(t, err)
+	assert.Equal(t, 4, state.Next)
+	assert.Empty(t, state.Done)
+}
@@ -0,0 +1,157 @@
+package e2e
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/stretchr/testify/assert"
+	packer "github.com/zweihander/vk-execute-packer/v2"
+)
+
+func TestUse(t *testing.T) {
+	vk := &fakeVK{response: "1"}
+
+	var calls []string
+	tag := func(name string) func(packer.RequestFunc) packer.RequestFunc {
+		return func(next packer.RequestFunc) packer.RequestFunc {
+			return func(method string, params ...api.Params) (api.Response, error) {
+				calls = append(calls, name+":"+method)
+				return next(method, append(params, api.Params{"lang": "en"})...)
+			}
+		}
+	}
+
+	p := packer.MustNew(vk.Handler,
+		packer.Tokens("token"),
+		packer.MaxPackedRequests(1),
+		packer.Rules(packer.Ignore, "status.get"),
+		packer.Use(tag("a"), tag("b")),
+	)
+
+	_, err := p.Handler("users.get", api.Params{"user_ids": 1})
+	assert.Nil(t, err)
+	_, err = p.Handler("status.get")
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{"a:users.get", "b:users.get", "a:status.get", "b:status.get"}, calls)
+	executes := vk.Executes()
+	assert.Equal(t, "en", executes[0]["lang"])
+	assert.Equal(t, "en", executes[1]["lang"])
+}
+
+func TestUseResponse(t *testing.T) {
+	vk := &fakeVK{response: "false"}
+	errRedacted := errors.New("redacted")
+
+	var methods []string
+	p := packer.MustNew(vk.Handler,
+		packer.Tokens("token"),
+		packer.MaxPackedRequests(1),
+		packer.UseResponse(
+			func(method string, params []api.Params, resp api.Response, err error) (api.Response, error) {
+				methods = append(methods, method)
+				return resp, err
+			},
+			func(method string, params []api.Params, resp api.Response, err error) (api.Response, error) {
+				return api.Response{Response: []byte("1")}, errRedacted
+			},
+		),
+	)
+
+	resp, err := p.Handler("users.get", api.Params{"user_ids": 1})
+	assert.Equal(t, errRedacted, err)
+	assert.Equal(t, "1", string(resp.Response))
+	assert.Equal(t, []string{"users.get"}, methods)
+}
+
+func TestDecorateErrors(t *testing.T) {
+	errDown := errors.New("down")
+	handler := func(method string, params ...api.Params) (api.Response, error) {
+		return api.Response{}, errDown
+	}
+	p := packer.MustNew(handler, packer.Tokens("token"), packer.MaxPackedRequests(1),
+		packer.DecorateErrors(func(method string, err error) error {
+			return fmt.Errorf("billing: vk %s: %w", method, err)
+		}))
+
+	_, err := p.Handler("users.get", api.Params{"user_ids": 1})
+	assert.ErrorIs(t, err, errDown)
+	var batchErr *packer.BatchError
+	assert.ErrorAs(t, err, &batchErr)
+	assert.Equal(t, "billing: vk users.get: packer: batch 1: down", err.Error())
+
+	_, err = p.Execute("return 1;")
+	assert.EqualError(t, err, "billing: vk execute: down")
+
+	_, err = p.Handler("users.get", api.Params{"user_ids": 1, "v": 1}.WithContext(packer.NoBatch(context.Background())))
+	assert.EqualError(t, err, "billing: vk users.get: down")
+}
+
+func TestChain(t *testing.T) {
+	var calls []string
+	wrap := func(name string) func(packer.VKHandler) packer.VKHandler {
+		return func(next packer.VKHandler) packer.VKHandler {
+			return func(method string, params ...api.Params) (api.Response, error) {
+				calls = append(calls, name+":"+method)
+				return next(method, params...)
+			}
+		}
+	}
+
+	p := packer.MustNew(packer.Chain(wrap("inner"))(fakeExecute("1")),
+		packer.Tokens("token"), packer.MaxPackedRequests(1))
+	handler := packer.Chain(wrap("a"), wrap("b"))(p.Handler)
+
+	_, err := handler("users.get", api.Params{"user_ids": 1})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a:users.get", "b:users.get", "inner:execute"}, calls)
+}
+
+func TestContextHandler(t *testing.T) {
+	type ctxKey struct{}
+	vk := &fakeVK{response: "1"}
+
+	var contexts []context.Context
+	handler := func(ctx context.Context, method string, params ...api.Params) (api.Response, error) {
+		contexts = append(contexts, ctx)
+		return vk.Handler(method, params...)
+	}
+	p := packer.MustNew(packer.FromContextHandler(handler), packer.Tokens("token"), packer.MaxPackedRequests(1),
+		packer.Rules(packer.Ignore, "messages.send"))
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "direct")
+	_, err := p.HandlerContext(ctx, "messages.send", api.Params{"peer_id": 1})
+	assert.Nil(t, err)
+	resp, err := p.HandlerContext(ctx, "users.get", api.Params{"user_ids": 1})
+	assert.Nil(t, err)
+	assert.Equal(t, "1", string(resp.Response))
+
+	assert.Len(t, contexts, 2)
+	assert.Equal(t, "direct", contexts[0].Value(ctxKey{}))
+	assert.Nil(t, contexts[1].Value(ctxKey{}))
+	assert.NotContains(t, vk.Executes()[1]["code"], "context")
+}
+
+func TestWrap(t *testing.T) {
+	fake := &fakeVK{response: "1"}
+	vk := api.NewVK("token")
+	vk.Handler = fake.Handler
+
+	p, restore, err := packer.Wrap(vk, packer.Tokens("token"), packer.FlushInterval(10*time.Millisecond))
+	assert.NoError(t, err)
+	assert.NotNil(t, p)
+
+	_, err = vk.Request("users.get", api.Params{"user_ids": 1})
+	assert.Nil(t, err)
+	assert.Contains(t, fake.Executes()[0]["code"], "API.users.get")
+
+	restore()
+	restore()
+	_, err = vk.Request("users.get", api.Params{"user_ids": 1})
+	assert.Nil(t, err)
+	assert.Nil(t, fake.Executes()[1]["code"])
+}
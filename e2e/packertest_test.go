@@ -0,0 +1,216 @@
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/stretchr/testify/assert"
+	packer "github.com/zweihander/vk-execute-packer/v2"
+	"github.com/zweihander/vk-execute-packer/v2/packertest"
+)
+
+func TestServer(t *testing.T) {
+	srv := packertest.NewServer().
+		Handle("users.get", func(call packertest.Call) (interface{}, error) {
+			return []map[string]interface{}{{"id": call.Params["user_ids"]}}, nil
+		}).
+		Fail("wall.post", api.ErrAccess, "Access denied")
+	p := packer.MustNew(srv.Handler, packer.Tokens("token"))
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	for _, id := range []int{1, 2} {
+		go func(id int) {
+			defer wg.Done()
+			resp, err := p.Handler("users.get", api.Params{"user_ids": id})
+			assert.Nil(t, err)
+			var users []struct{ ID int }
+			assert.Nil(t, json.Unmarshal(resp.Response, &users))
+			assert.Equal(t, id, users[0].ID)
+		}(id)
+	}
+	go func() {
+		defer wg.Done()
+		_, err := p.Handler("wall.post", api.Params{"message": "hi \"there\""})
+		assert.True(t, errors.Is(err, api.ErrAccess))
+	}()
+	for len(srv.Calls()) < 3 {
+		p.Send()
+	}
+	wg.Wait()
+
+	calls := srv.Calls()
+	assert.Len(t, calls, 3)
+	for _, batch := range srv.Batches() {
+		assert.Equal(t, "token", batch.Params["access_token"])
+		for _, call := range batch.Calls {
+			if call.Method == "wall.post" {
+				assert.Equal(t, `hi "there"`, call.String("message"))
+			}
+		}
+	}
+
+	srv.Reset()
+	srv.Respond("wall.get", map[string]interface{}{"count": 2, "items": []map[string]int{{"id": 5}, {"id": 6}}})
+	result, err := p.Pipeline().
+		Call("wall.get", api.Params{"owner_id": 1}).
+		Call("users.get", api.Params{"user_ids": packer.Step(0, "items@.id")}).
+		Capture("ids", packer.Step(0, "items@.id")).
+		Run()
+	assert.Nil(t, err)
+	assert.JSONEq(t, `[5,6]`, string(result.Named("ids")))
+	assert.Equal(t, "5,6", srv.Calls()[1].String("user_ids"))
+
+	srv.FailNext(errors.New("network"))
+	_, err = p.Pipeline().Call("wall.get", api.Params{}).Run()
+	assert.NotNil(t, err)
+}
+
+type recordingT struct {
+	mtx    sync.Mutex
+	errors []string
+}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func (t *recordingT) Helper() {}
+
+func TestMock(t *testing.T) {
+	rt := &recordingT{}
+	m := packertest.NewMock(rt, packertest.Strict)
+	m.ExpectMethod("users.get").WithParams(api.Params{"user_ids": []int{1, 2}}).Return([]int{1, 2})
+	m.ExpectMethod("wall.post").ReturnError(api.ErrAccess)
+	m.ExpectMethod("groups.get").Times(2)
+	p := packer.MustNew(m.Handler, packer.Tokens("token"))
+
+	group := p.NewFlushGroup()
+	group.Go(func() {
+		resp, err := p.Handler("users.get", api.Params{"user_ids": []int{1, 2}})
+		assert.Nil(t, err)
+		assert.JSONEq(t, `[1,2]`, string(resp.Response))
+	})
+	group.Go(func() {
+		_, err := p.Handler("wall.post", api.Params{"message": "hi"})
+		assert.True(t, errors.Is(err, api.ErrAccess))
+	})
+	group.Go(func() {
+		_, err := p.Handler("users.get", api.Params{"user_ids": 3})
+		assert.True(t, errors.Is(err, api.ErrMethod))
+	})
+	group.Go(func() {
+		_, err := p.Handler("groups.get", api.Params{})
+		assert.Nil(t, err)
+	})
+	group.Wait()
+	m.Verify()
+
+	assert.Len(t, m.Batches(), 1)
+	assert.Len(t, m.Batches()[0].Calls, 4)
+	assert.Len(t, rt.errors, 2)
+	assert.Contains(t, rt.errors[0], "unexpected call users.get")
+	assert.Equal(t, "packertest: expected 2 calls of groups.get, got 1", rt.errors[1])
+
+	lenient := packertest.NewMock(t, packertest.Lenient)
+	p = packer.MustNew(lenient.Handler, packer.Tokens("token"))
+	group = p.NewFlushGroup()
+	group.Go(func() {
+		resp, err := p.Handler("utils.getServerTime", api.Params{})
+		assert.Nil(t, err)
+		assert.Equal(t, "null", string(resp.Response))
+	})
+	group.Wait()
+}
+
+func TestRecordReplay(t *testing.T) {
+	dir := t.TempDir()
+	srv := packertest.NewServer().
+		Handle("users.get", func(call packertest.Call) (interface{}, error) {
+			return []map[string]interface{}{{"id": call.Params["user_ids"]}}, nil
+		}).
+		Fail("wall.post", api.ErrAccess, "Access denied")
+	rec, err := packertest.NewRecorder(srv.Handler, dir)
+	assert.Nil(t, err)
+
+	run := func(handler packer.VKHandler) []string {
+		p := packer.MustNew(handler, packer.Tokens("secret"))
+		results := p.BulkCall(context.Background(), []packer.Request{
+			{Method: "users.get", Params: api.Params{"user_ids": 1, "fields": "photo"}},
+			{Method: "wall.post", Params: api.Params{"message": "hi"}},
+		})
+		var out []string
+		for _, res := range results {
+			out = append(out, fmt.Sprint(string(res.Response.Response), res.Err))
+		}
+		return out
+	}
+
+	recorded := run(rec.Handler)
+	data, err := os.ReadFile(filepath.Join(dir, "000001.json"))
+	assert.Nil(t, err)
+	assert.NotContains(t, string(data), "secret")
+	assert.Contains(t, string(data), `"token": "token1"`)
+
+	replay, err := packertest.NewReplayer(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, recorded, run(replay.Handler))
+	assert.Empty(t, replay.Unused())
+
+	_, err = replay.Handler("users.get", api.Params{"user_ids": 1})
+	assert.NotNil(t, err)
+}
+
+func TestHTTPServer(t *testing.T) {
+	srv := packertest.NewServer().Respond("users.get", []int{1})
+	ts := packertest.NewHTTPServer(srv)
+	defer ts.Close()
+	vk := packertest.NewVK(ts, "token")
+	p := packer.MustNew(vk.Handler, packer.Tokens("token"), packer.MaxPackedRequests(1), packer.Retry(1, 0))
+
+	srv.InjectError(api.ErrRuntime, 1)
+	resp, err := p.Handler("users.get", api.Params{"user_ids": 1})
+	assert.Nil(t, err)
+	assert.JSONEq(t, `[1]`, string(resp.Response))
+
+	srv.InjectError(api.ErrTooMany, 2)
+	_, err = p.Handler("users.get", api.Params{"user_ids": 1})
+	assert.True(t, errors.Is(err, api.ErrTooMany))
+
+	_, err = p.Handler("wall.get", api.Params{})
+	assert.True(t, errors.Is(err, api.ErrMethod))
+	assert.Len(t, srv.Batches(), 2)
+}
+
+func TestSimulate(t *testing.T) {
+	sim := packertest.Simulation{
+		Latency:   packertest.Uniform(5*time.Millisecond, 10*time.Millisecond),
+		ErrorRate: 0.1,
+		Seed:      1,
+	}
+	load := packertest.Load{Method: "users.get", Params: api.Params{"user_ids": 1}, Calls: 500, Concurrency: 100}
+
+	report := packertest.Simulate(sim, load, packer.FlushInterval(20*time.Millisecond))
+	assert.Equal(t, 500, report.Calls)
+	assert.Greater(t, report.Failed, 10)
+	assert.Less(t, report.Failed, 100)
+	assert.LessOrEqual(t, report.Requests, 500/25*2)
+	assert.GreaterOrEqual(t, report.P99, report.P50)
+	assert.GreaterOrEqual(t, report.P50, 5*time.Millisecond)
+
+	sim.ErrorRate, sim.RateLimit = 0, 1
+	report = packertest.Simulate(sim, load, packer.FlushInterval(time.Millisecond), packer.MaxPackedRequests(5))
+	assert.Greater(t, report.Limited, 0)
+	assert.Equal(t, report.Failed > 0, report.Limited > 0)
+	t.Log(report)
+}
@@ -0,0 +1,227 @@
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/SevereCloud/vksdk/v2/object"
+	"github.com/stretchr/testify/assert"
+	packer "github.com/zweihander/vk-execute-packer/v2"
+)
+
+func TestFetchPages(t *testing.T) {
+	token := os.Getenv("USER_TOKEN")
+	if token == "" {
+		t.Skip("USER_TOKEN empty")
+	}
+
+	vk := api.NewVK(token)
+	p := packer.MustNew(vk.Handler, packer.Tokens(token))
+	page, err := p.FetchPages("wall.get", api.Params{"owner_id": 1, "count": 10}, 3)
+	assert.Nil(t, err)
+	assert.NotZero(t, page.Count)
+	assert.LessOrEqual(t, len(page.Items), 30)
+	assert.Equal(t, 30, page.Offset)
+}
+
+// fakePages answers FetchPages executes with pages of total items
+// formatted from their indexes starting with 1.
+func fakePages(total int, format string) packer.VKHandler {
+	re := regexp.MustCompile(`var o=(\d+);.*while\(i<(\d+)\).*o=o\+(\d+);`)
+	return func(method string, params ...api.Params) (api.Response, error) {
+		m := re.FindStringSubmatch(params[len(params)-2]["code"].(string))
+		offset, _ := strconv.Atoi(m[1])
+		pages, _ := strconv.Atoi(m[2])
+		size, _ := strconv.Atoi(m[3])
+
+		items := []string{}
+		for i := offset; i < total && i < offset+pages*size; i++ {
+			items = append(items, fmt.Sprintf(format, i+1))
+		}
+		next := offset + pages*size
+		body := fmt.Sprintf(`{"count":%d,"items":[%s],"offset":%d}`, total, strings.Join(items, ","), next)
+		return api.Response{Response: json.RawMessage(body)}, nil
+	}
+}
+
+// fakeWall answers FetchPages executes with posts of the wall.
+func fakeWall(total int) packer.VKHandler {
+	return fakePages(total, `{"id":%d}`)
+}
+
+func TestFetchWall(t *testing.T) {
+	p := packer.MustNew(fakeWall(450), packer.Tokens("token"))
+
+	var ids, checkpoints []int
+	offset, err := p.FetchWall(1, packer.WallOptions{
+		Offset: 50,
+		Pages:  2,
+		OnPost: func(post object.WallWallpost) error {
+			ids = append(ids, post.ID)
+			return nil
+		},
+		Checkpoint: func(offset int) { checkpoints = append(checkpoints, offset) },
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 450, offset)
+	assert.Len(t, ids, 400)
+	assert.Equal(t, 51, ids[0])
+	assert.Equal(t, []int{250, 450}, checkpoints)
+
+	stop := errors.New("stop")
+	offset, err = p.FetchWall(1, packer.WallOptions{
+		OnPost: func(post object.WallWallpost) error {
+			if post.ID == 11 {
+				return stop
+			}
+			return nil
+		},
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 10, offset)
+}
+
+func TestGetAll(t *testing.T) {
+	p := packer.MustNew(fakePages(12345, "%d"), packer.Tokens("token"))
+
+	friends, err := p.GetAllFriends(1)
+	assert.Nil(t, err)
+	assert.Len(t, friends, 12345)
+	assert.Equal(t, 12345, friends[len(friends)-1])
+
+	followers, err := p.GetAllFollowers(1)
+	assert.Nil(t, err)
+	assert.Len(t, followers, 12345)
+}
+
+func TestEnumerateMembers(t *testing.T) {
+	var mtx sync.Mutex
+	tokens := make(map[string]int)
+	pages := fakePages(150000, "%d")
+	handler := func(method string, params ...api.Params) (api.Response, error) {
+		mtx.Lock()
+		tokens[params[len(params)-1]["access_token"].(string)]++
+		mtx.Unlock()
+		return pages(method, params...)
+	}
+	p := packer.MustNew(handler, packer.Tokens("token1", "token2"), packer.TokenRateLimit(20, 1))
+
+	seen := make(map[int]bool)
+	var last packer.Progress
+	err := p.EnumerateMembers(context.Background(), 1, packer.MembersOptions{
+		OnProgress: func(pr packer.Progress) { last = pr },
+	}, func(ids []int) error {
+		for _, id := range ids {
+			seen[id] = true
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Len(t, seen, 150000)
+	assert.Equal(t, 150000, last.Done)
+	assert.Equal(t, 150000, last.Total)
+	assert.Zero(t, last.ETA)
+	assert.Len(t, tokens, 2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err = p.EnumerateMembers(ctx, 1, packer.MembersOptions{}, func(ids []int) error {
+		cancel()
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestFetchWallCheckpointer(t *testing.T) {
+	p := packer.MustNew(fakeWall(450), packer.Tokens("token"))
+	cp := packer.NewFileCheckpointer(filepath.Join(t.TempDir(), "wall.json"))
+
+	crash := errors.New("crash")
+	_, err := p.FetchWall(1, packer.WallOptions{
+		Pages:        1,
+		Checkpointer: cp,
+		OnPost: func(post object.WallWallpost) error {
+			if post.ID == 150 {
+				return crash
+			}
+			return nil
+		},
+	})
+	assert.ErrorIs(t, err, crash)
+
+	var ids []int
+	offset, err := p.FetchWall(1, packer.WallOptions{
+		Checkpointer: cp,
+		OnPost: func(post object.WallWallpost) error {
+			ids = append(ids, post.ID)
+			return nil
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 450, offset)
+	assert.Equal(t, 101, ids[0])
+	assert.Len(t, ids, 350)
+
+	state, ok, err := cp.Load()
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 450, state.Offset)
+
+	// the saved offset is used even if it is zero
+	assert.Nil(t, cp.Save(packer.JobState{}))
+	ids = nil
+	_, err = p.FetchWall(1, packer.WallOptions{
+		Offset:       400,
+		Checkpointer: cp,
+		OnPost: func(post object.WallWallpost) error {
+			ids = append(ids, post.ID)
+			return nil
+		},
+	})
+	assert.Nil(t, err)
+	assert.Len(t, ids, 450)
+}
+
+func TestJob(t *testing.T) {
+	p := packer.MustNew(fakePages(150000, "%d"), packer.Tokens("token1", "token2"))
+
+	start := func() *packer.Job {
+		return packer.StartJob(func(j *packer.Job) error {
+			return p.EnumerateMembers(j.Context(), 1, packer.MembersOptions{
+				OnProgress: func(pr packer.Progress) {
+					if pr.Done == 25000 {
+						j.Pause()
+					}
+					j.Report(pr)
+				},
+			}, func(ids []int) error { return nil })
+		})
+	}
+
+	job := start()
+	assert.Eventually(t, func() bool { return job.Progress().Done == 25000 }, time.Second, time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	pr := job.Progress()
+	assert.Equal(t, 25000, pr.Done)
+	assert.Equal(t, 150000, pr.Total)
+	assert.NotZero(t, pr.ETA)
+
+	job.Resume()
+	assert.Nil(t, job.Wait())
+	assert.Equal(t, 150000, job.Progress().Done)
+
+	job = start()
+	assert.Eventually(t, func() bool { return job.Progress().Done == 25000 }, time.Second, time.Millisecond)
+	job.Cancel()
+	assert.ErrorIs(t, job.Wait(), context.Canceled)
+}
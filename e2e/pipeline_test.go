@@ -0,0 +1,50 @@
+package e2e
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/stretchr/testify/assert"
+	packer "github.com/zweihander/vk-execute-packer/v2"
+)
+
+func TestPipeline(t *testing.T) {
+	vk, token := testVK(t)
+	p := packer.MustNew(vk.Handler, packer.Tokens(token))
+	results, err := p.Pipeline().
+		Call("utils.resolveScreenName", api.Params{"screen_name": "durov"}).
+		Call("users.get", api.Params{"user_ids": packer.Step(0, "object_id")}).
+		Exec()
+	assert.Nil(t, err)
+	assert.Len(t, results, 2)
+
+	var users []struct {
+		ID int `json:"id"`
+	}
+	assert.Nil(t, json.Unmarshal(results[1].Response, &users))
+	assert.Len(t, users, 1)
+	assert.Equal(t, 1, users[0].ID)
+}
+
+func TestPipelineCapture(t *testing.T) {
+	var code string
+	handler := func(method string, params ...api.Params) (api.Response, error) {
+		for _, p := range params {
+			if c, ok := p["code"].(string); ok {
+				code = c
+			}
+		}
+		return api.Response{Response: []byte(`[{"count":1,"items":[{"id":5}]},{"ids":[5]}]`)}, nil
+	}
+
+	p := packer.MustNew(handler, packer.Tokens("token"))
+	result, err := p.Pipeline().
+		Call("wall.get", api.Params{"owner_id": 1}).
+		Capture("ids", packer.Step(0, "items@.id")).
+		Run()
+	assert.Nil(t, err)
+	assert.Contains(t, code, `{"ids":s0.items@.id}`)
+	assert.Len(t, result.Steps, 1)
+	assert.JSONEq(t, `[5]`, string(result.Named("ids")))
+}
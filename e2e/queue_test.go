@@ -0,0 +1,148 @@
+package e2e
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/stretchr/testify/assert"
+	packer "github.com/zweihander/vk-execute-packer/v2"
+)
+
+func TestPersistentQueue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.jsonl")
+
+	q, err := packer.NewFileQueue(path)
+	assert.Nil(t, err)
+	down := func(string, ...api.Params) (api.Response, error) {
+		return api.Response{}, &net.OpError{Op: "dial", Err: errors.New("network is down")}
+	}
+	p := packer.MustNew(down, packer.Tokens("token"), packer.MaxPackedRequests(1), packer.PersistentQueue(q))
+	_, err = p.Handler("messages.send", api.Params{"peer_id": 1, "message": "hi", "access_token": "user-token"})
+	assert.Error(t, err)
+	data, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(data), "user-token")
+
+	// restart
+	q, err = packer.NewFileQueue(path)
+	assert.Nil(t, err)
+	pending, err := q.Pending()
+	assert.Nil(t, err)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, "messages.send", pending[0].Request.Method)
+	assert.Equal(t, "1", pending[0].Request.Params["peer_id"])
+
+	vk := &fakeVK{response: "1"}
+	p = packer.MustNew(vk.Handler, packer.Tokens("token"), packer.PersistentQueue(q))
+	replayed := make(chan error, 1)
+	assert.Nil(t, p.Replay(func(req packer.Request, resp api.Response, err error) {
+		replayed <- err
+	}))
+	p.Send()
+	assert.Nil(t, <-replayed)
+
+	pending, err = q.Pending()
+	assert.Nil(t, err)
+	assert.Empty(t, pending)
+	assert.Contains(t, vk.Executes()[0]["code"], `"message":"hi"`)
+}
+
+func TestPersistentQueueExecuted(t *testing.T) {
+	q, err := packer.NewFileQueue(filepath.Join(t.TempDir(), "queue.jsonl"))
+	assert.Nil(t, err)
+	responses := make(chan api.Response, 2)
+	responses <- api.Response{Response: json.RawMessage("[]")}
+	handler := func(string, ...api.Params) (api.Response, error) {
+		select {
+		case resp := <-responses:
+			return resp, nil
+		default:
+			return api.Response{}, errors.New("read: connection reset")
+		}
+	}
+	p := packer.MustNew(handler, packer.Tokens("token"), packer.MaxPackedRequests(1), packer.PersistentQueue(q))
+	defer p.Close()
+
+	// the responses are missing or lost, the message may have been sent
+	_, err = p.Handler("messages.send", api.Params{"peer_id": 1, "message": "hi"})
+	assert.Error(t, err)
+	_, err = p.Handler("messages.send", api.Params{"peer_id": 2, "message": "hi"})
+	assert.Error(t, err)
+	pending, err := q.Pending()
+	assert.Nil(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestFileQueueCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.jsonl")
+	q, err := packer.NewFileQueue(path)
+	assert.Nil(t, err)
+
+	req := packer.Request{Method: "messages.send", Params: api.Params{"peer_id": "1"}}
+	assert.Nil(t, q.Add(packer.QueuedRequest{ID: "pending", Request: req}))
+	for i := 0; i < 1000; i++ {
+		id := strconv.Itoa(i)
+		assert.Nil(t, q.Add(packer.QueuedRequest{ID: id, Request: req}))
+		assert.Nil(t, q.Done(id))
+	}
+
+	data, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, strings.Count(string(data), "\n"))
+	pending, err := q.Pending()
+	assert.Nil(t, err)
+	if assert.Len(t, pending, 1) {
+		assert.Equal(t, "pending", pending[0].ID)
+	}
+	assert.Nil(t, q.Add(packer.QueuedRequest{ID: "next", Request: req}))
+	pending, err = q.Pending()
+	assert.Nil(t, err)
+	assert.Len(t, pending, 2)
+}
+
+func TestWriteAheadLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+
+	j, err := packer.NewFileJournal(path)
+	assert.Nil(t, err)
+	fail := true
+	handler := func(method string, params ...api.Params) (api.Response, error) {
+		if fail {
+			return api.Response{}, errors.New("timeout")
+		}
+		return fakeExecute("1")(method, params...)
+	}
+	p := packer.MustNew(handler, packer.Tokens("token"), packer.MaxPackedRequests(1), packer.WriteAheadLog(j))
+	_, err = p.Handler("messages.send", api.Params{"peer_id": 1, "access_token": "user-token"})
+	assert.Error(t, err)
+	data, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(data), "user-token")
+	fail = false
+	_, err = p.Handler("messages.send", api.Params{"peer_id": 2})
+	assert.Nil(t, err)
+
+	// restart
+	j, err = packer.NewFileJournal(path)
+	assert.Nil(t, err)
+	p = packer.MustNew(handler, packer.Tokens("token"), packer.WriteAheadLog(j))
+
+	var unknown []packer.JournalBatch
+	assert.Nil(t, p.Reconcile(func(b packer.JournalBatch) error {
+		unknown = append(unknown, b)
+		return nil
+	}))
+	assert.Len(t, unknown, 1)
+	assert.Equal(t, "1", unknown[0].Requests[0].Params["peer_id"])
+
+	unfinished, err := j.Unfinished()
+	assert.Nil(t, err)
+	assert.Empty(t, unfinished)
+}
@@ -0,0 +1,130 @@
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/stretchr/testify/assert"
+	packer "github.com/zweihander/vk-execute-packer/v2"
+)
+
+// fakeRedis implements packer.RedisClient in memory.
+type fakeRedis struct {
+	mtx    sync.Mutex
+	lists  map[string]chan string
+	topics map[string][]chan string
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{lists: make(map[string]chan string), topics: make(map[string][]chan string)}
+}
+
+func (r *fakeRedis) list(key string) chan string {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if _, ok := r.lists[key]; !ok {
+		r.lists[key] = make(chan string, 1024)
+	}
+	return r.lists[key]
+}
+
+func (r *fakeRedis) RPush(ctx context.Context, key, value string) error {
+	r.list(key) <- value
+	return nil
+}
+
+func (r *fakeRedis) BLPop(ctx context.Context, timeout time.Duration, key string) (string, bool, error) {
+	select {
+	case value := <-r.list(key):
+		return value, true, nil
+	case <-time.After(timeout):
+		return "", false, nil
+	case <-ctx.Done():
+		return "", false, ctx.Err()
+	}
+}
+
+func (r *fakeRedis) Publish(ctx context.Context, channel, message string) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for _, sub := range r.topics[channel] {
+		sub <- message
+	}
+	return nil
+}
+
+func (r *fakeRedis) Subscribe(ctx context.Context, channel string) (<-chan string, error) {
+	sub := make(chan string, 1024)
+	r.mtx.Lock()
+	r.topics[channel] = append(r.topics[channel], sub)
+	r.mtx.Unlock()
+	return sub, nil
+}
+
+func (r *fakeRedis) subscribers() int {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return len(r.topics)
+}
+
+func TestDistributed(t *testing.T) {
+	redis := newFakeRedis()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	producer := packer.MustNew(fakeExecute("1"), packer.Tokens("token"), packer.Distributed(redis, "bot"))
+	worker := packer.MustNew(fakeExecute("1"), packer.Tokens("token"), packer.Distributed(redis, "bot"))
+	for _, p := range []*packer.Packer{producer, worker} {
+		go func(p *packer.Packer) { _ = p.RunDistributed(ctx) }(p)
+		go func(p *packer.Packer) {
+			for ctx.Err() == nil {
+				time.Sleep(10 * time.Millisecond)
+				p.Send()
+			}
+		}(p)
+	}
+
+	// replies published before subscription are lost
+	for redis.subscribers() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(5)
+	for i := 0; i < 5; i++ {
+		go func(i int) {
+			defer wg.Done()
+			resp, err := producer.Handler("users.get", api.Params{"user_ids": i})
+			assert.Nil(t, err)
+			assert.Equal(t, "1", string(resp.Response))
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestDistributedReplyTimeout(t *testing.T) {
+	redis := newFakeRedis()
+	// the timeout applies whatever the order of options
+	p := packer.MustNew(fakeExecute("1"), packer.DistributedReplyTimeout(20*time.Millisecond),
+		packer.Distributed(redis, "bot"))
+	defer p.Close()
+
+	// no instance runs RunDistributed
+	_, err := p.Handler("users.get", api.Params{"user_ids": 1, "access_token": "secret"})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = p.Handler("users.get", api.Params{"user_ids": 2, "access_token": "secret", ":context": ctx})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	var req struct {
+		Params map[string]interface{} `json:"params"`
+	}
+	assert.Nil(t, json.Unmarshal([]byte(<-redis.list("bot:queue")), &req))
+	assert.NotContains(t, req.Params, "access_token")
+}
@@ -0,0 +1,78 @@
+package e2e
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/stretchr/testify/assert"
+	packer "github.com/zweihander/vk-execute-packer/v2"
+)
+
+func TestRegistry(t *testing.T) {
+	var (
+		mtx     sync.Mutex
+		created = map[int]int{}
+		batches []packer.BatchInfo
+	)
+	vk := &fakeVK{response: "1"}
+	reg := packer.NewRegistry(func(groupID int) (packer.VKHandler, []packer.Option, error) {
+		if groupID < 0 {
+			return nil, nil, errors.New("unknown group")
+		}
+		mtx.Lock()
+		created[groupID]++
+		mtx.Unlock()
+		return vk.Handler, []packer.Option{packer.Tokens("token")}, nil
+	}, packer.MaxPackedRequests(1), packer.OnBatch(func(info packer.BatchInfo, err error) {
+		mtx.Lock()
+		batches = append(batches, info)
+		mtx.Unlock()
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			p, err := reg.Get(i % 2)
+			assert.Nil(t, err)
+			_, err = p.Handler("users.get", api.Params{"user_ids": i})
+			assert.Nil(t, err)
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, map[int]int{0: 1, 1: 1}, created)
+	// OnBatch is called after responses are returned
+	assert.Eventually(t, func() bool {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return len(batches) == 10
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, 2, reg.Len())
+
+	_, err := reg.Get(-1)
+	assert.EqualError(t, err, "unknown group")
+	assert.Equal(t, 2, reg.Len())
+
+	tenants := 0
+	reg.Range(func(groupID int, p *packer.Packer) bool {
+		tenants++
+		return true
+	})
+	assert.Equal(t, 2, tenants)
+
+	p, _ := reg.Get(0)
+	assert.Nil(t, reg.Remove(0))
+	_, err = p.Handler("users.get", api.Params{"user_ids": 1})
+	assert.ErrorIs(t, err, packer.ErrShutdown)
+	_, _ = reg.Get(0)
+	assert.Equal(t, 2, created[0])
+
+	assert.Nil(t, reg.Close())
+	assert.Equal(t, 0, reg.Len())
+	_, err = reg.Get(1)
+	assert.ErrorIs(t, err, packer.ErrShutdown)
+}
@@ -0,0 +1,75 @@
+package e2e
+
+import (
+	"context"
+	"testing"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/stretchr/testify/assert"
+	packer "github.com/zweihander/vk-execute-packer/v2"
+)
+
+func TestRuleFunc(t *testing.T) {
+	vk := &fakeVK{response: "1"}
+	p := packer.MustNew(vk.Handler, packer.Tokens("token"), packer.MaxPackedRequests(1),
+		packer.RuleFunc(func(method string, params api.Params) packer.Decision {
+			if _, ok := params["attachment"]; ok {
+				return packer.Bypass
+			}
+			return packer.NoDecision
+		}),
+	)
+
+	_, err := p.Handler("messages.send", api.Params{"peer_id": 1, "attachment": "photo1_1"})
+	assert.Nil(t, err)
+	_, err = p.Handler("messages.send", api.Params{"peer_id": 1})
+	assert.Nil(t, err)
+
+	executes := vk.Executes()
+	assert.Len(t, executes, 2)
+	assert.Nil(t, executes[0]["code"])
+	assert.Contains(t, executes[1]["code"], "API.messages.send")
+}
+
+func TestRuntimeRules(t *testing.T) {
+	vk := &fakeVK{response: "1"}
+	p := packer.MustNew(vk.Handler, packer.Tokens("token"), packer.MaxPackedRequests(1))
+
+	packed := func() bool {
+		_, err := p.Handler("messages.send", api.Params{"peer_id": 1})
+		assert.Nil(t, err)
+		executes := vk.Executes()
+		return executes[len(executes)-1]["code"] != nil
+	}
+
+	assert.True(t, packed())
+	p.RemoveAllowedMethod("messages.send")
+	assert.False(t, packed())
+	p.AddAllowedMethod("messages.send")
+	assert.True(t, packed())
+	p.SetRules(packer.Allow, "users.*")
+	assert.False(t, packed())
+	p.AddAllowedMethod("messages.send")
+	assert.True(t, packed())
+}
+
+func TestNoBatch(t *testing.T) {
+	vk := &fakeVK{response: "1"}
+	p := packer.MustNew(vk.Handler, packer.Tokens("token"), packer.MaxPackedRequests(1))
+
+	params := api.Params{"peer_id": 1, "type": "typing", packer.NoBatchParam: true}
+	_, err := p.Handler("messages.setActivity", params)
+	assert.Nil(t, err)
+	_, err = p.Handler("messages.markAsRead", api.Params{"peer_id": 1}.WithContext(packer.NoBatch(context.Background())))
+	assert.Nil(t, err)
+	_, err = p.Handler("users.get", api.Params{"user_ids": 1})
+	assert.Nil(t, err)
+
+	executes := vk.Executes()
+	assert.Len(t, executes, 3)
+	assert.NotContains(t, executes[0], "code")
+	assert.NotContains(t, executes[0], packer.NoBatchParam)
+	assert.Contains(t, params, packer.NoBatchParam)
+	assert.NotContains(t, executes[1], "code")
+	assert.Contains(t, executes[2], "code")
+}
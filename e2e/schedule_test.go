@@ -0,0 +1,27 @@
+package e2e
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/stretchr/testify/assert"
+	packer "github.com/zweihander/vk-execute-packer/v2"
+)
+
+func TestEnqueueAfter(t *testing.T) {
+	vk := &fakeVK{response: "1"}
+	p := packer.MustNew(vk.Handler, packer.Tokens("token"), packer.MaxPackedRequests(2))
+
+	start := time.Now()
+	later := p.EnqueueAfter(50*time.Millisecond, "messages.send", api.Params{"peer_id": 1})
+	sooner := p.EnqueueAfter(10*time.Millisecond, "messages.send", api.Params{"peer_id": 2})
+
+	res := <-sooner
+	assert.Nil(t, res.Err)
+	assert.Equal(t, "1", string(res.Response.Response))
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+	res = <-later
+	assert.Nil(t, res.Err)
+	assert.Len(t, vk.Executes(), 1)
+}
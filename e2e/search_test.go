@@ -0,0 +1,40 @@
+package e2e
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/SevereCloud/vksdk/v2/object"
+	"github.com/stretchr/testify/assert"
+	packer "github.com/zweihander/vk-execute-packer/v2"
+)
+
+func TestSearchPosts(t *testing.T) {
+	// pages of 200 posts, each page repeats the last post of the previous one
+	handler := func(method string, params ...api.Params) (api.Response, error) {
+		start := 0
+		if s, ok := params[0]["start_from"].(string); ok {
+			fmt.Sscan(s, &start)
+		}
+		items := make([]string, 0, 200)
+		for i := start; i < start+200; i++ {
+			items = append(items, fmt.Sprintf(`{"owner_id":-1,"id":%d}`, i))
+		}
+		body := fmt.Sprintf(`{"items":[%s],"next_from":"%d"}`, strings.Join(items, ","), start+199)
+		return api.Response{Response: json.RawMessage(body)}, nil
+	}
+	p := packer.MustNew(handler, packer.Tokens("token"), packer.Rules(packer.Ignore, "newsfeed.search"))
+
+	seen := make(map[int]bool)
+	p.SearchPosts("newsfeed.search", api.Params{"q": "go"})(func(post object.WallWallpost, err error) bool {
+		assert.Nil(t, err)
+		assert.False(t, seen[post.ID])
+		seen[post.ID] = true
+		return true
+	})
+	// 1000 results of 5 pages minus 4 duplicates
+	assert.Len(t, seen, 996)
+}
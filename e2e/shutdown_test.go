@@ -0,0 +1,176 @@
+package e2e
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/stretchr/testify/assert"
+	packer "github.com/zweihander/vk-execute-packer/v2"
+)
+
+// waitPending waits until the request is added to the batch.
+func waitPending() {
+	time.Sleep(10 * time.Millisecond)
+}
+
+func TestCloseFlush(t *testing.T) {
+	vk := &fakeVK{response: "1"}
+	p := packer.MustNew(vk.Handler, packer.Tokens("token"))
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := p.Handler("users.get", api.Params{"user_ids": 1})
+		result <- err
+	}()
+	waitPending()
+
+	assert.Nil(t, p.Close())
+	assert.Nil(t, <-result)
+	assert.Len(t, vk.Executes(), 1)
+
+	_, err := p.Handler("users.get", api.Params{"user_ids": 1})
+	assert.ErrorIs(t, err, packer.ErrShutdown)
+}
+
+func TestCloseStopsGoroutines(t *testing.T) {
+	vk := &fakeVK{response: "1"}
+	before := runtime.NumGoroutine()
+	for i := 0; i < 50; i++ {
+		p := packer.MustNew(vk.Handler, packer.Tokens("token"), packer.FlushInterval(time.Millisecond))
+		_, err := p.Handler("users.get", api.Params{"user_ids": i})
+		assert.Nil(t, err)
+		assert.Nil(t, p.Close())
+
+		assert.Equal(t, 0, p.Pending())
+		assert.ErrorIs(t, p.SetMaxPackedRequests(1), packer.ErrShutdown)
+	}
+	for deadline := time.Now().Add(time.Second); runtime.NumGoroutine() > before && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), before)
+}
+
+func TestCloseConcurrentRequests(t *testing.T) {
+	vk := &fakeVK{response: "1"}
+	p := packer.MustNew(vk.Handler, packer.Tokens("token"), packer.FlushInterval(time.Millisecond))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := p.Handler("users.get", api.Params{"user_ids": i}); err != nil {
+				assert.ErrorIs(t, err, packer.ErrShutdown)
+			}
+		}()
+	}
+	assert.Nil(t, p.Close())
+	wg.Wait()
+}
+
+func TestCloseFail(t *testing.T) {
+	vk := &fakeVK{response: "1"}
+	p := packer.MustNew(vk.Handler, packer.Tokens("token"), packer.Shutdown(packer.DrainFail, 0))
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := p.Handler("users.get", api.Params{"user_ids": 1})
+		result <- err
+	}()
+	waitPending()
+
+	assert.Nil(t, p.Close())
+	assert.ErrorIs(t, <-result, packer.ErrShutdown)
+	assert.Empty(t, vk.Executes())
+}
+
+func TestCloseDeadline(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	p := packer.MustNew(func(method string, params ...api.Params) (api.Response, error) {
+		<-block
+		return api.Response{}, nil
+	}, packer.Tokens("token"), packer.Shutdown(packer.DrainFlush, 20*time.Millisecond))
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := p.Handler("users.get", api.Params{"user_ids": 1})
+		result <- err
+	}()
+	waitPending()
+
+	assert.ErrorIs(t, p.Close(), packer.ErrShutdown)
+	assert.ErrorIs(t, <-result, packer.ErrShutdown)
+}
+
+func TestSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pending.json")
+	vk := &fakeVK{response: "1"}
+	p := packer.MustNew(vk.Handler, packer.Tokens("token"), packer.Snapshot(path))
+
+	result := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func(i int) {
+			_, err := p.Handler("users.get", api.Params{"user_ids": i, "access_token": "user-token"})
+			result <- err
+		}(i)
+	}
+	waitPending()
+	assert.Nil(t, p.Close())
+	assert.ErrorIs(t, <-result, packer.ErrShutdown)
+	assert.ErrorIs(t, <-result, packer.ErrShutdown)
+	assert.Empty(t, vk.Executes())
+	data, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(data), "user-token")
+
+	p = packer.MustNew(vk.Handler, packer.Tokens("token"), packer.Snapshot(path))
+	defer p.Close()
+	var (
+		mtx      sync.Mutex
+		restored []string
+	)
+	assert.Nil(t, p.RestoreSnapshot(func(req packer.Request, resp api.Response, err error) {
+		assert.Nil(t, err)
+		mtx.Lock()
+		restored = append(restored, req.Params["user_ids"].(string))
+		mtx.Unlock()
+	}))
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+	p.Send()
+	assert.Eventually(t, func() bool {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return len(restored) == 2
+	}, time.Second, time.Millisecond)
+	assert.ElementsMatch(t, []string{"0", "1"}, restored)
+	assert.Len(t, vk.Executes(), 1)
+	assert.Nil(t, p.RestoreSnapshot(nil))
+}
+
+func TestSnapshotLazyTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pending.json")
+	data, err := json.Marshal([]packer.Request{
+		{Method: "users.get", Params: api.Params{"user_ids": "1", "access_token": "old"}},
+		{Method: "users.get", Params: api.Params{"user_ids": "2"}},
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(path, data, 0o600))
+
+	vk := &fakeVK{response: "1"}
+	p := packer.MustNew(vk.Handler, packer.Snapshot(path), packer.MaxPackedRequests(1))
+	defer p.Close()
+	errs := make(chan error, 2)
+	assert.Nil(t, p.RestoreSnapshot(func(req packer.Request, resp api.Response, err error) { errs <- err }))
+	assert.Nil(t, <-errs)
+	assert.Nil(t, <-errs)
+	assert.Equal(t, "old", vk.Executes()[0]["access_token"])
+}
@@ -0,0 +1,32 @@
+//go:build !windows
+
+package e2e
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/stretchr/testify/assert"
+	packer "github.com/zweihander/vk-execute-packer/v2"
+)
+
+func TestHandleSignals(t *testing.T) {
+	vk := &fakeVK{response: "1"}
+	p := packer.MustNew(vk.Handler, packer.Tokens("token"))
+	done := packer.HandleSignals(p, syscall.SIGUSR1)
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := p.Handler("users.get", api.Params{"user_ids": 1})
+		result <- err
+	}()
+	waitPending()
+
+	assert.Nil(t, syscall.Kill(syscall.Getpid(), syscall.SIGUSR1))
+	assert.Nil(t, <-done)
+	assert.Nil(t, <-result)
+	assert.Len(t, vk.Executes(), 1)
+	_, err := p.Handler("users.get", api.Params{"user_ids": 1})
+	assert.ErrorIs(t, err, packer.ErrShutdown)
+}
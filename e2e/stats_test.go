@@ -0,0 +1,44 @@
+package e2e
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/stretchr/testify/assert"
+	packer "github.com/zweihander/vk-execute-packer/v2"
+)
+
+func TestIntrospection(t *testing.T) {
+	vk := &fakeVK{response: "1"}
+	release := make(chan struct{})
+	handler := func(method string, params ...api.Params) (api.Response, error) {
+		<-release
+		return vk.Handler(method, params...)
+	}
+	p := packer.MustNew(handler, packer.Tokens("token"))
+	defer p.Close()
+
+	assert.Equal(t, 0, p.PendingCount())
+	assert.Equal(t, time.Duration(0), p.OldestPendingAge())
+
+	done := make(chan struct{})
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := p.Handler("users.get", api.Params{"user_ids": 1})
+			assert.Nil(t, err)
+			done <- struct{}{}
+		}()
+	}
+	assert.Eventually(t, func() bool { return p.PendingCount() == 2 }, time.Second, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	assert.GreaterOrEqual(t, p.OldestPendingAge(), 5*time.Millisecond)
+
+	p.Send()
+	assert.Equal(t, 0, p.PendingCount())
+	assert.Eventually(t, func() bool { return p.InFlightBatches() == 1 }, time.Second, time.Millisecond)
+	close(release)
+	<-done
+	<-done
+	assert.Eventually(t, func() bool { return p.InFlightBatches() == 0 }, time.Second, time.Millisecond)
+}
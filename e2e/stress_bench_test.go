@@ -0,0 +1,82 @@
+package e2e
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	packer "github.com/zweihander/vk-execute-packer/v2"
+)
+
+// BenchmarkManyAPICalls mirrors TestManyAPICalls workload
+// against fake execute handler.
+func BenchmarkManyAPICalls(b *testing.B) {
+	p := packer.MustNew(fakeExecute(`{"type":"user","object_id":1}`), packer.Tokens("token"))
+	num := 500
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var wg sync.WaitGroup
+		wg.Add(num)
+		for j := 0; j < num; j++ {
+			go func() {
+				defer wg.Done()
+				if _, err := p.Handler("utils.resolveScreenName", api.Params{
+					"screen_name": "durov",
+				}); err != nil {
+					b.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+// BenchmarkHandlerAllocs measures allocations of the packer itself
+// with 500 goroutines calling Handler with prebuilt params.
+func BenchmarkHandlerAllocs(b *testing.B) {
+	p := packer.MustNew(fakeExecute(`1`), packer.Tokens("token"), packer.FlushInterval(time.Millisecond))
+	defer p.Close()
+	params := api.Params{"screen_name": "durov"}
+
+	b.SetParallelism(500/runtime.GOMAXPROCS(0) + 1)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := p.Handler("utils.resolveScreenName", params); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
+
+// BenchmarkContention compares the single dispatcher queue with sharded
+// queues (see QueueShards) under 500 goroutines. On a single core
+// the variants are equal; compare them with benchstat over -cpu 1,4,16
+// on the target machine before enabling sharding.
+func BenchmarkContention(b *testing.B) {
+	for _, shards := range []int{1, 8, 64} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			p := packer.MustNew(fakeExecute(`1`), packer.Tokens("token"),
+				packer.FlushInterval(time.Millisecond), packer.QueueShards(shards))
+			defer p.Close()
+			params := api.Params{"screen_name": "durov"}
+
+			b.SetParallelism(500/runtime.GOMAXPROCS(0) + 1)
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := p.Handler("utils.resolveScreenName", params); err != nil {
+						b.Error(err)
+					}
+				}
+			})
+		})
+	}
+}
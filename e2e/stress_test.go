@@ -1,7 +1,7 @@
 package e2e
 
 import (
-	"os"
+	"strings"
 	"sync"
 	"testing"
 
@@ -11,14 +11,8 @@ import (
 )
 
 func TestManyAPICalls(t *testing.T) {
-	token := os.Getenv("USER_TOKEN")
-	if token == "" {
-		t.Skip("USER_TOKEN empty")
-	}
-
-	vk := api.NewVK(token)
-	vk.Limit = api.LimitUserToken
-	packer.Default(vk)
+	vk, _ := testVK(t)
+	assert.NoError(t, packer.Default(vk))
 	var wg sync.WaitGroup
 	num := 500
 	wg.Add(num)
@@ -34,3 +28,28 @@ func TestManyAPICalls(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func TestQueueShards(t *testing.T) {
+	vk := &fakeVK{response: "1"}
+	p := packer.MustNew(vk.Handler, packer.Tokens("token"), packer.QueueShards(8))
+	defer p.Close()
+
+	num := 500
+	group := p.NewFlushGroup()
+	for i := 0; i < num; i++ {
+		i := i
+		group.Go(func() {
+			resp, err := p.Handler("users.get", api.Params{"user_ids": i})
+			assert.Nil(t, err)
+			assert.Equal(t, "1", string(resp.Response))
+		})
+	}
+	group.Wait()
+
+	calls := 0
+	for _, exec := range vk.Executes() {
+		calls += strings.Count(exec["code"].(string), "API.users.get")
+	}
+	assert.Equal(t, num, calls)
+	assert.Equal(t, 0, p.Pending())
+}
@@ -0,0 +1,82 @@
+package e2e
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/stretchr/testify/assert"
+	packer "github.com/zweihander/vk-execute-packer/v2"
+)
+
+func TestWith(t *testing.T) {
+	vk := &fakeVK{response: "1"}
+	p := packer.MustNew(vk.Handler, packer.Tokens("token1", "token2"), packer.MaxPackedRequests(1),
+		packer.Rules(packer.Ignore, "messages.send"))
+	defer p.Close()
+
+	bulk, err := p.With(packer.MaxPackedRequests(25))
+	assert.NoError(t, err)
+	defer bulk.Close()
+
+	_, err = p.Handler("users.get", api.Params{"user_ids": 1})
+	assert.Nil(t, err)
+	assert.Len(t, vk.Executes(), 1)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := bulk.Handler("users.get", api.Params{"user_ids": 2})
+		assert.Nil(t, err)
+	}()
+	assert.Eventually(t, func() bool { return bulk.Pending() == 1 }, time.Second, time.Millisecond)
+	_, err = bulk.Handler("messages.send", api.Params{"peer_id": 1})
+	assert.Nil(t, err)
+	assert.NotContains(t, vk.Executes()[1], "code")
+
+	assert.NoError(t, bulk.EvictToken("token2"))
+	assert.Equal(t, []string{"***"}, p.Config().Tokens)
+	assert.Equal(t, 25, bulk.Config().MaxPackedRequests)
+
+	_, err = p.With(packer.MaxPackedRequests(0))
+	assert.Error(t, err)
+
+	bulk.Send()
+	<-done
+	assert.Contains(t, vk.Executes()[2]["code"], "API.users.get")
+}
+
+func TestWithStorage(t *testing.T) {
+	dir := t.TempDir()
+	queue, err := packer.NewFileQueue(filepath.Join(dir, "queue"))
+	assert.NoError(t, err)
+	vk := &fakeVK{response: "1"}
+	p := packer.MustNew(vk.Handler, packer.Tokens("token"),
+		packer.Snapshot(filepath.Join(dir, "snapshot")), packer.PersistentQueue(queue))
+	defer p.Close()
+
+	bulk, err := p.With()
+	assert.NoError(t, err)
+	defer bulk.Close()
+	assert.Equal(t, "", bulk.Config().Snapshot)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := bulk.Handler("users.get", api.Params{"user_ids": 1})
+		assert.Nil(t, err)
+	}()
+	assert.Eventually(t, func() bool { return bulk.Pending() == 1 }, time.Second, time.Millisecond)
+	pending, err := queue.Pending()
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+	bulk.Send()
+	<-done
+
+	own := filepath.Join(dir, "bulk")
+	bulk, err = p.With(packer.Snapshot(own))
+	assert.NoError(t, err)
+	defer bulk.Close()
+	assert.Equal(t, own, bulk.Config().Snapshot)
+}
@@ -0,0 +1,77 @@
+package packer
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/SevereCloud/vksdk/v2/object"
+)
+
+// ParamEncoder converts a param value into its string representation.
+// It should return false if the value is not supported by encoder.
+type ParamEncoder interface {
+	EncodeParam(value interface{}) (string, bool)
+}
+
+// ParamEncoderFunc is an adapter to allow the use of
+// ordinary functions as ParamEncoder.
+type ParamEncoderFunc func(value interface{}) (string, bool)
+
+// EncodeParam calls f(value).
+func (f ParamEncoderFunc) EncodeParam(value interface{}) (string, bool) {
+	return f(value)
+}
+
+// ParamEncoders registers custom param encoders.
+// They are tried in order before the default ones.
+func ParamEncoders(encoders ...ParamEncoder) Option {
+	return func(p *Packer) {
+		p.paramEncoders = append(p.paramEncoders, encoders...)
+	}
+}
+
+// encodeParam converts value in the same way vksdk does for direct calls:
+// slices are comma-joined, bools become 1/0, time.Time becomes unix timestamp.
+func encodeParam(encoders []ParamEncoder, value interface{}) string {
+	for _, enc := range encoders {
+		if s, ok := enc.EncodeParam(value); ok {
+			return s
+		}
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case int:
+		return strconv.Itoa(v)
+	case time.Time:
+		return strconv.FormatInt(v.Unix(), 10)
+	case object.Attachment, object.JSONObject:
+		return api.FmtValue(v, 0)
+	case fmt.Stringer:
+		return v.String()
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		items := make([]string, rv.Len())
+		for i := range items {
+			items[i] = encodeParam(encoders, rv.Index(i).Interface())
+		}
+		return strings.Join(items, ",")
+	}
+
+	return api.FmtValue(value, 0)
+}
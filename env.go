@@ -0,0 +1,120 @@
+package packer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultEnvPrefix is the prefix of environment variables
+// read by ConfigFromEnv when the prefix is empty.
+const DefaultEnvPrefix = "VKPACKER"
+
+// envAliases are short names of config keys in environment variables.
+var envAliases = map[string]string{
+	"max_packed_requests": "MAX_BATCH",
+}
+
+// ConfigFromEnv reads the config from environment variables named
+// after config keys in upper case with the prefix, e.g. VKPACKER_MAX_BATCH
+// (or VKPACKER_MAX_PACKED_REQUESTS), VKPACKER_FLUSH_INTERVAL=2s and
+// VKPACKER_TOKENS=token1,token2. Lists are comma separated, maps
+// and profiles are JSON objects. If PREFIX_CONFIG is set, the config file
+// is loaded first and the variables override it.
+func ConfigFromEnv(prefix string) (Config, error) {
+	if prefix == "" {
+		prefix = DefaultEnvPrefix
+	}
+	prefix = strings.TrimSuffix(prefix, "_") + "_"
+
+	cfg := Config{keys: make(map[string]struct{})}
+	if path := os.Getenv(prefix + "CONFIG"); path != "" {
+		var err error
+		if cfg, err = LoadConfig(path); err != nil {
+			return cfg, err
+		}
+	}
+
+	v := reflect.ValueOf(&cfg).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		key := configKey(field)
+		name := prefix + strings.ToUpper(key)
+		value, ok := os.LookupEnv(name)
+		if alias, hasAlias := envAliases[key]; !ok && hasAlias {
+			name = prefix + alias
+			value, ok = os.LookupEnv(name)
+		}
+		if !ok {
+			continue
+		}
+		if err := setEnvValue(v.Field(i).Addr().Interface(), value); err != nil {
+			return cfg, fmt.Errorf("packer: %s: %w", name, err)
+		}
+		cfg.keys[key] = struct{}{}
+	}
+	return cfg, nil
+}
+
+func setEnvValue(ptr interface{}, value string) error {
+	var err error
+	switch ptr := ptr.(type) {
+	case *string:
+		*ptr = value
+	case *bool:
+		*ptr, err = strconv.ParseBool(value)
+	case *int:
+		*ptr, err = strconv.Atoi(value)
+	case *float64:
+		*ptr, err = strconv.ParseFloat(value, 64)
+	case *Duration:
+		var d time.Duration
+		d, err = time.ParseDuration(value)
+		*ptr = Duration(d)
+	case *[]string:
+		*ptr = splitEnvList(value)
+	case *[]int:
+		*ptr = nil
+		for _, s := range splitEnvList(value) {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return err
+			}
+			*ptr = append(*ptr, n)
+		}
+	default:
+		err = json.Unmarshal([]byte(value), ptr)
+	}
+	return err
+}
+
+func splitEnvList(value string) []string {
+	var list []string
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// NewFromEnv creates a new Packer configured by environment variables
+// (see ConfigFromEnv), so deployments can configure it without code changes:
+//
+//	VKPACKER_TOKENS=token1,token2 VKPACKER_FLUSH_INTERVAL=1s ./app
+//
+// Options are applied after the config and may override it.
+func NewFromEnv(handler VKHandler, prefix string, opts ...Option) (*Packer, error) {
+	cfg, err := ConfigFromEnv(prefix)
+	if err != nil {
+		return nil, err
+	}
+	return NewFromConfig(handler, cfg, opts...)
+}
@@ -1,38 +1,360 @@
 package packer
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"log"
+	"net"
+	"regexp"
+	"sync/atomic"
+	"time"
 
 	"github.com/SevereCloud/vksdk/v2/api"
+	"golang.org/x/time/rate"
 )
 
-type packedExecuteResponse struct {
-	Responses     map[string]json.RawMessage
-	ExecuteErrors api.ExecuteErrors
+// Decoder decodes JSON data. It is satisfied by
+// jsoniter.API, sonic.API and similar libraries.
+type Decoder interface {
+	Unmarshal(data []byte, v interface{}) error
 }
 
-func (p *Packer) execute(code string) (packedExecuteResponse, error) {
-	resp, err := p.vkHandler("execute", api.Params{
-		"access_token": p.tokenPool.Get(),
-		"v":            api.Version,
-		"code":         code,
-	})
+type stdDecoder struct{}
+
+func (stdDecoder) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// JSONDecoder sets the decoder used for unpacking execute responses.
+// By default encoding/json is used.
+func JSONDecoder(d Decoder) Option {
+	return func(p *Packer) {
+		p.decoder = d
+	}
+}
+
+// RateLimit limits the rate of execute requests of all tokens,
+// batches wait for the limiter before they are sent.
+// The limiter may be shared with other packers.
+//
+//	packer.RateLimit(rate.NewLimiter(20, 1))
+func RateLimit(l *rate.Limiter) Option {
+	return func(p *Packer) {
+		p.limiter = l
+	}
+}
+
+// TokenRateLimit limits the rate of execute requests of each token,
+// e.g. to 3 requests per second for user tokens:
+//
+//	packer.TokenRateLimit(3, 1)
+func TokenRateLimit(limit rate.Limit, burst int) Option {
+	return func(p *Packer) {
+		p.tokenLimit = limit
+		p.tokenBurst = burst
+	}
+}
+
+// tokenLimiter returns the limiter of the token or nil if TokenRateLimit is not set.
+func (p *Packer) tokenLimiter(token string) *rate.Limiter {
+	p.tokenLimMtx.Lock()
+	defer p.tokenLimMtx.Unlock()
+	if p.tokenLimit == 0 {
+		return nil
+	}
+	l, ok := p.tokenLimiters[token]
+	if !ok {
+		l = rate.NewLimiter(p.tokenLimit, p.tokenBurst)
+		p.tokenLimiters[token] = l
+	}
+	return l
+}
+
+// Retry makes the packer resend the batch up to attempts times
+// when the execute request fails, waiting backoff*attempt between attempts.
+// Batches with writes are resent only after errors which show
+// that VK has not executed them (too many requests, failed connection),
+// so messages are not duplicated after timeouts, see RetryIf.
+func Retry(attempts int, backoff time.Duration) Option {
+	return func(p *Packer) {
+		p.retries = attempts
+		p.retryBackoff = backoff
+	}
+}
+
+// RetryIf sets methods which are safe to resend after any error,
+// the batch is resent if fn is true for all its methods.
+// By default these are reads (see ClassOf).
+func RetryIf(fn func(method string) bool) Option {
+	return func(p *Packer) {
+		p.retryIf = fn
+	}
+}
+
+// retryable reports whether the batch failed with err may be resent.
+func (p *Packer) retryable(bat batch, err error) bool {
+	if notExecuted(err) {
+		return true
+	}
+	for _, request := range bat {
+		if p.retryIf != nil && !p.retryIf(request.method) ||
+			p.retryIf == nil && ClassOf(request.method) != ClassRead {
+			return false
+		}
+	}
+	return true
+}
+
+// notExecuted reports whether err shows that the request
+// has not reached VK or was rejected before execution.
+func notExecuted(err error) bool {
+	var (
+		opErr  *net.OpError
+		dnsErr *net.DNSError
+	)
+	return errors.Is(err, api.ErrTooMany) ||
+		errors.As(err, &opErr) && opErr.Op == "dial" ||
+		errors.As(err, &dnsErr)
+}
+
+// OnRawResponse sets the hook which receives the exact part of execute response
+// for each packed request before it is returned to the caller.
+// Merged requests (see Coalesce) are reported once with merged params.
+func OnRawResponse(fn func(info BatchInfo, req Request, raw json.RawMessage)) Option {
+	return func(p *Packer) {
+		p.onRawResponse = fn
+	}
+}
+
+// eachResponse calls fn for every element of the execute response array
+// and returns the number of elements. With the default decoder elements
+// are sliced from the response in a single pass without copying.
+func (p *Packer) eachResponse(data []byte, fn func(i int, body json.RawMessage)) (int, error) {
+	if isMessagePack(data) {
+		return 0, ErrUnsupportedEncoding
+	}
+
+	if _, ok := p.decoder.(stdDecoder); ok {
+		return eachElement(data, fn)
+	}
+
+	var bodies []json.RawMessage
+	if err := p.decoder.Unmarshal(data, &bodies); err != nil {
+		return 0, err
+	}
+	for i, body := range bodies {
+		fn(i, body)
+	}
+	return len(bodies), nil
+}
+
+// scriptCallRegexp matches API calls in VKScript code.
+var scriptCallRegexp = regexp.MustCompile(`API\.([a-zA-Z0-9_]+\.[a-zA-Z0-9_]+)\s*\(`)
+
+// Execute runs VKScript code using packer tokens with the rate limits
+// and retries of packed batches. Failed attempts are retried like batches
+// (see Retry and RetryIf) judging by API methods found in the code.
+// The request is reported to OnBatch with FlushExecute trigger.
+func (p *Packer) Execute(code string) (api.Response, error) {
+	var calls batch
+	for _, match := range scriptCallRegexp.FindAllStringSubmatch(code, -1) {
+		calls = append(calls, request{method: match[1]})
+	}
+	info := BatchInfo{
+		ID:       atomic.AddUint64(&p.batchSeq, 1),
+		Created:  time.Now(),
+		Trigger:  FlushExecute,
+		Requests: len(calls),
+		CodeSize: len(code),
+		Attempt:  1,
+	}
+
+	if p.tokenPool.Len() == 0 {
+		return api.Response{}, p.decorate("execute", errNoTokens)
+	}
+	send := func() (api.Response, error) {
+		token := p.tokenPool.Get()
+		info.Token = tokenAlias(token)
+		return p.executeWithToken(token, p.execMethod, api.Params{"v": p.version}, api.Params{"code": code})
+	}
+
+	retries, backoff := p.retryPolicy()
+	resp, err := send()
+	for err != nil && info.Attempt <= retries && p.retryable(calls, err) {
+		if p.debug {
+			log.Printf("packer: execute %s: retry: %v\n", info, err)
+		}
+		time.Sleep(backoff * time.Duration(info.Attempt))
+		info.Attempt++
+		resp, err = send()
+	}
+	info.Duration = time.Since(info.Created)
+
+	if p.onBatch != nil {
+		p.onBatch(info, err)
+	}
+	return resp, p.decorate("execute", err)
+}
+
+func (p *Packer) execute(code string) (api.Response, error) {
+	if p.tokenPool.Len() == 0 {
+		return api.Response{}, errNoTokens
+	}
+
+	return p.executeCode(code, api.Params{"v": p.version})
+}
+
+func (p *Packer) executeCode(code string, params api.Params) (api.Response, error) {
+	return p.executeMethod(p.execMethod, params, api.Params{"code": code})
+}
+
+// executeMethod calls execute (or stored procedure) with a token from the pool.
+func (p *Packer) executeMethod(method string, params ...api.Params) (api.Response, error) {
+	return p.executeWithToken(p.tokenPool.Get(), method, params...)
+}
+
+func (p *Packer) executeWithToken(token, method string, params ...api.Params) (api.Response, error) {
+	p.tuneMtx.RLock()
+	limiter := p.limiter
+	p.tuneMtx.RUnlock()
+	if limiter != nil {
+		if err := limiter.Wait(context.Background()); err != nil {
+			return api.Response{}, err
+		}
+	}
+	if l := p.tokenLimiter(token); l != nil {
+		if err := l.Wait(context.Background()); err != nil {
+			return api.Response{}, err
+		}
+	}
+
+	if p.batchParams != nil {
+		params = append([]api.Params{p.batchParams}, params...)
+	}
+	params = append(params, api.Params{"access_token": token})
+	resp, err := p.vkHandler(method, params...)
+	p.health.observe(token, err)
 	if err != nil {
-		return packedExecuteResponse{}, err
+		return resp, err
 	}
 
 	if p.debug {
 		log.Printf("packer: execute: response: \n%s\n", resp.Response)
 	}
 
-	execResponses := make(map[string]json.RawMessage)
-	if err := json.Unmarshal(resp.Response, &execResponses); err != nil {
-		return packedExecuteResponse{}, err
+	return resp, nil
+}
+
+var errNoTokens = errors.New("packer: no tokens available")
+
+// ErrUnsupportedEncoding is returned when execute response is not JSON,
+// e.g. when msgpack is enabled on the client.
+var ErrUnsupportedEncoding = errors.New("packer: unsupported response encoding (only JSON is supported, disable msgpack)")
+
+// isMessagePack reports whether data looks like msgpack array or map,
+// which is what msgpack execute response starts with.
+func isMessagePack(data []byte) bool {
+	if len(data) == 0 {
+		return false
+	}
+	switch c := data[0]; {
+	case c >= 0x80 && c <= 0x9f: // fixmap, fixarray
+		return true
+	case c == 0xdc || c == 0xdd || c == 0xde || c == 0xdf: // array 16/32, map 16/32
+		return true
+	}
+	return false
+}
+
+var errBadArray = errors.New("packer: execute response is not a valid JSON array")
+
+// eachElement calls fn for every element of JSON array without copying them.
+// Elements are not validated, fn is called as soon as the element is scanned.
+func eachElement(data []byte, fn func(i int, elem json.RawMessage)) (int, error) {
+	i := skipSpaces(data, 0)
+	if i == len(data) || data[i] != '[' {
+		return 0, errBadArray
+	}
+	i = skipSpaces(data, i+1)
+	if i < len(data) && data[i] == ']' {
+		return 0, nil
 	}
 
-	return packedExecuteResponse{
-		execResponses,
-		resp.ExecuteErrors,
-	}, nil
+	n := 0
+	for i < len(data) {
+		start := i
+		i = skipValue(data, i)
+		if i == start {
+			return n, errBadArray
+		}
+		end := i
+		i = skipSpaces(data, i)
+		if i == len(data) || (data[i] != ',' && data[i] != ']') {
+			return n, errBadArray
+		}
+
+		fn(n, json.RawMessage(data[start:end:end]))
+		n++
+		if data[i] == ']' {
+			return n, nil
+		}
+		i = skipSpaces(data, i+1)
+	}
+
+	return n, errBadArray
+}
+
+func skipSpaces(data []byte, i int) int {
+	for i < len(data) {
+		switch data[i] {
+		case ' ', '\t', '\n', '\r':
+			i++
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// skipValue returns the index right after the value starting at i.
+// data must be a valid JSON.
+func skipValue(data []byte, i int) int {
+	depth := 0
+	inString := false
+	for ; i < len(data); i++ {
+		c := data[i]
+		if inString {
+			switch c {
+			case '\\':
+				i++
+			case '"':
+				inString = false
+				if depth == 0 {
+					return i + 1
+				}
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+		case '}', ']':
+			if depth == 0 {
+				return i
+			}
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		case ',', ' ', '\t', '\n', '\r':
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return i
 }
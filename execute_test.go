@@ -0,0 +1,55 @@
+package packer
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func splitArray(data []byte) ([]json.RawMessage, error) {
+	var parts []json.RawMessage
+	_, err := eachElement(data, func(i int, elem json.RawMessage) {
+		parts = append(parts, elem)
+	})
+	return parts, err
+}
+
+func TestEachElement(t *testing.T) {
+	data := []byte(` [ {"a":"]},[\"x"}, [1, [2]] ,false,"s\\",12.5e3,null, {} ] `)
+	parts, err := splitArray(data)
+	assert.Nil(t, err)
+
+	var expected []json.RawMessage
+	assert.Nil(t, json.Unmarshal(data, &expected))
+	assert.Equal(t, len(expected), len(parts))
+	for i := range expected {
+		assert.JSONEq(t, string(expected[i]), string(parts[i]))
+	}
+
+	parts, err = splitArray([]byte(`[]`))
+	assert.Nil(t, err)
+	assert.Len(t, parts, 0)
+
+	_, err = splitArray([]byte(`{"r0":1}`))
+	assert.Error(t, err)
+
+	parts, err = splitArray([]byte(`[1,{"a":2`))
+	assert.Error(t, err)
+	assert.Len(t, parts, 1)
+}
+
+func TestMessagePackDetection(t *testing.T) {
+	p := MustNew(func(method string, params ...api.Params) (api.Response, error) {
+		// msgpack fixarray with two positive fixints
+		return api.Response{Response: []byte{0x92, 0x01, 0x02}}, nil
+	}, Tokens("token"))
+
+	_, err := p.Pipeline().Call("users.get").Exec()
+	assert.Equal(t, ErrUnsupportedEncoding, err)
+
+	n, err := p.eachResponse([]byte{0x92, 0x01, 0x02}, func(int, json.RawMessage) {})
+	assert.Equal(t, 0, n)
+	assert.Equal(t, ErrUnsupportedEncoding, err)
+}
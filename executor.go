@@ -0,0 +1,69 @@
+package packer
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+// Executor is the transport used by the packer to reach VK API.
+// Implement it to use the packer with other VK client libraries
+// or a raw HTTP client, vksdk handlers are used through New directly.
+type Executor interface {
+	// Execute runs the execute method with the VKScript code.
+	Execute(code, token string, params map[string]interface{}) (RawResponse, error)
+	// Call runs any other method: stored procedures
+	// and requests which are not packed.
+	Call(method, token string, params map[string]interface{}) (RawResponse, error)
+}
+
+// ExecuteError is the error of a single call inside execute.
+type ExecuteError = api.ExecuteError
+
+// RawResponse holds "response" and "execute_errors" fields of the API response.
+type RawResponse struct {
+	Response      json.RawMessage
+	ExecuteErrors []ExecuteError
+}
+
+// NewWithExecutor creates a new Packer which sends requests through e.
+func NewWithExecutor(e Executor, opts ...Option) (*Packer, error) {
+	return New(FromExecutor(e), opts...)
+}
+
+// FromExecutor adapts the executor to the handler signature accepted by New.
+func FromExecutor(e Executor) VKHandler {
+	return func(method string, params ...api.Params) (api.Response, error) {
+		var token string
+		args := make(map[string]interface{})
+		iterateAll(func(name string, value interface{}) {
+			switch {
+			case name == "access_token":
+				token, _ = value.(string)
+			case strings.HasPrefix(name, ":"):
+			default:
+				args[name] = value
+			}
+		}, params...)
+
+		var (
+			resp RawResponse
+			err  error
+		)
+		if code, ok := args["code"].(string); ok && method == "execute" {
+			delete(args, "code")
+			resp, err = e.Execute(code, token, args)
+		} else {
+			resp, err = e.Call(method, token, args)
+		}
+		return api.Response{Response: resp.Response, ExecuteErrors: resp.ExecuteErrors}, err
+	}
+}
+
+// Do proceeds the request like Handler and returns the raw response,
+// so callers do not need vksdk types.
+func (p *Packer) Do(method string, params map[string]interface{}) (json.RawMessage, error) {
+	resp, err := p.Handler(method, params)
+	return resp.Response, err
+}
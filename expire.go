@@ -0,0 +1,86 @@
+package packer
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+// ErrExpired is returned for requests which were not sent before their TTL.
+var ErrExpired = errors.New("packer: request expired")
+
+// MethodTTL sets the time the request of the method may wait in the batch,
+// expired requests are not sent and fail with ErrExpired.
+// The deadline of the request context (see api.Params.WithContext)
+// is used too. Requests of methods with mergers (see Coalesce) never expire.
+func MethodTTL(method string, ttl time.Duration) Option {
+	return func(p *Packer) {
+		p.ttls[method] = ttl
+	}
+}
+
+// OnExpire sets the hook which is called for every expired request.
+func OnExpire(fn func(req Request)) Option {
+	return func(p *Packer) {
+		p.onExpire = fn
+	}
+}
+
+const (
+	expiryPending int32 = iota
+	expirySent
+	expiryExpired
+)
+
+type expiry struct {
+	state int32
+	timer *time.Timer
+}
+
+// expire starts the expiration timer of the request if it has TTL.
+func (p *Packer) expire(req request) request {
+	var deadline time.Time
+	if ttl, ok := p.ttls[req.method]; ok && ttl > 0 {
+		deadline = time.Now().Add(ttl)
+	}
+	if ctx := paramsContext(req.params...); ctx != nil {
+		if d, ok := ctx.Deadline(); ok && (deadline.IsZero() || d.Before(deadline)) {
+			deadline = d
+		}
+	}
+	if deadline.IsZero() {
+		return req
+	}
+
+	e := &expiry{}
+	method, params, callback := req.method, req.params, req.callback
+	e.timer = time.AfterFunc(time.Until(deadline), func() {
+		if !atomic.CompareAndSwapInt32(&e.state, expiryPending, expiryExpired) {
+			return
+		}
+		if p.onExpire != nil {
+			p.onExpire(Request{method, mergeParams(params...)})
+		}
+		callback(api.Response{}, ErrExpired)
+	})
+	req.expiry = e
+	return req
+}
+
+// unexpired removes expired requests from the batch
+// and stops timers of the remaining ones.
+func (p *Packer) unexpired(bat batch) batch {
+	alive := bat[:0]
+	for _, req := range bat {
+		if req.expiry != nil {
+			if !atomic.CompareAndSwapInt32(&req.expiry.state, expiryPending, expirySent) {
+				continue
+			}
+			req.expiry.timer.Stop()
+		}
+		alive = append(alive, req)
+	}
+	return alive
+}
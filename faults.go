@@ -0,0 +1,126 @@
+package packer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+// ErrInjectedFault is the transport error injected by InjectFaults.
+var ErrInjectedFault = errors.New("packer: injected transport fault")
+
+// Faults are failures injected into requests sent to VK,
+// rates are probabilities from 0 to 1 checked for every request.
+type Faults struct {
+	// TransportRate fails the request with ErrInjectedFault without sending it.
+	TransportRate float64
+	// TooManyRate fails the request with api.ErrTooMany without sending it.
+	TooManyRate float64
+	// ExecuteErrorRate replaces each call response of execute with false
+	// and adds the execute error, like VK does for failed calls.
+	ExecuteErrorRate float64
+	// SlowRate delays the request by SlowDelay.
+	SlowRate  float64
+	SlowDelay time.Duration
+	// Seed makes injected faults reproducible.
+	Seed int64
+}
+
+// InjectFaults makes the packer inject faults into requests
+// it sends to VK, so retries and fallbacks of the application
+// can be tested under adverse conditions:
+//
+//	packer.InjectFaults(packer.Faults{TooManyRate: 0.1, ExecuteErrorRate: 0.05})
+func InjectFaults(f Faults) Option {
+	return func(p *Packer) {
+		inj := &faultInjector{faults: f, rand: rand.New(rand.NewSource(f.Seed)), isExecute: p.isExecute}
+		p.vkHandler = inj.wrap(p.vkHandler)
+	}
+}
+
+type faultInjector struct {
+	faults    Faults
+	isExecute func(method string) bool
+
+	mtx  sync.Mutex
+	rand *rand.Rand
+}
+
+func (inj *faultInjector) roll(probability float64) bool {
+	if probability <= 0 {
+		return false
+	}
+	inj.mtx.Lock()
+	defer inj.mtx.Unlock()
+	return inj.rand.Float64() < probability
+}
+
+func (inj *faultInjector) wrap(next VKHandler) VKHandler {
+	f := inj.faults
+	return func(method string, params ...api.Params) (api.Response, error) {
+		if inj.roll(f.SlowRate) {
+			time.Sleep(f.SlowDelay)
+		}
+		if inj.roll(f.TransportRate) {
+			return api.Response{}, ErrInjectedFault
+		}
+		if inj.roll(f.TooManyRate) {
+			err := api.Error{Code: api.ErrTooMany, Message: "Too many requests per second"}
+			return api.Response{Error: err}, &err
+		}
+
+		resp, err := next(method, params...)
+		if err != nil || f.ExecuteErrorRate <= 0 || !inj.isExecute(method) {
+			return resp, err
+		}
+		return inj.failCalls(resp), nil
+	}
+}
+
+// failCalls replaces random call responses with false keeping
+// execute errors of calls which have failed in order.
+func (inj *faultInjector) failCalls(resp api.Response) api.Response {
+	var bodies []json.RawMessage
+	if err := json.Unmarshal(resp.Response, &bodies); err != nil {
+		return resp
+	}
+
+	var (
+		errs     api.ExecuteErrors
+		failed   int
+		injected bool
+	)
+	for i, body := range bodies {
+		switch {
+		case bytes.Equal(body, []byte("false")):
+			if failed < len(resp.ExecuteErrors) {
+				errs = append(errs, resp.ExecuteErrors[failed])
+				failed++
+			}
+		case inj.roll(inj.faults.ExecuteErrorRate):
+			bodies[i] = json.RawMessage("false")
+			errs = append(errs, api.ExecuteError{
+				Method: "execute",
+				Code:   int(api.ErrUnknown),
+				Msg:    "packer: injected fault",
+			})
+			injected = true
+		}
+	}
+	if !injected {
+		return resp
+	}
+
+	data, err := json.Marshal(bodies)
+	if err != nil {
+		return resp
+	}
+	resp.Response = data
+	resp.ExecuteErrors = append(errs, resp.ExecuteErrors[failed:]...)
+	return resp
+}
@@ -0,0 +1,86 @@
+package packer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// fileLog is the append-only file of JSON lines synced on every write.
+type fileLog struct {
+	path string
+	file *os.File
+	mtx  sync.Mutex
+}
+
+// rewriteLog replaces the file at path with records and opens it for appending.
+func rewriteLog(path string, records []interface{}) (*fileLog, error) {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &fileLog{path: path, file: f}
+	for _, rec := range records {
+		if err := l.write(rec); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *fileLog) write(rec interface{}) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return l.file.Sync()
+}
+
+func (l *fileLog) close() error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.file.Close()
+}
+
+// readLog calls fn for every line of the file, missing file is empty.
+// The last line may be partially written on crash, so fn must skip invalid lines.
+func readLog(path string, fn func(line []byte)) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 16<<20)
+	for scanner.Scan() {
+		fn(scanner.Bytes())
+	}
+	return scanner.Err()
+}
+
+// newID returns the id which is unique across restarts.
+func (p *Packer) newID() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36) + "-" + strconv.FormatUint(atomic.AddUint64(&p.idSeq, 1), 36)
+}
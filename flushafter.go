@@ -0,0 +1,37 @@
+package packer
+
+import (
+	"context"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+type flushAfterKey struct{}
+
+// FlushAfter returns the context which makes the batch of requests made
+// with it (see api.Params.WithContext) sent right after the request is added,
+// e.g. for the last call of a unit of work which should not wait for the timer.
+// The hint is ignored while the packer is paused or deterministic.
+func FlushAfter(ctx context.Context) context.Context {
+	return context.WithValue(ctx, flushAfterKey{}, true)
+}
+
+func flushAfter(params []api.Params) bool {
+	if ctx := paramsContext(params...); ctx != nil {
+		flush, _ := ctx.Value(flushAfterKey{}).(bool)
+		return flush
+	}
+	return false
+}
+
+// flushHinted dispatches all pending requests of the key.
+// Runs on the dispatcher.
+func (p *Packer) flushHinted(key batchKey, pending *pendingBatch) {
+	if p.deterministic || p.Paused() {
+		return
+	}
+	limits := p.limits(key)
+	for pending.len() > 0 {
+		p.dispatchBatch(key, p.batchInfo(pending, FlushHint), p.take(pending, limits))
+	}
+}
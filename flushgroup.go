@@ -0,0 +1,90 @@
+package packer
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// FlushGroup runs functions which make API calls concurrently and sends
+// pending batches as soon as all of them are waiting for responses,
+// so the calls of the group are packed together without timers.
+//
+// Requests of other callers are counted as well, they may only make
+// the group flush earlier.
+type FlushGroup struct {
+	p       *Packer
+	running int
+	flushed uint32
+	wg      sync.WaitGroup
+}
+
+// NewFlushGroup creates a new FlushGroup.
+func (p *Packer) NewFlushGroup() *FlushGroup {
+	return &FlushGroup{p: p}
+}
+
+// Go runs fn in a new goroutine. Go must not be called after Wait returned.
+func (g *FlushGroup) Go(fn func()) {
+	g.p.waitMtx.Lock()
+	g.running++
+	g.p.waitMtx.Unlock()
+
+	g.wg.Add(1)
+	go func() {
+		defer func() {
+			g.p.waitMtx.Lock()
+			g.running--
+			g.p.waitCond.Broadcast()
+			g.p.waitMtx.Unlock()
+			g.wg.Done()
+		}()
+		fn()
+	}()
+}
+
+// Wait flushes the packer whenever all functions of the group
+// are blocked by packed requests and returns when all of them returned.
+func (g *FlushGroup) Wait() {
+	p := g.p
+	p.waitMtx.Lock()
+	atomic.AddInt32(&p.waitGroups, 1)
+	for g.running > 0 {
+		enqueued := atomic.LoadUint32(&p.enqueued)
+		if int(atomic.LoadInt32(&p.waiting)) >= g.running && enqueued != g.flushed {
+			g.flushed = enqueued
+			p.waitMtx.Unlock()
+			p.Send()
+			p.waitMtx.Lock()
+			continue
+		}
+		p.waitCond.Wait()
+	}
+	atomic.AddInt32(&p.waitGroups, -1)
+	p.waitMtx.Unlock()
+	g.wg.Wait()
+}
+
+// setWaiting changes the number of callers waiting for packed responses,
+// it is incremented after the request is added to the batch
+// and decremented when the response is received.
+// The counters are atomic, waitMtx is only taken to wake FlushGroups
+// which are waiting, so Handler does not lock otherwise.
+func (p *Packer) setWaiting(delta int32) {
+	atomic.AddInt32(&p.waiting, delta)
+	if delta > 0 {
+		atomic.AddUint32(&p.enqueued, 1)
+	}
+	p.wakeFlushGroups()
+}
+
+// wakeFlushGroups wakes waiting FlushGroups. The counters are changed
+// before waitGroups is read and Wait checks them after incrementing it
+// under waitMtx, so a change is never missed by the group.
+func (p *Packer) wakeFlushGroups() {
+	if atomic.LoadInt32(&p.waitGroups) == 0 {
+		return
+	}
+	p.waitMtx.Lock()
+	p.waitCond.Broadcast()
+	p.waitMtx.Unlock()
+}
@@ -0,0 +1,51 @@
+package packer
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+// StreamIDs passes ids of all items of the method which returns
+// {"count": N, "items": [id, ...]} to fn, fetching up to 25 pages
+// of pageSize ids per execute (see FetchPages).
+func (p *Packer) StreamIDs(method string, params api.Params, pageSize int, fn func(id int) error) error {
+	pageParams := api.Params{"count": pageSize}
+	for name, value := range params {
+		pageParams[name] = value
+	}
+
+	_, err := p.fetchAll(method, pageParams, 0, MaxPages, nil, func(raw json.RawMessage) error {
+		var id int
+		if err := p.decoder.Unmarshal(raw, &id); err != nil {
+			return fmt.Errorf("packer: %s: %w", method, err)
+		}
+		return fn(id)
+	})
+	return err
+}
+
+// GetAllFriends returns ids of all friends of the user.
+func (p *Packer) GetAllFriends(userID int) ([]int, error) {
+	return p.collectIDs("friends.get", api.Params{"user_id": userID}, 5000)
+}
+
+// GetAllGroups returns ids of all communities of the user.
+func (p *Packer) GetAllGroups(userID int) ([]int, error) {
+	return p.collectIDs("groups.get", api.Params{"user_id": userID}, 1000)
+}
+
+// GetAllFollowers returns ids of all followers of the user.
+func (p *Packer) GetAllFollowers(userID int) ([]int, error) {
+	return p.collectIDs("users.getFollowers", api.Params{"user_id": userID}, 1000)
+}
+
+func (p *Packer) collectIDs(method string, params api.Params, pageSize int) ([]int, error) {
+	var ids []int
+	err := p.StreamIDs(method, params, pageSize, func(id int) error {
+		ids = append(ids, id)
+		return nil
+	})
+	return ids, err
+}
@@ -0,0 +1,63 @@
+package packer
+
+import (
+	"context"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"golang.org/x/time/rate"
+)
+
+// Governor limits requests of several packers together, so the traffic
+// of the whole process stays under IP and app level limits of VK.
+type Governor struct {
+	limiter *rate.Limiter
+	slots   chan struct{}
+}
+
+// NewGovernor creates the governor which allows at most maxInFlight
+// concurrent requests and perSecond requests per second with the burst.
+// Zero values disable the limits.
+//
+//	g := packer.NewGovernor(20, 50, 10)
+//	p1, err := packer.New(vk1.Handler, packer.Govern(g))
+//	p2, err := packer.New(vk2.Handler, packer.Govern(g))
+func NewGovernor(maxInFlight int, perSecond rate.Limit, burst int) *Governor {
+	g := &Governor{}
+	if maxInFlight > 0 {
+		g.slots = make(chan struct{}, maxInFlight)
+	}
+	if perSecond > 0 {
+		g.limiter = rate.NewLimiter(perSecond, maxInt(burst, 1))
+	}
+	return g
+}
+
+// Govern makes all requests of the packer to VK, both execute
+// and sent directly, pass through the governor.
+func Govern(g *Governor) Option {
+	return func(p *Packer) {
+		p.vkHandler = g.Wrap(p.vkHandler)
+	}
+}
+
+// Wrap returns the handler which waits for the governor before each request,
+// e.g. to count requests made without packers.
+func (g *Governor) Wrap(next VKHandler) VKHandler {
+	return func(method string, params ...api.Params) (api.Response, error) {
+		if g.limiter != nil {
+			if err := g.limiter.Wait(context.Background()); err != nil {
+				return api.Response{}, err
+			}
+		}
+		if g.slots != nil {
+			g.slots <- struct{}{}
+			defer func() { <-g.slots }()
+		}
+		return next(method, params...)
+	}
+}
+
+// InFlight returns the number of requests being sent.
+func (g *Governor) InFlight() int {
+	return len(g.slots)
+}
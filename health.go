@@ -0,0 +1,116 @@
+package packer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+// HealthCheck sets thresholds used by Healthy, zero values disable the check.
+type HealthCheck struct {
+	// MaxPending is the number of pending requests.
+	MaxPending int
+	// MaxSilence is the time without successful execute requests
+	// while there are pending or in-flight requests.
+	MaxSilence time.Duration
+	// MaxFailures is the number of execute requests failed in a row.
+	MaxFailures int
+	// TokenFailures is the number of auth errors in a row
+	// after which the token is considered dead.
+	TokenFailures int
+}
+
+// DefaultHealthCheck is used by Healthy unless Health is set.
+var DefaultHealthCheck = HealthCheck{
+	MaxSilence:    time.Minute,
+	MaxFailures:   10,
+	TokenFailures: 3,
+}
+
+// Health sets thresholds of Healthy.
+func Health(hc HealthCheck) Option {
+	return func(p *Packer) {
+		p.healthCheck = hc
+	}
+}
+
+// health tracks results of execute requests.
+type health struct {
+	mtx           sync.Mutex
+	start         time.Time
+	lastSuccess   time.Time
+	failures      int
+	tokenFailures map[string]int
+}
+
+func (h *health) observe(token string, err error) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if err == nil {
+		h.lastSuccess = time.Now()
+		h.failures = 0
+		delete(h.tokenFailures, token)
+		return
+	}
+	h.failures++
+	if errors.Is(err, api.ErrAuth) {
+		if h.tokenFailures == nil {
+			h.tokenFailures = make(map[string]int)
+		}
+		h.tokenFailures[token]++
+	}
+}
+
+// Healthy returns the error describing why the packer is not healthy:
+// too many pending requests, execute requests failing in a row,
+// no successful execute for a long time while requests wait
+// or all tokens failing with auth errors (see HealthCheck).
+// It is cheap enough to be called by /healthz handlers.
+func (p *Packer) Healthy() error {
+	if p.isClosed() {
+		return ErrShutdown
+	}
+
+	hc := p.healthCheck
+	var problems []string
+	pending := p.Pending()
+	if hc.MaxPending > 0 && pending > hc.MaxPending {
+		problems = append(problems, fmt.Sprintf("%d pending requests (max %d)", pending, hc.MaxPending))
+	}
+
+	p.health.mtx.Lock()
+	last, failures := p.health.lastSuccess, p.health.failures
+	dead := 0
+	if hc.TokenFailures > 0 {
+		for _, n := range p.health.tokenFailures {
+			if n >= hc.TokenFailures {
+				dead++
+			}
+		}
+	}
+	p.health.mtx.Unlock()
+
+	if hc.MaxFailures > 0 && failures >= hc.MaxFailures {
+		problems = append(problems, fmt.Sprintf("%d execute requests failed in a row", failures))
+	}
+	if last.IsZero() {
+		last = p.health.start
+	}
+	waiting := atomic.LoadInt32(&p.waiting)
+	if hc.MaxSilence > 0 && (pending > 0 || waiting > 0) && time.Since(last) > hc.MaxSilence {
+		problems = append(problems, fmt.Sprintf("no successful execute for more than %s", hc.MaxSilence))
+	}
+	if tokens := p.tokenPool.Len(); tokens > 0 && dead >= tokens {
+		problems = append(problems, "all tokens failed with auth errors")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("packer: unhealthy: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package packer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+// Iterate returns the iterator over items of the paginated method
+// which returns {"count": N, "<field>": [...]} or "next_from"
+// which is passed as "start_from" param of the next page.
+// Pages are requested through Handler with FlushAfter, so they are packed
+// together with other pending requests but do not wait for the flush timer.
+// Iteration stops after the first error.
+//
+// With Go 1.23+ the iterator can be ranged over:
+//
+//	for user, err := range packer.Iterate[object.UsersUser](p, "groups.getMembers", params, "items") {
+//		...
+//	}
+func Iterate[T any](p *Packer, method string, params api.Params, field string) func(yield func(T, error) bool) {
+	return func(yield func(T, error) bool) {
+		var zero T
+		pageParams := make(api.Params, len(params))
+		for name, value := range params {
+			pageParams[name] = value
+		}
+		ctx := paramsContext(params)
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		pageParams[":context"] = FlushAfter(ctx)
+		offset, _ := strconv.Atoi(encodeParam(p.paramEncoders, pageParams["offset"]))
+
+		for {
+			resp, err := p.Handler(method, pageParams)
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+
+			var page map[string]json.RawMessage
+			if err := p.decoder.Unmarshal(resp.Response, &page); err != nil {
+				yield(zero, fmt.Errorf("packer: iterate %s: %w", method, err))
+				return
+			}
+			var items []json.RawMessage
+			if raw, ok := page[field]; ok {
+				if err := p.decoder.Unmarshal(raw, &items); err != nil {
+					yield(zero, fmt.Errorf("packer: iterate %s: %s: %w", method, field, err))
+					return
+				}
+			}
+
+			for _, raw := range items {
+				var item T
+				if err := p.decoder.Unmarshal(raw, &item); err != nil {
+					yield(zero, fmt.Errorf("packer: iterate %s: %w", method, err))
+					return
+				}
+				if !yield(item, nil) {
+					return
+				}
+			}
+
+			if raw, ok := page["next_from"]; ok {
+				var nextFrom string
+				if err := p.decoder.Unmarshal(raw, &nextFrom); err != nil || nextFrom == "" {
+					return
+				}
+				pageParams["start_from"] = nextFrom
+				continue
+			}
+
+			var count int
+			if raw, ok := page["count"]; ok {
+				_ = p.decoder.Unmarshal(raw, &count)
+			}
+			offset += len(items)
+			if len(items) == 0 || offset >= count {
+				return
+			}
+			pageParams["offset"] = offset
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package packer
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Job is the handle of the long running bulk operation
+// which can be monitored, paused and cancelled.
+type Job struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mtx      sync.Mutex
+	cond     *sync.Cond
+	progress Progress
+	start    time.Time
+	paused   bool
+	pausedAt time.Time
+	idle     time.Duration
+
+	done chan struct{}
+	err  error
+}
+
+type jobConfig struct {
+	interval time.Duration
+	report   func(Progress)
+}
+
+// JobOption - StartJob option
+type JobOption func(*jobConfig)
+
+// JobProgressInterval makes the job call fn with its progress every interval.
+func JobProgressInterval(interval time.Duration, fn func(Progress)) JobOption {
+	return func(c *jobConfig) {
+		c.interval = interval
+		c.report = fn
+	}
+}
+
+// StartJob runs the bulk operation in background. run should pass j.Context()
+// to the operation and report the progress with j.Report or j.Add,
+// these calls block while the job is paused:
+//
+//	job := packer.StartJob(func(j *packer.Job) error {
+//		return p.EnumerateMembers(j.Context(), groupID, packer.MembersOptions{OnProgress: j.Report}, save)
+//	})
+func StartJob(run func(j *Job) error, opts ...JobOption) *Job {
+	var cfg jobConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &Job{ctx: ctx, cancel: cancel, start: time.Now(), done: make(chan struct{})}
+	j.cond = sync.NewCond(&j.mtx)
+
+	if cfg.interval > 0 {
+		go j.reportEvery(cfg.interval, cfg.report)
+	}
+	go func() {
+		err := run(j)
+		j.mtx.Lock()
+		j.err = err
+		j.mtx.Unlock()
+		cancel()
+		close(j.done)
+	}()
+	return j
+}
+
+func (j *Job) reportEvery(interval time.Duration, fn func(Progress)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			fn(j.Progress())
+		case <-j.done:
+			fn(j.Progress())
+			return
+		}
+	}
+}
+
+// Context returns the context of the job which is done when it is cancelled or finished.
+func (j *Job) Context() context.Context {
+	return j.ctx
+}
+
+// Report sets the progress of the job (only Done and Total are used).
+func (j *Job) Report(pr Progress) {
+	j.mtx.Lock()
+	j.progress.Done, j.progress.Total = pr.Done, pr.Total
+	j.waitResumed()
+	j.mtx.Unlock()
+}
+
+// Add adds n items to the progress of the job.
+func (j *Job) Add(n int) {
+	j.mtx.Lock()
+	j.progress.Done += n
+	j.waitResumed()
+	j.mtx.Unlock()
+}
+
+// SetTotal sets the total number of items, if it is known.
+func (j *Job) SetTotal(total int) {
+	j.mtx.Lock()
+	j.progress.Total = total
+	j.mtx.Unlock()
+}
+
+// waitResumed blocks while the job is paused, must be called with j.mtx held.
+func (j *Job) waitResumed() {
+	for j.paused && j.ctx.Err() == nil {
+		j.cond.Wait()
+	}
+}
+
+// Progress returns the progress of the job, time of pauses is not counted.
+func (j *Job) Progress() Progress {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+
+	pr := j.progress
+	elapsed := time.Since(j.start) - j.idle
+	if j.paused {
+		elapsed -= time.Since(j.pausedAt)
+	}
+	if elapsed > 0 {
+		pr.Rate = float64(pr.Done) / elapsed.Seconds()
+	}
+	if pr.Done > 0 && pr.Done < pr.Total {
+		pr.ETA = elapsed * time.Duration(pr.Total-pr.Done) / time.Duration(pr.Done)
+	}
+	return pr
+}
+
+// Pause makes the job stop on the next progress report until Resume.
+func (j *Job) Pause() {
+	j.mtx.Lock()
+	if !j.paused {
+		j.paused = true
+		j.pausedAt = time.Now()
+	}
+	j.mtx.Unlock()
+}
+
+// Resume continues the paused job.
+func (j *Job) Resume() {
+	j.mtx.Lock()
+	if j.paused {
+		j.paused = false
+		j.idle += time.Since(j.pausedAt)
+		j.cond.Broadcast()
+	}
+	j.mtx.Unlock()
+}
+
+// Cancel cancels the context of the job and resumes it, if it is paused.
+func (j *Job) Cancel() {
+	j.cancel()
+	j.mtx.Lock()
+	j.cond.Broadcast()
+	j.mtx.Unlock()
+}
+
+// Done returns the channel which is closed when the job is finished.
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// Wait waits for the job and returns its error.
+func (j *Job) Wait() error {
+	<-j.done
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+	return j.err
+}
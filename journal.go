@@ -0,0 +1,145 @@
+package packer
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// JournalBatch is the batch recorded in the Journal.
+type JournalBatch struct {
+	ID       string    `json:"id"`
+	Requests []Request `json:"requests"`
+}
+
+// Journal records dispatched batches and their outcomes.
+// Implementations must be safe for concurrent use.
+type Journal interface {
+	// Dispatched records the batch right before the execute request is sent.
+	Dispatched(b JournalBatch) error
+	// Completed records that the response of the batch is received.
+	Completed(id string) error
+	// Unfinished returns batches which were dispatched but not completed.
+	Unfinished() ([]JournalBatch, error)
+}
+
+// WriteAheadLog makes the packer record every batch in the journal before
+// it is sent and after its response is received. Batches without
+// recorded response (e.g. on crash or network error) may or may not have
+// been executed by VK, use Reconcile to handle them after restart.
+// If the batch cannot be recorded it is not sent.
+// Access tokens of requests are not recorded.
+func WriteAheadLog(j Journal) Option {
+	return func(p *Packer) {
+		p.journal = j
+	}
+}
+
+// Reconcile calls fn for every batch with unknown outcome left
+// by previous runs. Batches for which fn returns nil are marked completed,
+// the first error stops reconciliation.
+func (p *Packer) Reconcile(fn func(b JournalBatch) error) error {
+	if p.journal == nil {
+		return nil
+	}
+
+	batches, err := p.journal.Unfinished()
+	if err != nil {
+		return fmt.Errorf("packer: journal: %w", err)
+	}
+	for _, b := range batches {
+		if err := fn(b); err != nil {
+			return err
+		}
+		if err := p.journal.Completed(b.ID); err != nil {
+			return fmt.Errorf("packer: journal: %w", err)
+		}
+	}
+	return nil
+}
+
+// journalBatch records the batch as dispatched and returns its id.
+func (p *Packer) journalBatch(bat batch) (string, error) {
+	b := JournalBatch{ID: p.newID(), Requests: make([]Request, len(bat))}
+	for i, req := range bat {
+		b.Requests[i] = Request{req.method, p.storedParams(req.params...)}
+	}
+	if err := p.journal.Dispatched(b); err != nil {
+		return "", fmt.Errorf("packer: journal: %w", err)
+	}
+	return b.ID, nil
+}
+
+// journalRecord is the line of the journal file.
+type journalRecord struct {
+	Dispatched *JournalBatch `json:"dispatched,omitempty"`
+	Completed  string        `json:"completed,omitempty"`
+}
+
+type fileJournal struct {
+	log *fileLog
+}
+
+// NewFileJournal opens the journal stored in the file at path,
+// the file is created if it does not exist.
+// Completed batches are dropped from the file when it is opened.
+func NewFileJournal(path string) (Journal, error) {
+	unfinished, err := readJournalFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]interface{}, len(unfinished))
+	for i := range unfinished {
+		records[i] = journalRecord{Dispatched: &unfinished[i]}
+	}
+	l, err := rewriteLog(path, records)
+	if err != nil {
+		return nil, err
+	}
+	return &fileJournal{l}, nil
+}
+
+func readJournalFile(path string) ([]JournalBatch, error) {
+	var (
+		order      []string
+		dispatched = make(map[string]JournalBatch)
+	)
+	err := readLog(path, func(line []byte) {
+		var rec journalRecord
+		if json.Unmarshal(line, &rec) != nil {
+			return
+		}
+		if rec.Dispatched != nil {
+			order = append(order, rec.Dispatched.ID)
+			dispatched[rec.Dispatched.ID] = *rec.Dispatched
+		}
+		if rec.Completed != "" {
+			delete(dispatched, rec.Completed)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	unfinished := make([]JournalBatch, 0, len(dispatched))
+	for _, id := range order {
+		if b, ok := dispatched[id]; ok {
+			unfinished = append(unfinished, b)
+		}
+	}
+	return unfinished, nil
+}
+
+func (j *fileJournal) Dispatched(b JournalBatch) error {
+	return j.log.write(journalRecord{Dispatched: &b})
+}
+
+func (j *fileJournal) Completed(id string) error {
+	return j.log.write(journalRecord{Completed: id})
+}
+
+func (j *fileJournal) Unfinished() ([]JournalBatch, error) {
+	j.log.mtx.Lock()
+	defer j.log.mtx.Unlock()
+	return readJournalFile(j.log.path)
+}
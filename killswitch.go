@@ -0,0 +1,60 @@
+package packer
+
+import (
+	"os"
+	"strconv"
+	"sync/atomic"
+)
+
+// Disabled makes the packer start in pass-through mode, see Disable.
+// The packer also starts disabled if VKPACKER_DISABLED environment
+// variable is true, so packing can be turned off without code changes.
+func Disabled() Option {
+	return func(p *Packer) {
+		p.disabled = 1
+	}
+}
+
+// disabledByEnv reports whether VKPACKER_DISABLED is true.
+func disabledByEnv() bool {
+	disabled, _ := strconv.ParseBool(os.Getenv(DefaultEnvPrefix + "_DISABLED"))
+	return disabled
+}
+
+// Disable switches the packer to pass-through mode: new requests
+// are sent directly to the handler passed to New and pending batches are flushed.
+// It is the emergency switch for cases when execute itself is suspected.
+func (p *Packer) Disable() {
+	if atomic.SwapInt32(&p.disabled, 1) == 0 {
+		p.Send()
+	}
+}
+
+// Enable switches the packer back to packing requests.
+func (p *Packer) Enable() {
+	atomic.StoreInt32(&p.disabled, 0)
+}
+
+// Enabled reports whether requests are packed.
+func (p *Packer) Enabled() bool {
+	return atomic.LoadInt32(&p.disabled) == 0
+}
+
+// Pause stops sending batches: requests are collected in pending batches,
+// Send and full batches are not sent until Resume. Requests sent alone
+// (see LargeRequests) and Close are not affected.
+func (p *Packer) Pause() {
+	atomic.StoreInt32(&p.paused, 1)
+}
+
+// Resume resumes sending batches and sends the pending ones.
+func (p *Packer) Resume() {
+	if atomic.SwapInt32(&p.paused, 0) == 1 {
+		p.Send()
+	}
+}
+
+// Paused reports whether sending is paused by Pause.
+func (p *Packer) Paused() bool {
+	return atomic.LoadInt32(&p.paused) == 1
+}
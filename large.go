@@ -0,0 +1,43 @@
+package packer
+
+import (
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+// LargePolicy defines how requests with large params are sent.
+type LargePolicy int
+
+const (
+	// LargeBypass sends large requests directly.
+	LargeBypass LargePolicy = iota
+	// LargeSolo packs each large request into its own execute.
+	LargeSolo
+)
+
+// LargeRequests sets the policy for requests which params take more than
+// size bytes when encoded, e.g. long messages with keyboards which
+// would take most of the execute code budget.
+func LargeRequests(size int, policy LargePolicy) Option {
+	return func(p *Packer) {
+		p.largeSize = size
+		p.largePolicy = policy
+	}
+}
+
+// isLarge reports whether encoded params of the request exceed the size
+// set by LargeRequests.
+func (p *Packer) isLarge(params ...api.Params) bool {
+	if p.largeSize <= 0 {
+		return false
+	}
+
+	return p.paramsSize(params...) > p.largeSize
+}
+
+// pushSolo sends the request in its own batch. Runs on the dispatcher.
+func (p *Packer) pushSolo(key batchKey, req request) {
+	pending := &pendingBatch{created: time.Now()}
+	p.dispatchBatch(key, p.batchInfo(pending, FlushLarge), batch{p.expire(req)})
+}
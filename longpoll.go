@@ -0,0 +1,37 @@
+package packer
+
+import (
+	"context"
+	"log"
+
+	"github.com/SevereCloud/vksdk/v2/events"
+	longpoll "github.com/SevereCloud/vksdk/v2/longpoll-bot"
+)
+
+// LongPoll makes the long poll loop handle events with the handlers.
+// Events of one long poll response are handled concurrently and API calls
+// made by the handlers are packed together and sent without timers,
+// the next response is requested when all handlers returned.
+//
+//	handlers := events.NewFuncList()
+//	handlers.MessageNew(func(ctx context.Context, obj events.MessageNewObject) { ... })
+//	p.LongPoll(lp, handlers)
+//	lp.Run()
+func (p *Packer) LongPoll(lp *longpoll.LongPoll, handlers *events.FuncList) {
+	group := p.NewFlushGroup()
+	handle := func(ctx context.Context, e events.GroupEvent) {
+		group.Go(func() {
+			if err := handlers.Handler(ctx, e); err != nil && p.debug {
+				log.Printf("packer: long poll event %s: %v\n", e.Type, err)
+			}
+		})
+	}
+	for _, eventType := range handlers.ListEvents() {
+		lp.OnEvent(eventType, handle)
+	}
+
+	lp.FullResponse(func(longpoll.Response) {
+		group.Wait()
+		group = p.NewFlushGroup()
+	})
+}
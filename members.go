@@ -0,0 +1,141 @@
+package packer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+// Progress describes the progress of the long running fetch.
+type Progress struct {
+	Done  int
+	Total int
+	// Rate is the number of items done per second.
+	Rate float64
+	// ETA is the estimated time left.
+	ETA time.Duration
+}
+
+// MembersOptions - EnumerateMembers options
+type MembersOptions struct {
+	// Parallelism is the number of executes of each token
+	// running at the same time (1 by default).
+	Parallelism int
+	// OnProgress is called after each execute.
+	OnProgress func(Progress)
+}
+
+// EnumerateMembers fetches ids of all members of the community.
+// Each execute fetches 25 pages of groups.getMembers, every token of the pool
+// sends its own executes (see TokenRateLimit) taking the next part of members
+// when the previous one is done, so faster tokens fetch more. fn is called with ids of each execute,
+// not in order but never concurrently. Fetching stops when ctx is done
+// or fn returns an error.
+func (p *Packer) EnumerateMembers(ctx context.Context, groupID int, opts MembersOptions, fn func(ids []int) error) error {
+	const pageSize = 1000
+	params := api.Params{"group_id": groupID, "count": pageSize}
+
+	var (
+		mtx      sync.Mutex
+		progress Progress
+		start    = time.Now()
+	)
+	fetch := func(token string, offset int) (Page, error) {
+		shard := api.Params{"offset": offset}
+		for name, value := range params {
+			shard[name] = value
+		}
+		page, err := p.fetchPages(token, "groups.getMembers", shard, MaxPages)
+		if err != nil {
+			return page, p.decorate("groups.getMembers", err)
+		}
+
+		ids := make([]int, len(page.Items))
+		for i, raw := range page.Items {
+			if err := p.decoder.Unmarshal(raw, &ids[i]); err != nil {
+				return page, fmt.Errorf("packer: members: %w", err)
+			}
+		}
+
+		mtx.Lock()
+		defer mtx.Unlock()
+		if err := ctx.Err(); err != nil {
+			return page, err
+		}
+		if err := fn(ids); err != nil {
+			return page, err
+		}
+		progress.Done += len(ids)
+		progress.Total = page.Count
+		elapsed := time.Since(start)
+		progress.Rate = float64(progress.Done) / elapsed.Seconds()
+		if progress.Done > 0 && progress.Done < progress.Total {
+			progress.ETA = elapsed * time.Duration(progress.Total-progress.Done) / time.Duration(progress.Done)
+		} else {
+			progress.ETA = 0
+		}
+		if opts.OnProgress != nil {
+			opts.OnProgress(progress)
+		}
+		return page, nil
+	}
+
+	// the first execute reports the number of members
+	first, err := fetch("", 0)
+	if err != nil || first.Done() {
+		return err
+	}
+
+	parallelism := opts.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	var workers []string
+	for _, token := range p.tokenPool.All() {
+		for i := 0; i < parallelism; i++ {
+			workers = append(workers, token)
+		}
+	}
+
+	offsets := make(chan int, first.Count/(pageSize*MaxPages)+1)
+	for offset := first.Offset; offset < first.Count; offset += pageSize * MaxPages {
+		offsets <- offset
+	}
+	close(offsets)
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+		stop     = make(chan struct{})
+	)
+	wg.Add(len(workers))
+	for _, token := range workers {
+		go func(token string) {
+			defer wg.Done()
+			for offset := range offsets {
+				err := ctx.Err()
+				if err == nil {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+					_, err = fetch(token, offset)
+				}
+				if err != nil {
+					once.Do(func() {
+						firstErr = err
+						close(stop)
+					})
+					return
+				}
+			}
+		}(token)
+	}
+	wg.Wait()
+	return firstErr
+}
@@ -0,0 +1,104 @@
+package packer
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+// MaxPendingBytes limits the approximate size of params of packed requests
+// waiting for their responses, e.g. to keep a flood of long messages
+// from exhausting memory. Handler blocks while the limit would be exceeded
+// until other requests complete, the context of the request
+// (see api.Params.WithContext) is done or the packer is closed.
+// The request larger than the limit is admitted when nothing else is pending.
+func MaxPendingBytes(max int) Option {
+	return func(p *Packer) {
+		p.memory = &memoryLimit{max: max, changed: make(chan struct{})}
+	}
+}
+
+// memoryLimit counts bytes of pending requests.
+type memoryLimit struct {
+	mtx     sync.Mutex
+	used    int
+	max     int
+	changed chan struct{}
+}
+
+// PendingBytes returns the approximate size of params of packed requests
+// waiting for their responses, it is counted only if MaxPendingBytes is set.
+func (p *Packer) PendingBytes() int {
+	if p.memory == nil {
+		return 0
+	}
+	p.memory.mtx.Lock()
+	defer p.memory.mtx.Unlock()
+	return p.memory.used
+}
+
+// paramsSize returns the approximate size of encoded params.
+func (p *Packer) paramsSize(params ...api.Params) int {
+	size := 0
+	iterateAll(func(name string, value interface{}) {
+		if !isExecuteParam(name) {
+			size += len(name) + len(encodeParam(p.paramEncoders, value))
+		}
+	}, params...)
+	return size
+}
+
+// acquireMemory waits until size bytes can be added to pending requests.
+func (p *Packer) acquireMemory(size int, params ...api.Params) error {
+	var done <-chan struct{}
+	if ctx := paramsContext(params...); ctx != nil {
+		done = ctx.Done()
+	}
+
+	m := p.memory
+	blocked := false
+	defer func() {
+		if blocked {
+			p.setBlocked(-1)
+		}
+	}()
+	for {
+		m.mtx.Lock()
+		if m.used == 0 || m.used+size <= m.max {
+			m.used += size
+			m.mtx.Unlock()
+			return nil
+		}
+		changed := m.changed
+		m.mtx.Unlock()
+
+		if !blocked {
+			// blocked callers are counted as waiting,
+			// so FlushGroup sends batches which hold the memory
+			blocked = true
+			p.setBlocked(1)
+		}
+		select {
+		case <-changed:
+		case <-done:
+			return paramsContext(params...).Err()
+		case <-p.stop:
+			return ErrShutdown
+		}
+	}
+}
+
+func (p *Packer) setBlocked(delta int32) {
+	atomic.AddInt32(&p.waiting, delta)
+	p.wakeFlushGroups()
+}
+
+func (p *Packer) releaseMemory(size int) {
+	m := p.memory
+	m.mtx.Lock()
+	m.used -= size
+	close(m.changed)
+	m.changed = make(chan struct{})
+	m.mtx.Unlock()
+}
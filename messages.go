@@ -0,0 +1,68 @@
+package packer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/SevereCloud/vksdk/v2/object"
+)
+
+// FetchConversations passes all conversations to fn using
+// execute-side loops of messages.getConversations (see FetchPages).
+// params are additional method params like "filter" or "extended".
+func (p *Packer) FetchConversations(params api.Params, fn func(object.MessagesConversationWithMessage) error) error {
+	pageParams := api.Params{"count": 200}
+	for name, value := range params {
+		pageParams[name] = value
+	}
+
+	_, err := p.fetchAll("messages.getConversations", pageParams, 0, MaxPages, nil, func(raw json.RawMessage) error {
+		var conv object.MessagesConversationWithMessage
+		if err := p.decoder.Unmarshal(raw, &conv); err != nil {
+			return fmt.Errorf("packer: conversations: %w", err)
+		}
+		return fn(conv)
+	})
+	return err
+}
+
+// HistoryOptions - FetchHistory options
+type HistoryOptions struct {
+	// Count is the maximum number of messages per peer, zero means all.
+	Count int
+	// Parallelism is the maximum number of peers fetched at the same time
+	// (4 batches by default).
+	Parallelism int
+	// OnMessages is called with each page of peer messages, newest first.
+	// It is called sequentially for the peer and concurrently for different peers,
+	// returned error stops fetching.
+	OnMessages func(peerID int, msgs []object.MessagesMessage) error
+	// Checkpointer saves completed peers, they are skipped
+	// when the job is restarted.
+	Checkpointer Checkpointer
+}
+
+// FetchHistory fetches messages.getHistory of many peers. Pages of different
+// peers are packed together, so one execute fetches up to 25 pages.
+// It returns the first error of OnMessages or API.
+func (p *Packer) FetchHistory(peerIDs []int, opts HistoryOptions) error {
+	cp, err := loadCheckpoint(opts.Checkpointer)
+	if err != nil {
+		return err
+	}
+
+	return p.forEach(len(peerIDs), opts.Parallelism, func(i int, stop <-chan struct{}) error {
+		peerID := peerIDs[i]
+		return cp.run(i, strconv.Itoa(peerID), stop, func() error {
+			params := api.Params{"peer_id": peerID}
+			return fetchPaged(p, "messages.getHistory", params, 200, opts.Count, stop, func(msgs []object.MessagesMessage) error {
+				if opts.OnMessages != nil {
+					return opts.OnMessages(peerID, msgs)
+				}
+				return nil
+			})
+		})
+	})
+}
@@ -0,0 +1,66 @@
+package packer
+
+import "github.com/SevereCloud/vksdk/v2/api"
+
+// RequestFunc proceeds the API request.
+type RequestFunc func(method string, params ...api.Params) (api.Response, error)
+
+// Use installs middlewares which are called for each request passed
+// to Handler before it is packed or sent directly.
+// The first middleware is the outermost one.
+func Use(mw ...func(next RequestFunc) RequestFunc) Option {
+	return func(p *Packer) {
+		p.middlewares = append(p.middlewares, mw...)
+	}
+}
+
+// ResponseFunc post-processes the response of the API request
+// and returns the response and the error which are passed further.
+type ResponseFunc func(method string, params []api.Params, resp api.Response, err error) (api.Response, error)
+
+// UseResponse installs functions which are called in order for the result
+// of each request passed to Handler, both packed and sent directly.
+func UseResponse(fns ...ResponseFunc) Option {
+	return func(p *Packer) {
+		p.responseFuncs = append(p.responseFuncs, fns...)
+	}
+}
+
+// buildHandler wraps dispatch with installed middlewares and response funcs.
+func (p *Packer) buildHandler() RequestFunc {
+	handler := RequestFunc(p.dispatch)
+	for i := len(p.middlewares) - 1; i >= 0; i-- {
+		handler = p.middlewares[i](handler)
+	}
+	if len(p.responseFuncs) == 0 {
+		return handler
+	}
+
+	next := handler
+	return func(method string, params ...api.Params) (api.Response, error) {
+		resp, err := next(method, params...)
+		for _, fn := range p.responseFuncs {
+			resp, err = fn(method, params, resp, err)
+		}
+		return resp, err
+	}
+}
+
+// Chain composes handler wrappers into one, the first wrapper is the outermost:
+// Chain(a, b)(h) is a(b(h)).
+//
+// Wrappers chained before the packer see every single request,
+// wrappers of the handler passed to New see only execute requests
+// and requests which are not packed, so rate limiters and retries
+// counting real API calls should go there:
+//
+//	p, err := packer.New(packer.Chain(retry, rateLimit)(vk.Handler))
+//	vk.Handler = packer.Chain(metrics)(p.Handler)
+func Chain(handlers ...func(VKHandler) VKHandler) func(VKHandler) VKHandler {
+	return func(next VKHandler) VKHandler {
+		for i := len(handlers) - 1; i >= 0; i-- {
+			next = handlers[i](next)
+		}
+		return next
+	}
+}
@@ -0,0 +1,71 @@
+package packer
+
+import (
+	"runtime"
+	"sync/atomic"
+	"unsafe"
+)
+
+// pushQueue is the lock-free multi-producer single-consumer queue
+// of push commands (the intrusive queue of Dmitry Vyukov). Producers
+// swap the head and link the previous one, the dispatcher pops from the tail,
+// so Handler never takes a lock on the way to the dispatcher.
+type pushQueue struct {
+	head      unsafe.Pointer // *pushCommand, swapped by producers
+	scheduled int32
+	_         [56]byte // keeps producers and the consumer on separate cache lines
+	tail      *pushCommand
+	stub      pushCommand
+}
+
+func (q *pushQueue) init() {
+	q.head = unsafe.Pointer(&q.stub)
+	q.tail = &q.stub
+}
+
+// push adds the command and reports whether the dispatcher must be woken.
+func (q *pushQueue) push(cmd *pushCommand) bool {
+	q.link(cmd)
+	return atomic.CompareAndSwapInt32(&q.scheduled, 0, 1)
+}
+
+func (q *pushQueue) link(cmd *pushCommand) {
+	atomic.StorePointer(&cmd.next, nil)
+	prev := (*pushCommand)(atomic.SwapPointer(&q.head, unsafe.Pointer(cmd)))
+	atomic.StorePointer(&prev.next, unsafe.Pointer(cmd))
+}
+
+// pop returns the oldest command or nil if the queue is empty.
+// A producer may have swapped the head but not linked it yet,
+// then pop waits for it, so commands pushed before the call are never missed.
+// Runs on the dispatcher.
+func (q *pushQueue) pop() *pushCommand {
+	for {
+		tail := q.tail
+		next := (*pushCommand)(atomic.LoadPointer(&tail.next))
+		if tail == &q.stub {
+			if next == nil {
+				if atomic.LoadPointer(&q.head) == unsafe.Pointer(tail) {
+					return nil
+				}
+				runtime.Gosched()
+				continue
+			}
+			q.tail, tail = next, next
+			next = (*pushCommand)(atomic.LoadPointer(&tail.next))
+		}
+		if next != nil {
+			q.tail = next
+			return tail
+		}
+		if atomic.LoadPointer(&q.head) == unsafe.Pointer(tail) {
+			// tail is the last command: put the stub behind it to take it.
+			q.link(&q.stub)
+			if next = (*pushCommand)(atomic.LoadPointer(&tail.next)); next != nil {
+				q.tail = next
+				return tail
+			}
+		}
+		runtime.Gosched()
+	}
+}
@@ -0,0 +1,46 @@
+package packer
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPushQueue(t *testing.T) {
+	var q pushQueue
+	q.init()
+	assert.Nil(t, q.pop())
+
+	producers, num := 8, 1000
+	var wg sync.WaitGroup
+	for i := 0; i < producers; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < num; j++ {
+				q.push(&pushCommand{method: string(rune('a' + i)), solo: j%2 == 0})
+			}
+		}()
+	}
+
+	// Commands of every producer are popped in the order they were pushed.
+	lastSolo := make(map[string]bool)
+	popped := 0
+	for popped < producers*num {
+		cmd := q.pop()
+		if cmd == nil {
+			continue
+		}
+		if last, ok := lastSolo[cmd.method]; ok {
+			assert.NotEqual(t, last, cmd.solo)
+		} else {
+			assert.True(t, cmd.solo)
+		}
+		lastSolo[cmd.method] = cmd.solo
+		popped++
+	}
+	wg.Wait()
+	assert.Nil(t, q.pop())
+}
@@ -0,0 +1,55 @@
+package packer
+
+import (
+	"context"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+// NoBatchParam is the param which makes the request sent directly
+// instead of being packed. Its value is ignored and it is not sent to VK:
+//
+//	vk.MessagesSetActivity(api.Params{"peer_id": peerID, "type": "typing", packer.NoBatchParam: true})
+const NoBatchParam = ":nobatch"
+
+type noBatchKey struct{}
+
+// NoBatch returns the context which makes requests made with it
+// (see api.Params.WithContext) sent directly, e.g. typing indicators
+// or payment confirmations which must not wait for the batch.
+func NoBatch(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noBatchKey{}, true)
+}
+
+// noBatch reports whether the request opted out of batching.
+func noBatch(params []api.Params) bool {
+	for _, p := range params {
+		if _, ok := p[NoBatchParam]; ok {
+			return true
+		}
+	}
+	if ctx := paramsContext(params...); ctx != nil {
+		skip, _ := ctx.Value(noBatchKey{}).(bool)
+		return skip
+	}
+	return false
+}
+
+// withoutNoBatch returns params without NoBatchParam,
+// params of the caller are not modified.
+func withoutNoBatch(params []api.Params) []api.Params {
+	stripped := make([]api.Params, len(params))
+	for i, p := range params {
+		if _, ok := p[NoBatchParam]; !ok {
+			stripped[i] = p
+			continue
+		}
+		stripped[i] = make(api.Params, len(p)-1)
+		for name, value := range p {
+			if name != NoBatchParam {
+				stripped[i][name] = value
+			}
+		}
+	}
+	return stripped
+}
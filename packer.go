@@ -1,12 +1,15 @@
 package packer
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/SevereCloud/vksdk/v2/api"
+	"golang.org/x/time/rate"
 )
 
 // VKHandler - alias to function which proceeds requests to VK API.
@@ -27,33 +30,122 @@ type Packer struct {
 	maxPackedRequests int
 	tokenPool         *tokenPool
 	tokenLazyLoading  bool
-	filterMode        FilterMode
-	filterMethods     map[string]struct{}
+	rules             ruleSet
+	profiles          map[string]Profile
+	profile           string
+	ruleFuncs         []func(string, api.Params) Decision
+	rulesMtx          sync.RWMutex
+	activeRules       atomic.Value // ruleSet
+	defaultBypass     bool
 	debug             bool
+	minify            bool
+	paramEncoders     []ParamEncoder
+	decoder           Decoder
 	vkHandler         VKHandler
-	batch             batch
-	mtx               sync.Mutex
+	baseHandler       VKHandler
+	options           []Option
+	version           string
+	injectVersion     bool
+	strictVersion     bool
+	procedure         string
+	execMethod        string
+	batchParams       api.Params
+	chunkRules        map[string]chunkRule
+	mergers           map[string]Merger
+	cacheTTLs         map[string]time.Duration
+	dedup             bool
+	dedupMethods      map[string]struct{}
+	flights           map[string]*flight
+	queue             Queue
+	journal           Journal
+	redis             *redisQueue
+	replyTimeout      time.Duration
+	shares            [numPriorities]int
+	scheduler         scheduler
+	limiter           *rate.Limiter
+	tokenLimit        rate.Limit
+	tokenBurst        int
+	tokenLimiters     map[string]*rate.Limiter
+	tokenLimMtx       sync.Mutex
+	tuneMtx           sync.RWMutex
+	retries           int
+	retryIf           func(method string) bool
+	retryBackoff      time.Duration
+	flushMtx          sync.Mutex
+	flushInterval     time.Duration
+	flushWake         chan struct{}
+	deterministic     bool
+	stop              chan struct{}
+	costs             map[string]int
+	maxCost           int
+	methodLimits      map[string]int
+	classify          func(string) MethodClass
+	classMax          map[MethodClass]int
+	classFlush        map[MethodClass]time.Duration
+	largeSize         int
+	largePolicy       LargePolicy
+	drainPolicy       DrainPolicy
+	drainDeadline     time.Duration
+	snapshotPath      string
+	healthCheck       HealthCheck
+	health            health
+	closed            int32
+	disabled          int32
+	paused            int32
+	commands          chan func()
+	queues            []pushQueue
+	queueHints        sync.Pool
+	queueSeq          uint32
+	exited            chan struct{}
+	late              int32
+	lateMtx           sync.Mutex
+	inflight          sync.WaitGroup
+	sending           int32
+	outstanding       map[*outstanding]struct{}
+	outMtx            sync.Mutex
+	spill             *spillFile
+	spillLimit        int
+	memory            *memoryLimit
+	pendingCount      int
+	ttls              map[string]time.Duration
+	onExpire          func(Request)
+	idSeq             uint64
+	cache             CacheStore
+	onRawResponse     func(BatchInfo, Request, json.RawMessage)
+	onBatch           func(BatchInfo, error)
+	middlewares       []func(RequestFunc) RequestFunc
+	responseFuncs     []ResponseFunc
+	decorateErr       func(method string, err error) error
+	handler           RequestFunc
+	waitMtx           sync.Mutex
+	waitCond          *sync.Cond
+	waiting           int32
+	enqueued          uint32
+	waitGroups        int32
+	batches           map[batchKey]*pendingBatch
+	batchSeq          uint64
 }
 
 // Option - Packer option
 type Option func(*Packer)
 
-// MaxPackedRequests sets the maximum API calls inside one batch.
+// MaxPackedRequests sets the maximum API calls inside one batch, from 1 to 25.
 func MaxPackedRequests(max int) Option {
-	if max < 1 || max > 25 {
-		max = 25
-	}
 	return func(p *Packer) {
 		p.maxPackedRequests = max
 	}
 }
 
-// Rules sets the batching rules (ignore some methods or allow it).
+// Rules adds the batching rules (ignore some methods or allow it).
+// Methods may be wildcard patterns like "messages.*".
+// Allow and Ignore rules can be mixed: exact names take precedence
+// over patterns and Ignore takes precedence over Allow of the same kind.
+// If there are Allow rules, methods not matched by any rule are not packed.
 func Rules(mode FilterMode, methods ...string) Option {
 	return func(p *Packer) {
+		set := p.rules.list(mode)
 		for _, m := range methods {
-			p.filterMode = mode
-			p.filterMethods[m] = struct{}{}
+			set.add(m)
 		}
 	}
 }
@@ -65,6 +157,23 @@ func Debug() Option {
 	}
 }
 
+// Version sets the API version used for requests without "v" param
+// and execute requests of the packer (api.Version by default).
+// Requests with different versions are never packed into the same batch.
+func Version(v string) Option {
+	return func(p *Packer) {
+		p.version = v
+	}
+}
+
+// NoMinify disables minification of the generated execute code.
+// Useful for debugging together with Debug().
+func NoMinify() Option {
+	return func(p *Packer) {
+		p.minify = false
+	}
+}
+
 // Tokens provides tokens which will be used for sending batch requests.
 // If tokens are not provided, packer will use tokens from incoming requests.
 func Tokens(tokens ...string) Option {
@@ -74,33 +183,141 @@ func Tokens(tokens ...string) Option {
 	}
 }
 
+// FlushInterval makes the packer call Send every interval until Close.
+func FlushInterval(interval time.Duration) Option {
+	return func(p *Packer) {
+		p.flushInterval = interval
+	}
+}
+
 // New creates a new Packer.
 //
 // NOTE: this method will not create any trigger for sending batches
 // which means that the batch will be sent only when the number of requests in it
 // equals to 'maxPackedRequests' (default 25, can be overwritten with MaxPackedRequests() option).
 // You will need to create your custom logic which sometimes will call packer.Send() method to solve this.
-func New(handler VKHandler, opts ...Option) *Packer {
+//
+// New returns the error if options are invalid or conflict with each other:
+// nil handler, out of range MaxPackedRequests, empty or malformed tokens,
+// methods both allowed and ignored by Rules, negative intervals and limits.
+func New(handler VKHandler, opts ...Option) (*Packer, error) {
 	p := &Packer{
 		tokenLazyLoading:  true,
 		tokenPool:         newTokenPool(),
 		maxPackedRequests: 25,
-		filterMode:        Ignore,
-		filterMethods:     make(map[string]struct{}),
+		defaultBypass:     true,
+		minify:            true,
+		decoder:           stdDecoder{},
+		rules:             newRuleSet(),
+		profiles:          make(map[string]Profile),
 		vkHandler:         handler,
-		batch:             make(batch),
+		baseHandler:       handler,
+		options:           opts,
+		version:           api.Version,
+		replyTimeout:      DefaultDistributedReplyTimeout,
+		execMethod:        "execute",
+		batches:           make(map[batchKey]*pendingBatch),
+		chunkRules:        make(map[string]chunkRule),
+		mergers:           make(map[string]Merger),
+		cacheTTLs:         make(map[string]time.Duration),
+		shares:            [numPriorities]int{0, 2, 1},
+		costs:             make(map[string]int),
+		methodLimits:      make(map[string]int),
+		classMax:          make(map[MethodClass]int),
+		classFlush:        make(map[MethodClass]time.Duration),
+		outstanding:       make(map[*outstanding]struct{}),
+		ttls:              make(map[string]time.Duration),
+		stop:              make(chan struct{}),
+		commands:          make(chan func(), commandBuffer),
+		queues:            make([]pushQueue, 1),
+		exited:            make(chan struct{}),
+		tokenLimiters:     make(map[string]*rate.Limiter),
+		healthCheck:       DefaultHealthCheck,
+		health:            health{start: time.Now()},
+	}
+	p.waitCond = sync.NewCond(&p.waitMtx)
+	if disabledByEnv() {
+		p.disabled = 1
+	}
+	for method, rule := range defaultChunkRules {
+		p.chunkRules[method] = rule
 	}
 	for _, opt := range opts {
 		opt(p)
 	}
+	if err := p.validateOptions(); err != nil {
+		return nil, err
+	}
+	p.publishRules()
+	if len(p.cacheTTLs) > 0 && p.cache == nil {
+		p.cache = NewLRUCache(DefaultCacheSize)
+	}
+	for i := range p.queues {
+		p.queues[i].init()
+	}
+	p.handler = p.buildHandler()
+	go p.dispatcherLoop()
+	if p.flushInterval > 0 && !p.deterministic {
+		p.startFlushLoop(p.flushInterval)
+	}
+	for class, interval := range p.classFlush {
+		if interval > 0 && !p.deterministic {
+			go p.classFlushLoop(class, interval)
+		}
+	}
+
+	return p, nil
+}
 
+// MustNew is like New but panics if options are invalid.
+func MustNew(handler VKHandler, opts ...Option) *Packer {
+	p, err := New(handler, opts...)
+	if err != nil {
+		panic(err)
+	}
 	return p
 }
 
+// startFlushLoop starts the flush loop, it is called under flushMtx
+// or before the packer is returned by New.
+func (p *Packer) startFlushLoop(interval time.Duration) {
+	wake := make(chan struct{}, 1)
+	p.flushWake = wake
+	go p.flushLoop(interval, wake)
+}
+
+// flushLoop calls Send every interval. When woken it rereads the interval
+// and stops if it is zero or another loop has replaced it.
+func (p *Packer) flushLoop(interval time.Duration, wake chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.Send()
+		case <-wake:
+			p.flushMtx.Lock()
+			interval, current := p.flushInterval, p.flushWake
+			p.flushMtx.Unlock()
+			if current != wake || interval <= 0 {
+				return
+			}
+			ticker.Reset(interval)
+		case <-p.stop:
+			return
+		}
+	}
+}
+
 // Default creates new Packer, wraps vk.Handler and creates
 // timeout-based trigger for sending batches every 2 seconds.
-func Default(vk *api.VK, opts ...Option) {
-	p := New(vk.Handler, opts...)
+// The version of batches is vk.Version unless Version option is passed.
+// vk.Handler is not changed if options are invalid.
+func Default(vk *api.VK, opts ...Option) error {
+	p, err := New(vk.Handler, append([]Option{Version(versionOf(vk))}, opts...)...)
+	if err != nil {
+		return err
+	}
 	vk.Handler = p.Handler
 	go func() {
 		for {
@@ -108,6 +325,27 @@ func Default(vk *api.VK, opts ...Option) {
 			p.Send()
 		}
 	}()
+	return nil
+}
+
+// Wrap creates new Packer and wraps vk.Handler like Default does.
+// restore puts the original handler back and closes the packer.
+// Batches are sent every 2 seconds unless FlushInterval option is passed.
+func Wrap(vk *api.VK, opts ...Option) (p *Packer, restore func(), err error) {
+	original := vk.Handler
+	p, err = New(original, append([]Option{Version(versionOf(vk)), FlushInterval(2 * time.Second)}, opts...)...)
+	if err != nil {
+		return nil, nil, err
+	}
+	vk.Handler = p.Handler
+
+	var once sync.Once
+	return p, func() {
+		once.Do(func() {
+			vk.Handler = original
+			p.Close()
+		})
+	}, nil
 }
 
 // Handler implements vk.Handler function, which proceeds requests to VK API.
@@ -116,61 +354,239 @@ func (p *Packer) Handler(method string, params ...api.Params) (api.Response, err
 		log.Printf("packer: Handler call (%s)\n", method)
 	}
 
-	if method == "execute" {
+	resp, err := p.handler(method, params...)
+	return resp, p.decorate(method, err)
+}
+
+// dispatch packs the request or sends it directly.
+func (p *Packer) dispatch(method string, params ...api.Params) (api.Response, error) {
+	if p.isClosed() {
+		return api.Response{}, ErrShutdown
+	}
+
+	if p.injectVersion || p.strictVersion {
+		var err error
+		if params, err = p.withVersion(method, params); err != nil {
+			return api.Response{}, err
+		}
+	}
+
+	if noBatch(params) {
+		return p.vkHandler(method, withoutNoBatch(params)...)
+	}
+
+	if p.isExecute(method) || !p.Enabled() {
 		return p.vkHandler(method, params...)
 	}
 
-	_, found := p.filterMethods[method]
-	if (p.filterMode == Allow && !found) ||
-		(p.filterMode == Ignore && found) {
+	if p.bypass(method, params...) ||
+		(p.largePolicy == LargeBypass && p.isLarge(params...)) {
 		return p.vkHandler(method, params...)
 	}
 
-	if p.tokenLazyLoading {
-		tokenIface, ok := getTokenFromParams(params...)
-		if !ok && p.tokenPool.Len() == 0 {
-			return api.Response{}, fmt.Errorf("packer: missing access_token param")
+	if len(params) > 1 {
+		params = []api.Params{mergeParams(params...)}
+	}
+
+	if err := p.validateCall(method, params...); err != nil {
+		return api.Response{}, err
+	}
+
+	if err := p.loadToken(params...); err != nil {
+		return api.Response{}, err
+	}
+
+	return p.cached(method, params, func() (api.Response, error) {
+		if chunks := p.chunk(method, params...); chunks != nil {
+			return p.enqueueChunks(method, chunks)
 		}
 
-		token, ok := tokenIface.(string)
-		if !ok && p.tokenPool.Len() == 0 {
-			return api.Response{}, fmt.Errorf("packer: bad access_token type")
+		return p.enqueue(method, params...)
+	})
+}
+
+// completion receives the response of the enqueued request.
+// Completions are pooled with their callbacks, so waiting
+// for the response does not allocate.
+type completion struct {
+	p        *Packer
+	resp     api.Response
+	err      error
+	wg       sync.WaitGroup
+	callback func(api.Response, error)
+}
+
+var completionPool = sync.Pool{
+	New: func() interface{} {
+		c := &completion{}
+		c.callback = c.done
+		return c
+	},
+}
+
+func (c *completion) done(resp api.Response, err error) {
+	c.resp, c.err = resp, err
+	c.p.setWaiting(-1)
+	c.wg.Done()
+}
+
+// enqueue appends the request to the batch and waits for the response.
+func (p *Packer) enqueue(method string, params ...api.Params) (api.Response, error) {
+	if pl := requestPlacement(params); pl != nil {
+		*pl = Placement{Enqueued: time.Now()}
+	}
+	if p.memory != nil {
+		size := p.paramsSize(params...)
+		if err := p.acquireMemory(size, params...); err != nil {
+			return api.Response{}, err
 		}
+		defer p.releaseMemory(size)
+	}
 
-		p.tokenPool.Append(token)
+	c := completionPool.Get().(*completion)
+	c.p = p
+	c.wg.Add(1)
+	defer func() {
+		c.p, c.resp, c.err = nil, api.Response{}, nil
+		completionPool.Put(c)
+	}()
+
+	handler := c.callback
+	if p.queue != nil {
+		var err error
+		if handler, err = p.persist(method, params, handler); err != nil {
+			c.wg.Done()
+			return api.Response{}, err
+		}
 	}
 
-	var (
-		resp api.Response
-		err  error
-		wg   sync.WaitGroup
-	)
+	if p.redis != nil {
+		if err := p.pushRemote(method, params, handler); err != nil {
+			c.wg.Done()
+			return api.Response{}, err
+		}
+	} else {
+		p.push(method, params, handler)
+	}
+	p.setWaiting(1)
+	c.wg.Wait()
+	return c.resp, c.err
+}
 
-	wg.Add(1)
-	handler := func(r api.Response, e error) {
-		resp = r
-		err = e
-		wg.Done()
+// push appends the request to the batch, callback is called with the response.
+func (p *Packer) push(method string, params []api.Params, callback func(api.Response, error)) {
+	key := p.batchKey(params...)
+	if p.classify != nil {
+		key.class = p.classify(method)
 	}
+	cmd := pushPool.Get().(*pushCommand)
+	cmd.p, cmd.key, cmd.solo = p, key, p.largePolicy == LargeSolo && p.isLarge(params...)
+	cmd.method, cmd.params, cmd.callback = method, params, callback
+	p.postPush(cmd)
+}
 
-	p.mtx.Lock()
-	p.batch.appendRequest(request{method, params, handler})
-	if len(p.batch) == p.maxPackedRequests {
-		go p.sendBatch(p.batch)
-		p.batch = make(batch)
+// add appends the request to the pending batch of the key
+// and dispatches the batch if it is full. Runs on the dispatcher.
+func (p *Packer) add(key batchKey, solo bool, method string, params []api.Params, callback func(api.Response, error)) {
+	if solo {
+		p.pushSolo(key, request{method: method, params: params, callback: callback})
+		return
 	}
-	p.mtx.Unlock()
 
-	wg.Wait()
-	return resp, err
+	pending := p.batches[key]
+	if pending == nil {
+		pending = &pendingBatch{created: time.Now()}
+		p.batches[key] = pending
+	}
+	req := request{method: method, params: params, callback: callback}
+	queue := &pending.queues[requestPriority(params).index()]
+	if *queue == nil {
+		*queue = make(batch, 0, p.maxPackedRequests)
+	}
+	attached := false
+	if m, ok := p.mergers[method]; ok {
+		*queue, attached = p.coalesce(*queue, m, method, params, callback)
+	} else if p.deduplicates(method) {
+		reqKey := p.flightKey(method, params...)
+		if attached = p.joinFlight(method, reqKey, callback); !attached {
+			req.callback = p.startFlight(reqKey, callback)
+			*queue = append(*queue, p.spillRequest(p.expire(req)))
+		}
+	} else {
+		*queue = append(*queue, p.spillRequest(p.expire(req)))
+	}
+	if attached {
+		if flushAfter(params) {
+			p.flushHinted(key, pending)
+		}
+		if pending.len() == 0 {
+			delete(p.batches, key)
+		}
+		return
+	}
+
+	limits := p.limits(key)
+	pending.cost += limits.costOf(method)
+	p.pendingCount++
+	for !p.deterministic && !p.Paused() && pending.len() > 0 && pending.full(limits) {
+		p.dispatchBatch(key, p.batchInfo(pending, FlushFull), p.take(pending, limits))
+	}
+	if flushAfter(params) {
+		p.flushHinted(key, pending)
+	}
+	if pending.len() == 0 {
+		delete(p.batches, key)
+	}
 }
 
-// Send sends current batch if it contains at least one request.
+// Send sends current batches if they contain at least one request.
 func (p *Packer) Send() {
-	p.mtx.Lock()
-	if len(p.batch) > 0 {
-		go p.sendBatch(p.batch)
-		p.batch = make(batch)
+	if p.Paused() {
+		return
 	}
-	p.mtx.Unlock()
+	if p.deterministic {
+		p.sendOrdered()
+		return
+	}
+	p.do(func() {
+		for key, pending := range p.batches {
+			limits := p.limits(key)
+			for pending.len() > 0 {
+				p.dispatchBatch(key, p.batchInfo(pending, FlushSend), p.take(pending, limits))
+			}
+		}
+		p.batches = make(map[batchKey]*pendingBatch)
+	})
+}
+
+// take takes the next batch from pending requests. Runs on the dispatcher.
+func (p *Packer) take(pending *pendingBatch, limits batchLimits) batch {
+	bat := pending.take(limits)
+	p.pendingCount -= len(bat)
+	return bat
+}
+
+func (p *Packer) loadToken(params ...api.Params) error {
+	if !p.tokenLazyLoading {
+		return nil
+	}
+
+	tokenIface, ok := getTokenFromParams(params...)
+	if !ok {
+		if p.tokenPool.Len() == 0 {
+			return fmt.Errorf("packer: missing access_token param")
+		}
+		return nil
+	}
+
+	token, ok := tokenIface.(string)
+	if !ok {
+		if p.tokenPool.Len() == 0 {
+			return fmt.Errorf("packer: bad access_token type")
+		}
+		return nil
+	}
+
+	p.tokenPool.Append(token)
+	return nil
 }
@@ -0,0 +1,79 @@
+package packertest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+// NewHTTPServer starts the HTTP server which serves VK API requests
+// at /method/ with s, so the code under test may use the real vksdk client
+// (see NewVK). The server must be closed after the test.
+func NewHTTPServer(s *Server) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method := strings.TrimPrefix(r.URL.Path, "/method/")
+		if err := r.ParseForm(); err != nil || method == r.URL.Path {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		params := api.Params{}
+		for name, values := range r.Form {
+			params[name] = values[0]
+		}
+
+		var body struct {
+			Response      json.RawMessage   `json:"response,omitempty"`
+			ExecuteErrors api.ExecuteErrors `json:"execute_errors,omitempty"`
+			Error         *api.Error        `json:"error,omitempty"`
+		}
+		resp, err := s.Handler(method, params)
+		body.Response, body.ExecuteErrors = resp.Response, resp.ExecuteErrors
+		if err != nil {
+			var vkErr api.Error
+			if ptr := (*api.Error)(nil); errors.As(err, &ptr) {
+				vkErr = *ptr
+			} else if !errors.As(err, &vkErr) {
+				vkErr = api.Error{Code: api.ErrUnknown, Message: err.Error()}
+			}
+			body.Response, body.Error = nil, &vkErr
+		} else if body.Response == nil {
+			body.Response = json.RawMessage("null")
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(body)
+	}))
+}
+
+// NewVK creates the vksdk client which sends requests to the server
+// started by NewHTTPServer. Client side rate limiting is disabled.
+func NewVK(ts *httptest.Server, token string) *api.VK {
+	vk := api.NewVK(token)
+	vk.MethodURL = ts.URL + "/method/"
+	vk.Client = ts.Client()
+	vk.Limit = 0
+	return vk
+}
+
+var errorMessages = map[api.ErrorType]string{
+	api.ErrTooMany: "Too many requests per second",
+	api.ErrRuntime: "Runtime error occurred during code invocation",
+}
+
+// InjectError makes the next n requests fail with the VK error as a whole,
+// e.g. api.ErrTooMany (6) or api.ErrRuntime (13) of the execute.
+func (s *Server) InjectError(code api.ErrorType, n int) *Server {
+	msg, ok := errorMessages[code]
+	if !ok {
+		msg = "Unknown error occurred"
+	}
+	for i := 0; i < n; i++ {
+		s.FailNext(&api.Error{Code: code, Message: msg})
+	}
+	return s
+}
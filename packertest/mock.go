@@ -0,0 +1,168 @@
+package packertest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+// TestingT is the part of *testing.T used by Mock.
+type TestingT interface {
+	Errorf(format string, args ...interface{})
+	Helper()
+}
+
+// Mode defines how Mock treats calls which are not expected.
+type Mode int
+
+const (
+	// Strict fails the test on unexpected calls.
+	Strict Mode = iota
+	// Lenient answers unexpected calls with null response.
+	Lenient
+)
+
+// Mock is the fake VK API which serves expected calls:
+//
+//	m := packertest.NewMock(t, packertest.Strict)
+//	m.ExpectMethod("users.get").WithParams(api.Params{"user_ids": 1}).Return([]object.UsersUser{{ID: 1}})
+//	m.ExpectMethod("wall.post").ReturnError(api.ErrAccess)
+//	p := packer.MustNew(m.Handler, packer.Tokens("token"))
+//	...
+//	m.Verify()
+//
+// Packed calls are served the same way as by Server.
+type Mock struct {
+	t    TestingT
+	mode Mode
+	srv  *Server
+
+	mtx          sync.Mutex
+	expectations []*Expectation
+}
+
+// Expectation is the call expected by Mock.
+type Expectation struct {
+	method string
+	params api.Params
+	resp   interface{}
+	err    error
+	times  int
+	calls  int
+}
+
+// NewMock creates the mock without expectations.
+func NewMock(t TestingT, mode Mode) *Mock {
+	m := &Mock{t: t, mode: mode, srv: NewServer()}
+	m.srv.fallback = m.call
+	return m
+}
+
+// ExpectMethod adds the expectation of the method call,
+// it is expected once unless Times is called.
+func (m *Mock) ExpectMethod(method string) *Expectation {
+	e := &Expectation{method: method, times: 1}
+	m.mtx.Lock()
+	m.expectations = append(m.expectations, e)
+	m.mtx.Unlock()
+	return e
+}
+
+// WithParams makes the expectation match only calls with the params,
+// values are compared as VK receives them, other params are ignored.
+func (e *Expectation) WithParams(params api.Params) *Expectation {
+	e.params = params
+	return e
+}
+
+// Return sets the response of the call.
+func (e *Expectation) Return(resp interface{}) *Expectation {
+	e.resp = resp
+	return e
+}
+
+// ReturnError makes the call fail with the error code.
+func (e *Expectation) ReturnError(code api.ErrorType) *Expectation {
+	e.err = &api.Error{Code: code, Message: fmt.Sprintf("packertest: error %d", code)}
+	return e
+}
+
+// Times sets the number of expected calls, 0 means any number.
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	return e
+}
+
+func (e *Expectation) match(call Call) bool {
+	if e.method != call.Method || e.times > 0 && e.calls >= e.times {
+		return false
+	}
+	for name, value := range e.params {
+		if format(value) != call.String(name) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *Expectation) String() string {
+	names := make([]string, 0, len(e.params))
+	for name := range e.params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var sb strings.Builder
+	sb.WriteString(e.method)
+	for _, name := range names {
+		fmt.Fprintf(&sb, " %s=%s", name, format(e.params[name]))
+	}
+	return sb.String()
+}
+
+// Handler is packer.VKHandler which serves requests.
+func (m *Mock) Handler(method string, params ...api.Params) (api.Response, error) {
+	return m.srv.Handler(method, params...)
+}
+
+func (m *Mock) call(call Call) (interface{}, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	for _, e := range m.expectations {
+		if e.match(call) {
+			e.calls++
+			return e.resp, e.err
+		}
+	}
+
+	if m.mode == Strict {
+		m.t.Helper()
+		m.t.Errorf("packertest: unexpected call %s %v", call.Method, call.Params)
+		return nil, &api.Error{Code: api.ErrMethod, Message: "packertest: unexpected call"}
+	}
+	return nil, nil
+}
+
+// Verify fails the test if some expected calls were not made.
+func (m *Mock) Verify() {
+	m.t.Helper()
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	for _, e := range m.expectations {
+		if e.times > 0 && e.calls < e.times {
+			m.t.Errorf("packertest: expected %d calls of %s, got %d", e.times, e, e.calls)
+		}
+	}
+}
+
+// Batches returns received execute requests.
+func (m *Mock) Batches() []Batch {
+	return m.srv.Batches()
+}
+
+// Calls returns all received calls, both packed and sent directly.
+func (m *Mock) Calls() []Call {
+	return m.srv.Calls()
+}
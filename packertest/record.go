@@ -0,0 +1,239 @@
+package packertest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	packer "github.com/zweihander/vk-execute-packer/v2"
+)
+
+// Recording is the request saved by Recorder.
+type Recording struct {
+	Method string `json:"method"`
+	// Token is the alias of the token like "token1", tokens are never saved.
+	Token  string            `json:"token,omitempty"`
+	Params map[string]string `json:"params,omitempty"`
+	// Code is the code of the execute request.
+	Code          string            `json:"code,omitempty"`
+	Response      json.RawMessage   `json:"response,omitempty"`
+	ExecuteErrors api.ExecuteErrors `json:"execute_errors,omitempty"`
+	// Error is the VK error, Failure is any other error.
+	Error   *api.Error `json:"error,omitempty"`
+	Failure string     `json:"failure,omitempty"`
+}
+
+func newRecording(method string, params ...api.Params) Recording {
+	rec := Recording{Method: method, Params: make(map[string]string)}
+	for _, p := range params {
+		for name, value := range p {
+			switch {
+			case name == "access_token" || strings.HasPrefix(name, ":"):
+			case name == "code" && method == "execute":
+				rec.Code = format(value)
+			default:
+				rec.Params[name] = format(value)
+			}
+		}
+	}
+	return rec
+}
+
+// key identifies the request, packed calls are compared by their params
+// since the order of params in the code is random.
+func (rec Recording) key() string {
+	names := make([]string, 0, len(rec.Params))
+	for name := range rec.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	sb.WriteString(rec.Method)
+	for _, name := range names {
+		sb.WriteString("&" + name + "=" + rec.Params[name])
+	}
+	if rec.Code == "" {
+		return sb.String()
+	}
+
+	prog, err := parseScript(rec.Code)
+	if err != nil {
+		sb.WriteString("\n" + rec.Code)
+		return sb.String()
+	}
+	writeCall := func(call *callExpr) {
+		params := append([]param(nil), call.params...)
+		sort.Slice(params, func(i, j int) bool { return params[i].name < params[j].name })
+		sb.WriteString("\n" + call.method)
+		for _, p := range params {
+			value := p.ref
+			if p.ref == "" {
+				value = strconv.Quote(format(p.value))
+			}
+			sb.WriteString("&" + p.name + "=" + value)
+		}
+	}
+	for _, v := range prog.vars {
+		sb.WriteString("\n" + v.name + "=")
+		writeCall(v.call)
+	}
+	for _, it := range prog.result {
+		switch {
+		case it.call != nil:
+			writeCall(it.call)
+		case it.capture != nil:
+			writeCall(&callExpr{params: it.capture})
+		default:
+			sb.WriteString("\n" + it.name)
+		}
+	}
+	return sb.String()
+}
+
+// Recorder passes requests to the handler and saves them
+// with responses to the directory, one JSON file per request.
+type Recorder struct {
+	handler packer.VKHandler
+	dir     string
+
+	mtx    sync.Mutex
+	seq    int
+	tokens map[string]string
+}
+
+// NewRecorder creates the recorder, the directory is created if needed.
+func NewRecorder(handler packer.VKHandler, dir string) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("packertest: record: %w", err)
+	}
+	return &Recorder{handler: handler, dir: dir, tokens: make(map[string]string)}, nil
+}
+
+// Handler is packer.VKHandler which records requests.
+func (r *Recorder) Handler(method string, params ...api.Params) (api.Response, error) {
+	resp, err := r.handler(method, params...)
+
+	rec := newRecording(method, params...)
+	rec.Response = resp.Response
+	rec.ExecuteErrors = resp.ExecuteErrors
+	if err != nil {
+		var vkErr api.Error
+		if ptr := (*api.Error)(nil); errors.As(err, &ptr) {
+			rec.Error = ptr
+		} else if errors.As(err, &vkErr) {
+			rec.Error = &vkErr
+		} else {
+			rec.Failure = err.Error()
+		}
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for _, p := range params {
+		if token, ok := p["access_token"].(string); ok {
+			if _, ok := r.tokens[token]; !ok {
+				r.tokens[token] = "token" + strconv.Itoa(len(r.tokens)+1)
+			}
+			rec.Token = r.tokens[token]
+		}
+	}
+
+	data, recErr := json.MarshalIndent(rec, "", "\t")
+	if recErr == nil {
+		r.seq++
+		recErr = os.WriteFile(filepath.Join(r.dir, fmt.Sprintf("%06d.json", r.seq)), append(data, '\n'), 0o644)
+	}
+	if recErr != nil {
+		return resp, fmt.Errorf("packertest: record: %w", recErr)
+	}
+	return resp, err
+}
+
+// Replayer serves responses saved by Recorder. Each recording
+// is served once, requests are matched by method and params.
+type Replayer struct {
+	mtx        sync.Mutex
+	recordings []Recording
+	keys       []string
+	used       []bool
+}
+
+// NewReplayer loads recordings from the directory.
+func NewReplayer(dir string) (*Replayer, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("packertest: replay: %w", err)
+	}
+	sort.Strings(names)
+
+	r := &Replayer{}
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("packertest: replay: %w", err)
+		}
+		var rec Recording
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return nil, fmt.Errorf("packertest: replay: %s: %w", name, err)
+		}
+		if len(rec.Response) > 0 {
+			// responses are indented in files
+			var buf bytes.Buffer
+			if err := json.Compact(&buf, rec.Response); err != nil {
+				return nil, fmt.Errorf("packertest: replay: %s: %w", name, err)
+			}
+			rec.Response = buf.Bytes()
+		}
+		r.recordings = append(r.recordings, rec)
+		r.keys = append(r.keys, rec.key())
+	}
+	r.used = make([]bool, len(r.recordings))
+	return r, nil
+}
+
+// Handler is packer.VKHandler which serves recorded responses.
+func (r *Replayer) Handler(method string, params ...api.Params) (api.Response, error) {
+	key := newRecording(method, params...).key()
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for i, rec := range r.recordings {
+		if r.used[i] || r.keys[i] != key {
+			continue
+		}
+		r.used[i] = true
+
+		resp := api.Response{Response: rec.Response, ExecuteErrors: rec.ExecuteErrors}
+		switch {
+		case rec.Error != nil:
+			resp.Error = *rec.Error
+			return resp, rec.Error
+		case rec.Failure != "":
+			return resp, errors.New(rec.Failure)
+		}
+		return resp, nil
+	}
+	return api.Response{}, fmt.Errorf("packertest: replay: no recording of %s", method)
+}
+
+// Unused returns recordings which were not served.
+func (r *Replayer) Unused() []Recording {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	var unused []Recording
+	for i, rec := range r.recordings {
+		if !r.used[i] {
+			unused = append(unused, rec)
+		}
+	}
+	return unused
+}
@@ -0,0 +1,317 @@
+package packertest
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Call is the API call received by the server.
+//
+// Params hold strings and integers as they are written in the code,
+// references to results of previous calls are resolved to decoded JSON values.
+type Call struct {
+	Method string
+	Params map[string]interface{}
+}
+
+// String returns the param formatted as VK receives it.
+func (c Call) String(name string) string {
+	return format(c.Params[name])
+}
+
+func format(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		items := make([]string, rv.Len())
+		for i := range items {
+			items[i] = format(rv.Index(i).Interface())
+		}
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(value)
+}
+
+// program is the parsed code: variables assigned with API calls
+// and the returned list of calls or variables.
+type program struct {
+	vars   []assignment
+	result []item
+}
+
+type assignment struct {
+	name string
+	call *callExpr
+}
+
+// item is the variable, the call or the object of captured references.
+type item struct {
+	name    string
+	call    *callExpr
+	capture []param
+}
+
+type callExpr struct {
+	method string
+	params []param
+}
+
+type param struct {
+	name  string
+	value interface{}
+	ref   string
+}
+
+// script parses the code generated by the packer for packed batches
+// and pipelines. Other VKScript is not supported.
+type script struct {
+	code string
+	pos  int
+}
+
+func parseScript(code string) (program, error) {
+	s := &script{code: code}
+	var prog program
+	for {
+		s.skipSpace()
+		if s.consume("return") {
+			break
+		}
+		if !s.consume("var ") {
+			return prog, s.errorf("unsupported statement")
+		}
+		s.skipSpace()
+		name := s.ident()
+		s.skipSpace()
+		if !s.consume("=") {
+			return prog, s.errorf("expected =")
+		}
+		s.skipSpace()
+		call, err := s.call()
+		if err != nil {
+			return prog, err
+		}
+		prog.vars = append(prog.vars, assignment{name, call})
+		s.skipSpace()
+		if !s.consume(";") {
+			return prog, s.errorf("expected ;")
+		}
+	}
+
+	s.skipSpace()
+	if !s.consume("[") {
+		return prog, s.errorf("expected [")
+	}
+	for i := 0; ; i++ {
+		s.skipSpace()
+		if s.consume("]") {
+			break
+		}
+		if i > 0 && !s.consume(",") {
+			return prog, s.errorf("expected ,")
+		}
+		s.skipSpace()
+		if strings.HasPrefix(s.code[s.pos:], "API.") {
+			call, err := s.call()
+			if err != nil {
+				return prog, err
+			}
+			prog.result = append(prog.result, item{call: call})
+			continue
+		}
+		if s.consume("{") {
+			capture, err := s.object("}")
+			if err != nil {
+				return prog, err
+			}
+			prog.result = append(prog.result, item{capture: capture})
+			continue
+		}
+		name := s.ident()
+		if name == "" {
+			return prog, s.errorf("unsupported return item")
+		}
+		prog.result = append(prog.result, item{name: name})
+	}
+	s.skipSpace()
+	if !s.consume(";") {
+		return prog, s.errorf("expected ;")
+	}
+	s.skipSpace()
+	if s.pos != len(s.code) {
+		return prog, s.errorf("unexpected code after return")
+	}
+	return prog, nil
+}
+
+func (s *script) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("packertest: code at %d: "+format, append([]interface{}{s.pos}, args...)...)
+}
+
+func (s *script) skipSpace() {
+	for s.pos < len(s.code) && strings.IndexByte(" \t\r\n", s.code[s.pos]) >= 0 {
+		s.pos++
+	}
+}
+
+func (s *script) consume(prefix string) bool {
+	if strings.HasPrefix(s.code[s.pos:], prefix) {
+		s.pos += len(prefix)
+		return true
+	}
+	return false
+}
+
+func isIdent(c byte) bool {
+	return c == '_' || c == '.' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func (s *script) ident() string {
+	start := s.pos
+	for s.pos < len(s.code) && isIdent(s.code[s.pos]) {
+		s.pos++
+	}
+	return s.code[start:s.pos]
+}
+
+// call parses API.method({params}).
+func (s *script) call() (*callExpr, error) {
+	if !s.consume("API.") {
+		return nil, s.errorf("expected API call")
+	}
+	call := &callExpr{method: s.ident()}
+	if !s.consume("({") {
+		return nil, s.errorf("expected params of %s", call.method)
+	}
+	params, err := s.object("})")
+	if err != nil {
+		return nil, err
+	}
+	call.params = params
+	return call, nil
+}
+
+// object parses fields of the object literal up to the end.
+func (s *script) object(end string) ([]param, error) {
+	var params []param
+	for i := 0; ; i++ {
+		s.skipSpace()
+		if s.consume(end) {
+			return params, nil
+		}
+		if i > 0 && !s.consume(",") {
+			return nil, s.errorf("expected ,")
+		}
+		s.skipSpace()
+		name, err := s.string()
+		if err != nil {
+			return nil, err
+		}
+		s.skipSpace()
+		if !s.consume(":") {
+			return nil, s.errorf("expected :")
+		}
+		s.skipSpace()
+		p, err := s.value()
+		if err != nil {
+			return nil, err
+		}
+		p.name = name
+		params = append(params, p)
+	}
+}
+
+func (s *script) string() (string, error) {
+	if s.pos >= len(s.code) || s.code[s.pos] != '"' {
+		return "", s.errorf("expected string")
+	}
+	end := s.pos + 1
+	for end < len(s.code) && s.code[end] != '"' {
+		if s.code[end] == '\\' {
+			end++
+		}
+		end++
+	}
+	if end >= len(s.code) {
+		return "", s.errorf("unterminated string")
+	}
+	var str string
+	if err := json.Unmarshal([]byte(s.code[s.pos:end+1]), &str); err != nil {
+		return "", s.errorf("%v", err)
+	}
+	s.pos = end + 1
+	return str, nil
+}
+
+func (s *script) value() (param, error) {
+	if s.pos < len(s.code) && s.code[s.pos] == '"' {
+		str, err := s.string()
+		return param{value: str}, err
+	}
+
+	start := s.pos
+	for s.pos < len(s.code) && strings.IndexByte(",}", s.code[s.pos]) < 0 {
+		s.pos++
+	}
+	raw := strings.TrimSpace(s.code[start:s.pos])
+	if i, err := strconv.Atoi(raw); err == nil {
+		return param{value: i}, nil
+	}
+	if raw == "" {
+		return param{}, s.errorf("expected value")
+	}
+	return param{ref: raw}, nil
+}
+
+// resolve evaluates the reference like "s0.items@.id" against values of variables.
+func resolve(vars map[string]interface{}, ref string) (interface{}, error) {
+	parts := strings.Split(ref, ".")
+	value, ok := vars[parts[0]]
+	if !ok {
+		return nil, fmt.Errorf("packertest: unknown variable %q", parts[0])
+	}
+	return walk(value, parts[1:]), nil
+}
+
+// walk applies the path to the value, the path after "name@"
+// is applied to every item of the list.
+func walk(value interface{}, path []string) interface{} {
+	for i, part := range path {
+		if strings.HasSuffix(part, "@") {
+			items, _ := field(value, strings.TrimSuffix(part, "@")).([]interface{})
+			collected := make([]interface{}, len(items))
+			for j, item := range items {
+				collected[j] = walk(item, path[i+1:])
+			}
+			return collected
+		}
+		value = field(value, part)
+	}
+	return value
+}
+
+func field(value interface{}, name string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v[name]
+	case []interface{}:
+		if i, err := strconv.Atoi(name); err == nil && i >= 0 && i < len(v) {
+			return v[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+// Package packertest provides the in-memory fake of VK API
+// for testing code which uses the packer without hitting VK.
+package packertest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+// MethodFunc returns the response of the call, it is encoded to JSON
+// unless it is json.RawMessage. api.Error is returned to the packer
+// as is (inside execute_errors for packed calls), other errors become
+// api.ErrUnknown.
+type MethodFunc func(call Call) (interface{}, error)
+
+// Batch is the execute request received by the server.
+type Batch struct {
+	Code string
+	// Params are params of the execute itself like "v" and "access_token".
+	Params api.Params
+	Calls  []Call
+}
+
+// Server is the fake VK API. Its Handler parses the code of execute requests
+// generated by the packer, calls methods registered with Handle
+// and records received batches. Methods which are not registered
+// fail with api.ErrMethod.
+type Server struct {
+	mtx      sync.Mutex
+	methods  map[string]MethodFunc
+	fallback MethodFunc
+	// discard disables recording of requests.
+	discard  bool
+	failures []error
+	batches  []Batch
+	calls    []Call
+}
+
+// NewServer creates the server without methods.
+func NewServer() *Server {
+	return &Server{methods: make(map[string]MethodFunc)}
+}
+
+// Handle registers the method.
+func (s *Server) Handle(method string, fn MethodFunc) *Server {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.methods[method] = fn
+	return s
+}
+
+// Respond makes the method always return the response.
+func (s *Server) Respond(method string, response interface{}) *Server {
+	return s.Handle(method, func(Call) (interface{}, error) {
+		return response, nil
+	})
+}
+
+// Fail makes the method always fail with the error.
+func (s *Server) Fail(method string, code api.ErrorType, msg string) *Server {
+	return s.Handle(method, func(Call) (interface{}, error) {
+		return nil, &api.Error{Code: code, Message: msg}
+	})
+}
+
+// FailNext makes the next request to the server fail with err as a whole,
+// e.g. to test retries. Calls may be chained to fail several requests.
+func (s *Server) FailNext(err error) *Server {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.failures = append(s.failures, err)
+	return s
+}
+
+// Handler is packer.VKHandler which serves requests.
+func (s *Server) Handler(method string, params ...api.Params) (api.Response, error) {
+	merged := api.Params{}
+	for _, p := range params {
+		for name, value := range p {
+			merged[name] = value
+		}
+	}
+
+	s.mtx.Lock()
+	if len(s.failures) > 0 {
+		err := s.failures[0]
+		s.failures = s.failures[1:]
+		s.mtx.Unlock()
+		return api.Response{}, err
+	}
+	s.mtx.Unlock()
+
+	if method != "execute" {
+		call := Call{Method: method, Params: map[string]interface{}(merged)}
+		s.record(nil, call)
+		resp, vkErr := s.call(call)
+		if vkErr != nil {
+			return api.Response{Error: *vkErr}, vkErr
+		}
+		return api.Response{Response: resp}, nil
+	}
+
+	code, _ := merged["code"].(string)
+	delete(merged, "code")
+	return s.execute(code, merged)
+}
+
+func (s *Server) execute(code string, params api.Params) (api.Response, error) {
+	prog, err := parseScript(code)
+	if err != nil {
+		return api.Response{}, err
+	}
+
+	batch := &Batch{Code: code, Params: params}
+	var (
+		resp api.Response
+		vars = make(map[string]interface{})
+	)
+	eval := func(params []param) (map[string]interface{}, error) {
+		values := make(map[string]interface{}, len(params))
+		for _, p := range params {
+			values[p.name] = p.value
+			if p.ref != "" {
+				v, err := resolve(vars, p.ref)
+				if err != nil {
+					return nil, err
+				}
+				values[p.name] = v
+			}
+		}
+		return values, nil
+	}
+	run := func(expr *callExpr) (interface{}, error) {
+		params, err := eval(expr.params)
+		if err != nil {
+			return nil, err
+		}
+		call := Call{Method: expr.method, Params: params}
+		batch.Calls = append(batch.Calls, call)
+
+		body, vkErr := s.call(call)
+		if vkErr != nil {
+			resp.ExecuteErrors = append(resp.ExecuteErrors, api.ExecuteError{
+				Method: call.Method,
+				Code:   int(vkErr.Code),
+				Msg:    vkErr.Message,
+			})
+			return false, nil
+		}
+
+		var value interface{}
+		if err := json.Unmarshal(body, &value); err != nil {
+			return nil, fmt.Errorf("packertest: %s: %w", call.Method, err)
+		}
+		return value, nil
+	}
+
+	for _, v := range prog.vars {
+		if vars[v.name], err = run(v.call); err != nil {
+			return api.Response{}, err
+		}
+	}
+	result := make([]interface{}, len(prog.result))
+	for i, it := range prog.result {
+		switch {
+		case it.call != nil:
+			result[i], err = run(it.call)
+		case it.capture != nil:
+			result[i], err = eval(it.capture)
+		default:
+			result[i] = vars[it.name]
+		}
+		if err != nil {
+			return api.Response{}, err
+		}
+	}
+	s.record(batch)
+
+	if resp.Response, err = json.Marshal(result); err != nil {
+		return api.Response{}, err
+	}
+	return resp, nil
+}
+
+// call calls the method and converts its error to *api.Error.
+func (s *Server) call(call Call) (json.RawMessage, *api.Error) {
+	s.mtx.Lock()
+	fn, ok := s.methods[call.Method]
+	if !ok && s.fallback != nil {
+		fn, ok = s.fallback, true
+	}
+	s.mtx.Unlock()
+	if !ok {
+		return nil, &api.Error{Code: api.ErrMethod, Message: "Unknown method passed"}
+	}
+
+	resp, err := fn(call)
+	if err != nil {
+		var vkErr api.Error
+		if ptr := (*api.Error)(nil); errors.As(err, &ptr) {
+			vkErr = *ptr
+		} else if !errors.As(err, &vkErr) {
+			vkErr = api.Error{Code: api.ErrUnknown, Message: err.Error()}
+		}
+		return nil, &vkErr
+	}
+
+	if raw, ok := resp.(json.RawMessage); ok {
+		return raw, nil
+	}
+	raw, err := json.Marshal(resp)
+	if err != nil {
+		return nil, &api.Error{Code: api.ErrUnknown, Message: err.Error()}
+	}
+	return raw, nil
+}
+
+// record saves the batch or the direct call.
+func (s *Server) record(batch *Batch, direct ...Call) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.discard {
+		return
+	}
+	if batch != nil {
+		s.batches = append(s.batches, *batch)
+		s.calls = append(s.calls, batch.Calls...)
+	}
+	s.calls = append(s.calls, direct...)
+}
+
+// Batches returns received execute requests.
+func (s *Server) Batches() []Batch {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return append([]Batch(nil), s.batches...)
+}
+
+// Calls returns all received calls, both packed and sent directly.
+func (s *Server) Calls() []Call {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return append([]Call(nil), s.calls...)
+}
+
+// Reset forgets received requests, registered methods are kept.
+func (s *Server) Reset() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.batches = nil
+	s.calls = nil
+	s.failures = nil
+}
@@ -0,0 +1,264 @@
+package packertest
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	packer "github.com/zweihander/vk-execute-packer/v2"
+	"golang.org/x/time/rate"
+)
+
+// Latency returns the random latency of one request.
+type Latency func(r *rand.Rand) time.Duration
+
+// Constant is the latency which is always d.
+func Constant(d time.Duration) Latency {
+	return func(*rand.Rand) time.Duration { return d }
+}
+
+// Uniform is the latency distributed uniformly in [min, max).
+func Uniform(min, max time.Duration) Latency {
+	return func(r *rand.Rand) time.Duration {
+		if max <= min {
+			return min
+		}
+		return min + time.Duration(r.Int63n(int64(max-min)))
+	}
+}
+
+// LogNormal is the latency with the log-normal distribution, which is
+// close to latencies of real APIs: most requests take about median,
+// sigma controls the long tail (0.5 is a good start).
+func LogNormal(median time.Duration, sigma float64) Latency {
+	return func(r *rand.Rand) time.Duration {
+		return time.Duration(float64(median) * math.Exp(r.NormFloat64()*sigma))
+	}
+}
+
+// Simulation describes the modeled VK API.
+type Simulation struct {
+	// Latency is the latency of every request, CallLatency is added
+	// for every call packed into execute.
+	Latency     Latency
+	CallLatency Latency
+	// ErrorRate is the probability of a call to fail with api.ErrUnknown,
+	// packed calls fail inside execute_errors.
+	ErrorRate float64
+	// FailureRate is the probability of a request to fail as a whole
+	// with api.ErrRuntime.
+	FailureRate float64
+	// RateLimit is the number of requests per second per token,
+	// requests over the limit fail with api.ErrTooMany. Zero means no limit.
+	RateLimit float64
+	// Server serves the calls, every call returns 1 if it is nil.
+	Server *Server
+	// Seed makes the simulation reproducible.
+	Seed int64
+}
+
+// Simulator is the fake VK API modeled by Simulation,
+// it is used to load test the packer configuration locally.
+type Simulator struct {
+	sim Simulation
+	srv *Server
+
+	mtx      sync.Mutex
+	rand     *rand.Rand
+	limiters map[string]*rate.Limiter
+
+	requests, failures, limited int64
+}
+
+// NewSimulator creates the simulator.
+func NewSimulator(sim Simulation) *Simulator {
+	s := &Simulator{
+		sim:      sim,
+		srv:      &Server{methods: make(map[string]MethodFunc), discard: true},
+		rand:     rand.New(rand.NewSource(sim.Seed)),
+		limiters: make(map[string]*rate.Limiter),
+	}
+	s.srv.fallback = s.call
+	return s
+}
+
+// Handler is packer.VKHandler which serves requests after the modeled latency.
+func (s *Simulator) Handler(method string, params ...api.Params) (api.Response, error) {
+	atomic.AddInt64(&s.requests, 1)
+	var token, code string
+	for _, p := range params {
+		if v, ok := p["access_token"].(string); ok {
+			token = v
+		}
+		if v, ok := p["code"].(string); ok && method == "execute" {
+			code = v
+		}
+	}
+	n := 1
+	if method == "execute" {
+		n = strings.Count(code, "API.")
+	}
+
+	s.mtx.Lock()
+	limited := s.sim.RateLimit > 0 && !s.limiter(token).Allow()
+	latency := s.latency(s.sim.Latency)
+	for i := 0; i < n; i++ {
+		latency += s.latency(s.sim.CallLatency)
+	}
+	failed := s.roll(s.sim.FailureRate)
+	s.mtx.Unlock()
+
+	if limited {
+		atomic.AddInt64(&s.limited, 1)
+		return api.Response{}, &api.Error{Code: api.ErrTooMany, Message: errorMessages[api.ErrTooMany]}
+	}
+	time.Sleep(latency)
+	if failed {
+		atomic.AddInt64(&s.failures, 1)
+		return api.Response{}, &api.Error{Code: api.ErrRuntime, Message: errorMessages[api.ErrRuntime]}
+	}
+	return s.srv.Handler(method, params...)
+}
+
+func (s *Simulator) call(call Call) (interface{}, error) {
+	s.mtx.Lock()
+	failed := s.roll(s.sim.ErrorRate)
+	s.mtx.Unlock()
+	if failed {
+		return nil, &api.Error{Code: api.ErrUnknown, Message: "Unknown error occurred"}
+	}
+	if s.sim.Server == nil {
+		return 1, nil
+	}
+	resp, vkErr := s.sim.Server.call(call)
+	if vkErr != nil {
+		return nil, vkErr
+	}
+	return resp, nil
+}
+
+func (s *Simulator) limiter(token string) *rate.Limiter {
+	l, ok := s.limiters[token]
+	if !ok {
+		l = rate.NewLimiter(rate.Limit(s.sim.RateLimit), int(math.Ceil(s.sim.RateLimit)))
+		s.limiters[token] = l
+	}
+	return l
+}
+
+func (s *Simulator) latency(fn Latency) time.Duration {
+	if fn == nil {
+		return 0
+	}
+	if d := fn(s.rand); d > 0 {
+		return d
+	}
+	return 0
+}
+
+func (s *Simulator) roll(probability float64) bool {
+	return probability > 0 && s.rand.Float64() < probability
+}
+
+// Load is the workload of Simulate: Calls calls of the method
+// made by Concurrency goroutines.
+type Load struct {
+	Method      string
+	Params      api.Params
+	Calls       int
+	Concurrency int
+}
+
+// Report is the result of Simulate.
+type Report struct {
+	Calls, Failed int
+	// Requests is the number of requests received by the simulator,
+	// Limited and Failures of them failed with api.ErrTooMany
+	// and api.ErrRuntime.
+	Requests, Limited, Failures int
+	Duration                    time.Duration
+	// Throughput is the number of calls per second.
+	Throughput         float64
+	P50, P90, P99, Max time.Duration
+}
+
+// String formats the report for humans.
+func (r Report) String() string {
+	return fmt.Sprintf("%d calls (%d failed) in %s: %.1f calls/s, %d requests (%.1f calls/request, %d limited, %d failed), latency p50 %s p90 %s p99 %s max %s",
+		r.Calls, r.Failed, r.Duration.Round(time.Millisecond), r.Throughput,
+		r.Requests, float64(r.Calls)/math.Max(float64(r.Requests), 1), r.Limited, r.Failures,
+		r.P50.Round(time.Millisecond), r.P90.Round(time.Millisecond), r.P99.Round(time.Millisecond), r.Max.Round(time.Millisecond))
+}
+
+// Simulate runs the load through the packer with the options against
+// the simulated VK API and reports the throughput and latencies of calls:
+//
+//	report := packertest.Simulate(packertest.Simulation{
+//		Latency:   packertest.LogNormal(80*time.Millisecond, 0.5),
+//		RateLimit: 3,
+//	}, packertest.Load{Method: "users.get", Calls: 10000, Concurrency: 200},
+//		packer.Tokens("token1", "token2"), packer.FlushInterval(50*time.Millisecond))
+//	fmt.Println(report)
+//
+// The packer uses the single token "token" unless Tokens is passed,
+// Simulate panics if options are invalid.
+func Simulate(sim Simulation, load Load, opts ...packer.Option) Report {
+	s := NewSimulator(sim)
+	p := packer.MustNew(s.Handler, append([]packer.Option{packer.Tokens("token")}, opts...)...)
+	defer p.Close()
+
+	if load.Concurrency < 1 {
+		load.Concurrency = 1
+	}
+	var (
+		wg        sync.WaitGroup
+		next      int64
+		failed    int64
+		latencies = make([]time.Duration, load.Calls)
+	)
+	start := time.Now()
+	wg.Add(load.Concurrency)
+	for i := 0; i < load.Concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			for {
+				n := atomic.AddInt64(&next, 1) - 1
+				if n >= int64(load.Calls) {
+					return
+				}
+				callStart := time.Now()
+				if _, err := p.Handler(load.Method, load.Params); err != nil {
+					atomic.AddInt64(&failed, 1)
+				}
+				latencies[n] = time.Since(callStart)
+			}
+		}()
+	}
+	wg.Wait()
+
+	r := Report{
+		Calls:    load.Calls,
+		Failed:   int(failed),
+		Requests: int(atomic.LoadInt64(&s.requests)),
+		Limited:  int(atomic.LoadInt64(&s.limited)),
+		Failures: int(atomic.LoadInt64(&s.failures)),
+		Duration: time.Since(start),
+	}
+	if r.Duration > 0 {
+		r.Throughput = float64(r.Calls) / r.Duration.Seconds()
+	}
+	if len(latencies) > 0 {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		percentile := func(q float64) time.Duration {
+			return latencies[int(q*float64(len(latencies)-1))]
+		}
+		r.P50, r.P90, r.P99, r.Max = percentile(0.5), percentile(0.9), percentile(0.99), latencies[len(latencies)-1]
+	}
+	return r
+}
@@ -0,0 +1,111 @@
+package packer
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+// MaxPages is the maximum number of pages which can be fetched
+// inside one execute (VK allows up to 25 API calls).
+const MaxPages = 25
+
+// Page is the result of a paginated fetch.
+type Page struct {
+	// Count is the total number of items reported by the method.
+	Count int
+	// Items are concatenated items of all fetched pages.
+	Items []json.RawMessage
+	// Offset is the offset of the next page.
+	Offset int
+}
+
+// Done reports whether all items were fetched.
+func (pg Page) Done() bool {
+	return pg.Offset >= pg.Count
+}
+
+// expr is a VKScript expression which is written as is.
+type expr string
+
+// FetchPages fetches up to pages pages of the method which returns
+// {"count": N, "items": [...]} using a single execute request.
+//
+// Params "offset" and "count" define the first page offset and
+// the page size (default 100).
+func (p *Packer) FetchPages(method string, params api.Params, pages int) (Page, error) {
+	page, err := p.fetchPages("", method, params, pages)
+	return page, p.decorate(method, err)
+}
+
+// fetchPages works like FetchPages, the execute is sent with the token
+// or with a token from the pool if it is empty.
+func (p *Packer) fetchPages(token, method string, params api.Params, pages int) (Page, error) {
+	if pages < 1 || pages > MaxPages {
+		pages = MaxPages
+	}
+
+	offset, count := 0, 100
+	loopParams := api.Params{}
+	for name, value := range params {
+		switch name {
+		case "offset":
+			offset, _ = strconv.Atoi(encodeParam(p.paramEncoders, value))
+		case "count":
+			count, _ = strconv.Atoi(encodeParam(p.paramEncoders, value))
+		default:
+			loopParams[name] = value
+		}
+	}
+	loopParams["offset"] = expr("o")
+	loopParams["count"] = count
+
+	if err := p.loadToken(params); err != nil {
+		return Page{}, err
+	}
+
+	w := p.codeWriter()
+	w.raw("var a=[];var o=" + strconv.Itoa(offset) + ";var t=0;var i=0;")
+	w.raw("while(i<" + strconv.Itoa(pages) + "){var r=")
+	w.call(method, loopParams)
+	w.raw(";if(!r){i=" + strconv.Itoa(pages) + ";}else{a=a+r.items;t=r.count;o=o+" + strconv.Itoa(count) + ";i=i+1;")
+	w.raw("if(o>=t){i=" + strconv.Itoa(pages) + ";}}}")
+	w.raw(`return{"count":t,"items":a,"offset":o};`)
+	code, err := w.String(), w.err
+	w.release()
+	if err != nil {
+		return Page{}, err
+	}
+
+	if p.debug {
+		log.Printf("packer: pages: code: \n%s\n", code)
+	}
+
+	var resp api.Response
+	if token == "" {
+		resp, err = p.execute(code)
+	} else {
+		resp, err = p.executeWithToken(token, p.execMethod, api.Params{"v": p.version}, api.Params{"code": code})
+	}
+	if err != nil {
+		return Page{}, err
+	}
+
+	var page Page
+	if err := p.decoder.Unmarshal(resp.Response, &struct {
+		Count  *int               `json:"count"`
+		Items  *[]json.RawMessage `json:"items"`
+		Offset *int               `json:"offset"`
+	}{&page.Count, &page.Items, &page.Offset}); err != nil {
+		return Page{}, fmt.Errorf("packer: pages: %w", err)
+	}
+
+	if len(resp.ExecuteErrors) > 0 {
+		return page, &resp.ExecuteErrors
+	}
+
+	return page, nil
+}
@@ -0,0 +1,221 @@
+package packer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+// Ref references the result of an earlier pipeline step.
+// It can be used as a param value in the following steps.
+type Ref struct {
+	// Step is the index of the referenced step.
+	Step int
+	// Path is an optional VKScript accessor applied to the step result,
+	// e.g. "object_id" or "items@.id".
+	Path string
+}
+
+// Step creates a reference to the result of pipeline step.
+func Step(step int, path ...string) Ref {
+	return Ref{
+		Step: step,
+		Path: strings.Join(path, "."),
+	}
+}
+
+// Pipeline is a chain of dependent API calls which will be
+// sent as a single execute request.
+type Pipeline struct {
+	p        *Packer
+	steps    []request
+	captures []capture
+	err      error
+}
+
+type capture struct {
+	name string
+	ref  Ref
+}
+
+// PipelineResult contains results of pipeline steps and captured values.
+type PipelineResult struct {
+	Steps    []api.Response
+	Captured map[string]json.RawMessage
+}
+
+// Named returns the value captured under the name or nil.
+func (r PipelineResult) Named(name string) json.RawMessage {
+	return r.Captured[name]
+}
+
+// Pipeline creates a new empty pipeline.
+func (p *Packer) Pipeline() *Pipeline {
+	return &Pipeline{p: p}
+}
+
+// Call appends a step to the pipeline.
+// Params may contain references to the results of previous steps (see Step).
+func (pl *Pipeline) Call(method string, params ...api.Params) *Pipeline {
+	step := len(pl.steps)
+	iterateAll(func(name string, value interface{}) {
+		if ref, ok := value.(Ref); ok && (ref.Step < 0 || ref.Step >= step) && pl.err == nil {
+			pl.err = fmt.Errorf("packer: pipeline: step %d (%s): param %s references unknown step %d", step, method, name, ref.Step)
+		}
+	}, params...)
+	if err := pl.p.validateCall(method, params...); err != nil && pl.err == nil {
+		pl.err = err
+	}
+
+	if len(params) > 1 {
+		params = []api.Params{mergeParams(params...)}
+	}
+
+	pl.steps = append(pl.steps, request{method: method, params: params})
+	return pl
+}
+
+// Capture makes the pipeline return the referenced expression
+// under the name, e.g. Capture("ids", Step(0, "items@.id")).
+func (pl *Pipeline) Capture(name string, ref Ref) *Pipeline {
+	if (ref.Step < 0 || ref.Step >= len(pl.steps)) && pl.err == nil {
+		pl.err = fmt.Errorf("packer: pipeline: capture %s references unknown step %d", name, ref.Step)
+	}
+
+	pl.captures = append(pl.captures, capture{name, ref})
+	return pl
+}
+
+func (pl *Pipeline) code() (string, error) {
+	w := pl.p.codeWriter()
+	defer w.release()
+	for i, step := range pl.steps {
+		w.raw("var ")
+		w.varName(i)
+		w.space(" ")
+		w.raw("=")
+		w.space(" ")
+		w.call(step.method, step.params...)
+		w.raw(";")
+		w.space("\n")
+	}
+	w.raw("return")
+	w.space(" ")
+	w.raw("[")
+	for i := range pl.steps {
+		if i > 0 {
+			w.raw(",")
+			w.space(" ")
+		}
+		w.varName(i)
+	}
+	if len(pl.captures) > 0 {
+		w.raw(",")
+		w.space(" ")
+		w.raw("{")
+		for i, c := range pl.captures {
+			if i > 0 {
+				w.raw(",")
+				w.space(" ")
+			}
+			w.quote(c.name)
+			w.raw(":")
+			w.space(" ")
+			w.ref(c.ref)
+		}
+		w.raw("}")
+	}
+	w.raw("];")
+	return w.String(), w.err
+}
+
+// Exec sends the pipeline and returns results of each step.
+//
+// Failed steps have their Error field set, in that case
+// *api.ExecuteErrors is returned as well.
+func (pl *Pipeline) Exec() ([]api.Response, error) {
+	result, err := pl.Run()
+	return result.Steps, err
+}
+
+// Run sends the pipeline and returns results of steps along with captured values.
+// Errors are reported the same way as in Exec.
+func (pl *Pipeline) Run() (PipelineResult, error) {
+	result, err := pl.run()
+	return result, pl.p.decorate("execute", err)
+}
+
+func (pl *Pipeline) run() (PipelineResult, error) {
+	if pl.err != nil {
+		return PipelineResult{}, pl.err
+	}
+
+	if len(pl.steps) == 0 {
+		return PipelineResult{}, nil
+	}
+
+	for _, step := range pl.steps {
+		if err := pl.p.loadToken(step.params...); err != nil {
+			return PipelineResult{}, err
+		}
+	}
+
+	code, err := pl.code()
+	if err != nil {
+		return PipelineResult{}, err
+	}
+
+	if pl.p.debug {
+		log.Printf("packer: pipeline: code: \n%s\n", code)
+	}
+
+	resp, err := pl.p.executeCode(code, api.Params{"v": pl.p.version})
+	if err != nil {
+		return PipelineResult{}, err
+	}
+
+	if isMessagePack(resp.Response) {
+		return PipelineResult{}, ErrUnsupportedEncoding
+	}
+
+	var bodies []json.RawMessage
+	if err := pl.p.decoder.Unmarshal(resp.Response, &bodies); err != nil {
+		return PipelineResult{}, err
+	}
+
+	expected := len(pl.steps)
+	if len(pl.captures) > 0 {
+		expected++
+	}
+	if len(bodies) != expected {
+		return PipelineResult{}, fmt.Errorf("packer: pipeline: expected %d results, got %d", expected, len(bodies))
+	}
+
+	var result PipelineResult
+	if len(pl.captures) > 0 {
+		if err := pl.p.decoder.Unmarshal(bodies[len(pl.steps)], &result.Captured); err != nil {
+			return PipelineResult{}, err
+		}
+		bodies = bodies[:len(pl.steps)]
+	}
+
+	result.Steps = make([]api.Response, len(pl.steps))
+	failedStepIndex := 0
+	for i, body := range bodies {
+		result.Steps[i].Response = body
+		if bytes.Equal(body, []byte("false")) && failedStepIndex < len(resp.ExecuteErrors) {
+			result.Steps[i].Error = executeErrorToMethodError(pl.steps[i], resp.ExecuteErrors[failedStepIndex])
+			failedStepIndex++
+		}
+	}
+
+	if len(resp.ExecuteErrors) > 0 {
+		return result, &resp.ExecuteErrors
+	}
+
+	return result, nil
+}
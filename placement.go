@@ -0,0 +1,59 @@
+package packer
+
+import (
+	"context"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+// Placement describes how the request was packed, see WithPlacement.
+type Placement struct {
+	// BatchID is the ID of the batch (see BatchInfo),
+	// zero if the request was not packed.
+	BatchID uint64
+	// Index is the position of the request in the execute.
+	Index int
+	// Requests is the number of API calls in the execute.
+	Requests int
+	// Trigger is the reason why the batch was sent.
+	Trigger FlushTrigger
+	// Enqueued is the time when the request was added to the batch.
+	Enqueued time.Time
+	// Waited is the time the request spent in the batch before it was sent.
+	Waited time.Duration
+}
+
+type placementKey struct{}
+
+// WithPlacement returns the context which makes the packer fill pl
+// for requests made with it (see api.Params.WithContext) before they return,
+// so tracing can tell how much of the latency was spent waiting for the batch:
+//
+//	var pl packer.Placement
+//	resp, err := vk.UsersGet(params.WithContext(packer.WithPlacement(ctx, &pl)))
+//	span.SetAttributes(attribute.Int64("vk.batch", int64(pl.BatchID)), attribute.Int64("vk.batch_wait_ms", pl.Waited.Milliseconds()))
+//
+// Placement is not filled for coalesced requests.
+func WithPlacement(ctx context.Context, pl *Placement) context.Context {
+	return context.WithValue(ctx, placementKey{}, pl)
+}
+
+func requestPlacement(params []api.Params) *Placement {
+	if ctx := paramsContext(params...); ctx != nil {
+		pl, _ := ctx.Value(placementKey{}).(*Placement)
+		return pl
+	}
+	return nil
+}
+
+// place fills placements of requests of the batch which is being sent.
+func (bat batch) place(info BatchInfo) {
+	now := time.Now()
+	for i, req := range bat {
+		if pl := requestPlacement(req.params); pl != nil {
+			pl.BatchID, pl.Index, pl.Requests, pl.Trigger = info.ID, i, len(bat), info.Trigger
+			pl.Waited = now.Sub(pl.Enqueued)
+		}
+	}
+}
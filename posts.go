@@ -0,0 +1,65 @@
+package packer
+
+import (
+	"fmt"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/SevereCloud/vksdk/v2/object"
+)
+
+// Post identifies the wall post.
+type Post struct {
+	OwnerID int
+	ID      int
+}
+
+// PostsOptions - FetchLikes and FetchComments options
+type PostsOptions struct {
+	// Limit is the maximum number of likes or comments per post, zero means all.
+	Limit int
+	// Parallelism is the maximum number of posts fetched at the same time
+	// (4 batches by default).
+	Parallelism int
+	// Checkpointer saves completed posts, they are skipped
+	// when the job is restarted.
+	Checkpointer Checkpointer
+}
+
+// FetchLikes fetches ids of users who liked the posts (likes.getList).
+// Requests and pages of different posts are packed together.
+// fn is called with each page, sequentially for the post and concurrently
+// for different posts, returned error stops fetching.
+func (p *Packer) FetchLikes(posts []Post, opts PostsOptions, fn func(post Post, userIDs []int) error) error {
+	return p.forEachPost(posts, opts, func(post Post, stop <-chan struct{}) error {
+		params := api.Params{"type": "post", "owner_id": post.OwnerID, "item_id": post.ID}
+		return fetchPaged(p, "likes.getList", params, 1000, opts.Limit, stop, func(ids []int) error {
+			return fn(post, ids)
+		})
+	})
+}
+
+// FetchComments fetches comments of the posts (wall.getComments),
+// see FetchLikes.
+func (p *Packer) FetchComments(posts []Post, opts PostsOptions, fn func(post Post, comments []object.WallWallComment) error) error {
+	return p.forEachPost(posts, opts, func(post Post, stop <-chan struct{}) error {
+		params := api.Params{"owner_id": post.OwnerID, "post_id": post.ID}
+		return fetchPaged(p, "wall.getComments", params, 100, opts.Limit, stop, func(comments []object.WallWallComment) error {
+			return fn(post, comments)
+		})
+	})
+}
+
+// forEachPost calls fn for posts which are not completed according to the checkpointer.
+func (p *Packer) forEachPost(posts []Post, opts PostsOptions, fn func(post Post, stop <-chan struct{}) error) error {
+	cp, err := loadCheckpoint(opts.Checkpointer)
+	if err != nil {
+		return err
+	}
+
+	return p.forEach(len(posts), opts.Parallelism, func(i int, stop <-chan struct{}) error {
+		key := fmt.Sprintf("%d_%d", posts[i].OwnerID, posts[i].ID)
+		return cp.run(i, key, stop, func() error {
+			return fn(posts[i], stop)
+		})
+	})
+}
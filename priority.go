@@ -0,0 +1,151 @@
+package packer
+
+import (
+	"context"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+// Priority is the priority of the packed request.
+type Priority int
+
+const (
+	// PriorityBulk is for background jobs.
+	PriorityBulk Priority = iota - 1
+	// PriorityNormal is the default priority.
+	PriorityNormal
+	// PriorityInteractive is for requests users are waiting for.
+	PriorityInteractive
+)
+
+const numPriorities = 3
+
+// index returns the index of the priority queue, higher priorities go first.
+func (pr Priority) index() int {
+	switch {
+	case pr > PriorityNormal:
+		return 0
+	case pr < PriorityNormal:
+		return 2
+	}
+	return 1
+}
+
+type priorityKey struct{}
+
+// WithPriority returns the context which makes requests made with it
+// (see api.Params.WithContext) packed with the priority.
+func WithPriority(ctx context.Context, pr Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, pr)
+}
+
+func requestPriority(params []api.Params) Priority {
+	if ctx := paramsContext(params...); ctx != nil {
+		if pr, ok := ctx.Value(priorityKey{}).(Priority); ok {
+			return pr
+		}
+	}
+	return PriorityNormal
+}
+
+// PriorityShares sets the number of slots of each execute reserved
+// for normal and bulk requests, so they progress even when there are
+// always enough requests of higher priorities. By default 2 slots are
+// reserved for normal and 1 for bulk requests.
+func PriorityShares(normal, bulk int) Option {
+	return func(p *Packer) {
+		p.shares = [numPriorities]int{0, normal, bulk}
+	}
+}
+
+// len returns the number of requests in all queues.
+func (b *pendingBatch) len() int {
+	n := 0
+	for _, q := range b.queues {
+		n += len(q)
+	}
+	return n
+}
+
+// takeWindow limits the number of requests of each queue examined by take
+// (multiplied by the batch size), so requests skipped because of
+// method limits do not make assembly of every batch scan the whole queue.
+const takeWindow = 4
+
+// take removes requests for the next execute from the queues.
+// Reserved shares are taken first, remaining slots are filled by priority.
+func (b *pendingBatch) take(l batchLimits) batch {
+	var (
+		marks  [numPriorities][]bool
+		counts map[string]int
+		left   = l.requests
+		cost   int
+	)
+	if len(l.methodLimits) > 0 {
+		counts = make(map[string]int)
+	}
+	for i, q := range b.queues {
+		n := len(q)
+		if n > l.requests*takeWindow {
+			n = l.requests * takeWindow
+		}
+		marks[i] = make([]bool, n)
+	}
+
+	grab := func(i, n int) {
+		for j := range marks[i] {
+			if n == 0 || left == 0 {
+				return
+			}
+			if marks[i][j] {
+				continue
+			}
+			req := b.queues[i][j]
+			if max, ok := l.methodLimits[req.method]; ok && counts[req.method] >= max {
+				continue
+			}
+			c := l.costOf(req.method)
+			// the request which costs more than the limit is sent alone
+			if l.cost > 0 && cost+c > l.cost && left < l.requests {
+				return
+			}
+			marks[i][j] = true
+			if counts != nil {
+				counts[req.method]++
+			}
+			cost += c
+			left--
+			n--
+		}
+	}
+	for i := len(b.queues) - 1; i >= 0; i-- {
+		grab(i, l.shares[i])
+	}
+	for i := range b.queues {
+		grab(i, l.requests)
+	}
+
+	bat := make(batch, 0, l.requests-left)
+	for i, q := range b.queues {
+		for j, taken := range marks[i] {
+			if taken {
+				bat = append(bat, q[j])
+			}
+		}
+
+		// move skipped requests to the end of the examined part
+		w := len(marks[i])
+		for j := len(marks[i]) - 1; j >= 0; j-- {
+			if !marks[i][j] {
+				w--
+				q[w] = q[j]
+			}
+		}
+		for j := 0; j < w; j++ {
+			q[j] = request{}
+		}
+		b.queues[i] = q[w:]
+	}
+	b.cost -= cost
+	return bat
+}
@@ -0,0 +1,73 @@
+package packer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPendingBatchTake(t *testing.T) {
+	fill := func() *pendingBatch {
+		b := &pendingBatch{}
+		for i, method := range []string{"interactive", "normal", "bulk"} {
+			for j := 0; j < 5; j++ {
+				b.queues[i] = append(b.queues[i], request{method: method})
+			}
+		}
+		return b
+	}
+	methods := func(bat batch) (result []string) {
+		for _, req := range bat {
+			result = append(result, req.method)
+		}
+		return result
+	}
+
+	b := fill()
+	assert.Equal(t, []string{"interactive", "normal", "normal", "bulk"}, methods(b.take(batchLimits{requests: 4, shares: [numPriorities]int{0, 2, 1}})))
+	assert.Equal(t, 11, b.len())
+
+	b = fill()
+	assert.Equal(t, []string{"interactive", "interactive", "interactive"}, methods(b.take(batchLimits{requests: 3})))
+	assert.Equal(t, []string{"interactive", "interactive", "normal"}, methods(b.take(batchLimits{requests: 3})))
+}
+
+func TestRequestPriority(t *testing.T) {
+	ctx := WithPriority(context.Background(), PriorityBulk)
+	assert.Equal(t, PriorityBulk, requestPriority([]api.Params{api.Params{}.WithContext(ctx)}))
+	assert.Equal(t, PriorityNormal, requestPriority([]api.Params{{"user_ids": 1}}))
+}
+
+func TestPendingBatchTakeCost(t *testing.T) {
+	b := &pendingBatch{}
+	for _, method := range []string{"newsfeed.search", "newsfeed.search", "utils.getServerTime", "newsfeed.search"} {
+		b.queues[1] = append(b.queues[1], request{method: method})
+	}
+	l := batchLimits{requests: 25, cost: 10, costs: map[string]int{"newsfeed.search": 5}}
+
+	assert.Len(t, b.take(l), 2)
+	assert.Len(t, b.take(l), 2)
+
+	l.cost = 3
+	b.queues[1] = append(b.queues[1], request{method: "newsfeed.search"})
+	assert.Len(t, b.take(l), 1)
+}
+
+func TestPendingBatchTakeMethodLimit(t *testing.T) {
+	b := &pendingBatch{}
+	for _, method := range []string{"messages.send", "messages.send", "messages.send", "users.get", "messages.send"} {
+		b.queues[1] = append(b.queues[1], request{method: method})
+	}
+	l := batchLimits{requests: 25, methodLimits: map[string]int{"messages.send": 2}}
+
+	var methods []string
+	for _, req := range b.take(l) {
+		methods = append(methods, req.method)
+	}
+	assert.Equal(t, []string{"messages.send", "messages.send", "users.get"}, methods)
+	assert.Equal(t, 2, b.len())
+	assert.Len(t, b.take(l), 2)
+	assert.Equal(t, 0, b.len())
+}
@@ -0,0 +1,78 @@
+package packer
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+// Procedure makes the packer send batches through the stored procedure
+// execute.<name> instead of inline code.
+//
+// The procedure receives packed calls as arguments:
+//
+//	methods      - comma separated list of methods, e.g. "users.get,messages.send"
+//	c<i>_<param> - param of i-th call, e.g. c0_user_ids, c1_peer_id
+//
+// and must return an array with results of the calls in the same order,
+// just like the inline code does:
+//
+//	var methods = Args.methods.split(",");
+//	var res = [];
+//	if (methods[0] == "users.get") {
+//		res.push(API.users.get({"user_ids": Args.c0_user_ids}));
+//	}
+//	...
+//	return res;
+func Procedure(name string) Option {
+	return func(p *Packer) {
+		p.procedure = name
+	}
+}
+
+// ExecuteMethod sets the method receiving inline code of batches
+// instead of "execute", e.g. an app endpoint which proxies execute.
+// Requests of the method are never packed.
+func ExecuteMethod(method string) Option {
+	return func(p *Packer) {
+		p.execMethod = method
+	}
+}
+
+// BatchParams adds params to every execute (or stored procedure) request
+// sent by the packer, e.g. func_v of the procedure or client metadata.
+// Params of batches override them.
+func BatchParams(params api.Params) Option {
+	return func(p *Packer) {
+		if p.batchParams == nil {
+			p.batchParams = api.Params{}
+		}
+		for name, value := range params {
+			p.batchParams[name] = value
+		}
+	}
+}
+
+// isExecute reports whether the method runs code or a stored procedure.
+func (p *Packer) isExecute(method string) bool {
+	return method == "execute" || method == p.execMethod || strings.HasPrefix(method, "execute.")
+}
+
+func (b batch) procedureArgs(encoders []ParamEncoder) api.Params {
+	args := api.Params{}
+	methods := make([]string, len(b))
+	for i, req := range b {
+		methods[i] = req.method
+
+		prefix := "c" + strconv.Itoa(i) + "_"
+		iterateAll(func(name string, value interface{}) {
+			if isExecuteParam(name) {
+				return
+			}
+			args[prefix+name] = encodeParam(encoders, value)
+		}, req.params...)
+	}
+	args["methods"] = strings.Join(methods, ",")
+	return args
+}
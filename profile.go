@@ -0,0 +1,53 @@
+package packer
+
+import "fmt"
+
+// Profile is a named set of batching rules (see Rules).
+type Profile struct {
+	Allow  []string `json:"allow" yaml:"allow"`
+	Ignore []string `json:"ignore" yaml:"ignore"`
+}
+
+// RuleProfile defines the named rule profile which can be activated
+// with UseProfile, e.g. "daytime", "degraded" or "bulk-export".
+func RuleProfile(name string, profile Profile) Option {
+	return func(p *Packer) {
+		p.profiles[name] = profile
+	}
+}
+
+// UseProfile atomically replaces batching rules of the running packer
+// with the rules of the profile. Rules changed at runtime
+// (e.g. by AddAllowedMethod) are discarded.
+func (p *Packer) UseProfile(name string) error {
+	p.rulesMtx.Lock()
+	defer p.rulesMtx.Unlock()
+	profile, ok := p.profiles[name]
+	if !ok {
+		return fmt.Errorf("packer: unknown rule profile %q", name)
+	}
+
+	p.rules = profile.rules()
+	p.profile = name
+	p.publishRules()
+	return nil
+}
+
+// ActiveProfile returns the name of the profile set by UseProfile,
+// or empty string if rules were not set by profile.
+func (p *Packer) ActiveProfile() string {
+	p.rulesMtx.RLock()
+	defer p.rulesMtx.RUnlock()
+	return p.profile
+}
+
+func (pr Profile) rules() ruleSet {
+	rules := newRuleSet()
+	for _, m := range pr.Allow {
+		rules.allowed.add(m)
+	}
+	for _, m := range pr.Ignore {
+		rules.ignored.add(m)
+	}
+	return rules
+}
@@ -0,0 +1,198 @@
+package packer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+// QueuedRequest is the request stored in the Queue.
+type QueuedRequest struct {
+	ID      string  `json:"id"`
+	Request Request `json:"request"`
+}
+
+// Queue durably stores packed requests until their batches are sent.
+// Implementations must be safe for concurrent use.
+type Queue interface {
+	// Add stores the request before it is packed.
+	Add(req QueuedRequest) error
+	// Done removes the request after its batch was sent.
+	Done(id string) error
+	// Pending returns requests which were added but not done.
+	Pending() ([]QueuedRequest, error)
+}
+
+// PersistentQueue makes the packer store every packed request in the queue
+// until its batch is sent. Requests of batches which were rejected before
+// execution (too many requests, connection failed) and requests drained
+// with DrainPersist stay in the queue,
+// they can be sent again after restart with Replay. Access tokens are not
+// stored, replayed requests are sent with tokens of the packer.
+func PersistentQueue(q Queue) Option {
+	return func(p *Packer) {
+		p.queue = q
+	}
+}
+
+// Replay packs requests left in the queue by previous runs,
+// fn is called with the result of each of them.
+// It should be called once on startup.
+func (p *Packer) Replay(fn func(req Request, resp api.Response, err error)) error {
+	if p.queue == nil {
+		return nil
+	}
+
+	reqs, err := p.queue.Pending()
+	if err != nil {
+		return fmt.Errorf("packer: queue: %w", err)
+	}
+
+	for _, qr := range reqs {
+		req := qr.Request
+		if err := p.loadToken(req.Params); err != nil {
+			fn(req, api.Response{}, err)
+			continue
+		}
+		p.push(req.Method, []api.Params{req.Params}, p.track(qr.ID, func(resp api.Response, err error) {
+			fn(req, resp, err)
+		}))
+	}
+	return nil
+}
+
+// persist adds the request to the queue and returns the callback
+// which removes it when the batch is sent.
+func (p *Packer) persist(method string, params []api.Params, callback func(api.Response, error)) (func(api.Response, error), error) {
+	id := p.newID()
+	if err := p.queue.Add(QueuedRequest{id, Request{method, p.storedParams(params...)}}); err != nil {
+		return nil, fmt.Errorf("packer: queue: %w", err)
+	}
+	return p.track(id, callback), nil
+}
+
+func (p *Packer) track(id string, callback func(api.Response, error)) func(api.Response, error) {
+	return func(resp api.Response, err error) {
+		// batches which may have been executed are not kept,
+		// otherwise Replay could send their writes twice
+		var batchErr *BatchError
+		keep := errors.As(err, &batchErr) && notExecuted(batchErr.Err) ||
+			(errors.Is(err, ErrShutdown) && p.drainPolicy == DrainPersist)
+		if !keep {
+			if doneErr := p.queue.Done(id); doneErr != nil && p.debug {
+				log.Printf("packer: queue: %v\n", doneErr)
+			}
+		}
+		callback(resp, err)
+	}
+}
+
+// queueRecord is the line of the queue file.
+type queueRecord struct {
+	Add  *QueuedRequest `json:"add,omitempty"`
+	Done string         `json:"done,omitempty"`
+}
+
+// fileQueueCompaction is the number of done records
+// after which the queue file is compacted.
+const fileQueueCompaction = 1000
+
+type fileQueue struct {
+	mtx  sync.Mutex
+	log  *fileLog
+	done int
+}
+
+// NewFileQueue opens the queue stored in the file at path,
+// the file is created if it does not exist.
+// Records are appended as JSON lines and synced to disk on every write,
+// completed requests are dropped from the file when it is opened
+// and after every 1000 completed requests.
+func NewFileQueue(path string) (Queue, error) {
+	l, err := compactQueueFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &fileQueue{log: l}, nil
+}
+
+// compactQueueFile rewrites the file with pending requests only.
+func compactQueueFile(path string) (*fileLog, error) {
+	pending, err := readQueueFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]interface{}, len(pending))
+	for i := range pending {
+		records[i] = queueRecord{Add: &pending[i]}
+	}
+	return rewriteLog(path, records)
+}
+
+func readQueueFile(path string) ([]QueuedRequest, error) {
+	var (
+		order []string
+		added = make(map[string]QueuedRequest)
+	)
+	err := readLog(path, func(line []byte) {
+		var rec queueRecord
+		if json.Unmarshal(line, &rec) != nil {
+			return
+		}
+		if rec.Add != nil {
+			order = append(order, rec.Add.ID)
+			added[rec.Add.ID] = *rec.Add
+		}
+		if rec.Done != "" {
+			delete(added, rec.Done)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pending := make([]QueuedRequest, 0, len(added))
+	for _, id := range order {
+		if req, ok := added[id]; ok {
+			pending = append(pending, req)
+		}
+	}
+	return pending, nil
+}
+
+func (q *fileQueue) Add(req QueuedRequest) error {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	return q.log.write(queueRecord{Add: &req})
+}
+
+func (q *fileQueue) Done(id string) error {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	if err := q.log.write(queueRecord{Done: id}); err != nil {
+		return err
+	}
+	if q.done++; q.done < fileQueueCompaction {
+		return nil
+	}
+
+	q.done = 0
+	l, err := compactQueueFile(q.log.path)
+	if err != nil {
+		return fmt.Errorf("compact: %w", err)
+	}
+	q.log.close()
+	q.log = l
+	return nil
+}
+
+func (q *fileQueue) Pending() ([]QueuedRequest, error) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	return readQueueFile(q.log.path)
+}
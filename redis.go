@@ -0,0 +1,236 @@
+package packer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+// RedisClient is the subset of Redis commands used by the distributed mode.
+// It is easy to implement on top of any Redis library, e.g. go-redis:
+//
+//	func (c client) BLPop(ctx context.Context, timeout time.Duration, key string) (string, bool, error) {
+//		res, err := c.rdb.BLPop(ctx, timeout, key).Result()
+//		if err == redis.Nil {
+//			return "", false, nil
+//		}
+//		if err != nil {
+//			return "", false, err
+//		}
+//		return res[1], true, nil
+//	}
+type RedisClient interface {
+	// RPush appends the value to the list.
+	RPush(ctx context.Context, key, value string) error
+	// BLPop pops the first value of the list waiting up to timeout,
+	// ok is false if the list is still empty.
+	BLPop(ctx context.Context, timeout time.Duration, key string) (value string, ok bool, err error)
+	// Publish sends the message to the channel.
+	Publish(ctx context.Context, channel, message string) error
+	// Subscribe returns messages of the channel until ctx is done.
+	Subscribe(ctx context.Context, channel string) (<-chan string, error)
+}
+
+// Distributed makes the packer share the pending queue named name
+// with other processes through Redis: requests passed to Handler are pushed
+// to the shared queue, every instance running RunDistributed pops them
+// into its own batches and publishes results back to the instance
+// which the caller waits on.
+//
+// Access tokens are not pushed to Redis, requests are sent with tokens
+// of the instance which packs them. Callers wait for the reply
+// until the context of the request is done or DistributedReplyTimeout passes.
+// Errors other than VK API errors are delivered as plain text.
+func Distributed(client RedisClient, name string) Option {
+	return func(p *Packer) {
+		p.redis = &redisQueue{
+			client:    client,
+			queue:     name + ":queue",
+			replies:   name + ":replies:" + p.newID(),
+			callbacks: make(map[string]func(api.Response, error)),
+		}
+	}
+}
+
+// DefaultDistributedReplyTimeout is the time the caller waits
+// for the reply in distributed mode unless DistributedReplyTimeout is set.
+const DefaultDistributedReplyTimeout = time.Minute
+
+// DistributedReplyTimeout sets the time the caller waits for the reply
+// in distributed mode, e.g. when no instance runs RunDistributed.
+// Requests without the reply fail with context.DeadlineExceeded,
+// zero timeout means waiting without limit.
+func DistributedReplyTimeout(timeout time.Duration) Option {
+	return func(p *Packer) {
+		p.replyTimeout = timeout
+	}
+}
+
+type redisQueue struct {
+	client    RedisClient
+	queue     string
+	replies   string
+	callbacks map[string]func(api.Response, error)
+	mtx       sync.Mutex
+}
+
+type redisRequest struct {
+	ID      string     `json:"id"`
+	ReplyTo string     `json:"reply_to"`
+	Method  string     `json:"method"`
+	Params  api.Params `json:"params"`
+}
+
+type redisReply struct {
+	ID       string       `json:"id"`
+	Response api.Response `json:"response"`
+	Error    string       `json:"error,omitempty"`
+}
+
+// distributedPopTimeout limits BLPop so the context is checked periodically.
+const distributedPopTimeout = time.Second
+
+// RunDistributed receives results of requests of this instance and
+// packs requests from the shared queue until ctx is done.
+// Batches are sent as usual, so Send must be triggered like in local mode.
+func (p *Packer) RunDistributed(ctx context.Context) error {
+	if p.redis == nil {
+		return errors.New("packer: distributed mode is not enabled")
+	}
+
+	replies, err := p.redis.client.Subscribe(ctx, p.redis.replies)
+	if err != nil {
+		return fmt.Errorf("packer: redis: %w", err)
+	}
+	go p.receiveReplies(replies)
+
+	for ctx.Err() == nil {
+		value, ok, err := p.redis.client.BLPop(ctx, distributedPopTimeout, p.redis.queue)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			return fmt.Errorf("packer: redis: %w", err)
+		}
+		if !ok {
+			continue
+		}
+
+		var req redisRequest
+		if err := json.Unmarshal([]byte(value), &req); err != nil {
+			if p.debug {
+				log.Printf("packer: redis: bad request: %v\n", err)
+			}
+			continue
+		}
+		p.push(req.Method, []api.Params{req.Params}, func(resp api.Response, err error) {
+			p.reply(req, resp, err)
+		})
+	}
+	return ctx.Err()
+}
+
+func (p *Packer) reply(req redisRequest, resp api.Response, err error) {
+	reply := redisReply{ID: req.ID, Response: resp}
+	if err != nil && resp.Error.Code == api.ErrNoType {
+		reply.Error = err.Error()
+	}
+
+	data, err := json.Marshal(reply)
+	if err == nil {
+		err = p.redis.client.Publish(context.Background(), req.ReplyTo, string(data))
+	}
+	if err != nil && p.debug {
+		log.Printf("packer: redis: reply %s: %v\n", req.ID, err)
+	}
+}
+
+func (p *Packer) receiveReplies(replies <-chan string) {
+	for msg := range replies {
+		var reply redisReply
+		if err := json.Unmarshal([]byte(msg), &reply); err != nil {
+			continue
+		}
+
+		callback := p.redis.takeCallback(reply.ID)
+		if callback == nil {
+			continue
+		}
+
+		switch {
+		case reply.Response.Error.Code != api.ErrNoType:
+			callback(reply.Response, reply.Response.Error)
+		case reply.Error != "":
+			callback(reply.Response, errors.New(reply.Error))
+		default:
+			callback(reply.Response, nil)
+		}
+	}
+}
+
+// pushRemote pushes the request to the shared queue. The callback
+// is called once: with the reply, or with the error of the request context
+// or the reply timeout.
+func (p *Packer) pushRemote(method string, params []api.Params, callback func(api.Response, error)) error {
+	req := redisRequest{
+		ID:      p.newID(),
+		ReplyTo: p.redis.replies,
+		Method:  method,
+		Params:  p.normalize(params...),
+	}
+	delete(req.Params, "access_token")
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	ctx := paramsContext(params...)
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if p.replyTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.replyTimeout)
+		callback = withCancel(callback, cancel)
+	}
+	p.redis.mtx.Lock()
+	p.redis.callbacks[req.ID] = callback
+	p.redis.mtx.Unlock()
+
+	if err := p.redis.client.RPush(ctx, p.redis.queue, string(data)); err != nil {
+		p.redis.takeCallback(req.ID)
+		return fmt.Errorf("packer: redis: %w", err)
+	}
+	if ctx.Done() != nil {
+		go func() {
+			<-ctx.Done()
+			if callback := p.redis.takeCallback(req.ID); callback != nil {
+				callback(api.Response{}, fmt.Errorf("packer: redis: reply: %w", ctx.Err()))
+			}
+		}()
+	}
+	return nil
+}
+
+// takeCallback removes the callback of the request and returns it,
+// nil if it has already been taken.
+func (q *redisQueue) takeCallback(id string) func(api.Response, error) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	callback := q.callbacks[id]
+	delete(q.callbacks, id)
+	return callback
+}
+
+func withCancel(callback func(api.Response, error), cancel context.CancelFunc) func(api.Response, error) {
+	return func(resp api.Response, err error) {
+		cancel()
+		callback(resp, err)
+	}
+}
@@ -0,0 +1,148 @@
+package packer
+
+import "sync"
+
+// TenantFunc returns the handler and options of the tenant's packer,
+// e.g. the handler of api.VK with the community token.
+type TenantFunc[K comparable] func(tenant K) (VKHandler, []Option, error)
+
+// Registry lazily creates packers per tenant (community, customer)
+// for platforms running many bots in one process. Shared options
+// are applied to every packer before tenant options, so they may
+// share resources: RateLimit with one limiter, OnBatch collecting metrics, etc.
+//
+//	limiter := rate.NewLimiter(100, 1)
+//	reg := packer.NewRegistry(func(groupID int) (packer.VKHandler, []packer.Option, error) {
+//		vk := api.NewVK(tokens[groupID])
+//		return vk.Handler, nil, nil
+//	}, packer.RateLimit(limiter), packer.FlushInterval(time.Second))
+//	p, err := reg.Get(groupID)
+type Registry[K comparable] struct {
+	create TenantFunc[K]
+	shared []Option
+
+	mtx     sync.Mutex
+	entries map[K]*tenantEntry
+	closed  bool
+}
+
+type tenantEntry struct {
+	ready chan struct{}
+	p     *Packer
+	err   error
+}
+
+// NewRegistry creates the registry.
+func NewRegistry[K comparable](create TenantFunc[K], shared ...Option) *Registry[K] {
+	return &Registry[K]{create: create, shared: shared, entries: make(map[K]*tenantEntry)}
+}
+
+// Get returns the packer of the tenant, creating it on the first call.
+// Packers of different tenants are created concurrently.
+// If creation fails, the next call tries again.
+func (r *Registry[K]) Get(tenant K) (*Packer, error) {
+	r.mtx.Lock()
+	if r.closed {
+		r.mtx.Unlock()
+		return nil, ErrShutdown
+	}
+	e, ok := r.entries[tenant]
+	if ok {
+		r.mtx.Unlock()
+		<-e.ready
+		return e.p, e.err
+	}
+	e = &tenantEntry{ready: make(chan struct{})}
+	r.entries[tenant] = e
+	r.mtx.Unlock()
+
+	handler, opts, err := r.create(tenant)
+	if err == nil {
+		e.p, err = New(handler, append(append([]Option(nil), r.shared...), opts...)...)
+	}
+	e.err = err
+	if err != nil {
+		r.mtx.Lock()
+		delete(r.entries, tenant)
+		r.mtx.Unlock()
+	}
+	close(e.ready)
+	return e.p, e.err
+}
+
+// Range calls fn for every created packer until fn returns false.
+func (r *Registry[K]) Range(fn func(tenant K, p *Packer) bool) {
+	for tenant, p := range r.packers() {
+		if !fn(tenant, p) {
+			return
+		}
+	}
+}
+
+// Len returns the number of tenants with packers.
+func (r *Registry[K]) Len() int {
+	return len(r.packers())
+}
+
+func (r *Registry[K]) packers() map[K]*Packer {
+	r.mtx.Lock()
+	entries := make(map[K]*tenantEntry, len(r.entries))
+	for tenant, e := range r.entries {
+		entries[tenant] = e
+	}
+	r.mtx.Unlock()
+
+	packers := make(map[K]*Packer, len(entries))
+	for tenant, e := range entries {
+		if <-e.ready; e.p != nil {
+			packers[tenant] = e.p
+		}
+	}
+	return packers
+}
+
+// Remove closes the packer of the tenant and removes it from the registry,
+// the next Get creates a new one.
+func (r *Registry[K]) Remove(tenant K) error {
+	r.mtx.Lock()
+	e, ok := r.entries[tenant]
+	delete(r.entries, tenant)
+	r.mtx.Unlock()
+	if !ok {
+		return nil
+	}
+	if <-e.ready; e.p == nil {
+		return nil
+	}
+	return e.p.Close()
+}
+
+// Close closes packers of all tenants concurrently and returns the first error,
+// Get fails with ErrShutdown after Close.
+func (r *Registry[K]) Close() error {
+	r.mtx.Lock()
+	r.closed = true
+	r.mtx.Unlock()
+
+	var (
+		wg       sync.WaitGroup
+		errMtx   sync.Mutex
+		firstErr error
+	)
+	for tenant := range r.packers() {
+		tenant := tenant
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := r.Remove(tenant); err != nil {
+				errMtx.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				errMtx.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
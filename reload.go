@@ -0,0 +1,234 @@
+package packer
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// ApplyConfig re-applies tunable settings of cfg on the running packer:
+// MaxPackedRequests, FlushInterval, rules (Allow, Ignore, Profiles and Profile),
+// Retries, RateLimit, TokenRateLimit, MaxBatchCost, MethodCosts and MethodLimits.
+// Only settings present in cfg are changed: keys of the file for configs
+// loaded by LoadConfig or ConfigFromEnv, non-zero fields otherwise,
+// so settings of options passed in code are kept unless the config sets them.
+// A present key with zero value restores the default. Other fields of cfg
+// are ignored. The settings are swapped at once between batches, pending
+// and in-flight requests are kept. Nothing is changed if cfg is invalid.
+func (p *Packer) ApplyConfig(cfg Config) error {
+	costs := make(map[string]int, len(cfg.MethodCosts))
+	for method, cost := range cfg.MethodCosts {
+		costs[method] = cost
+	}
+	methodLimits := make(map[string]int, len(cfg.MethodLimits))
+	for method, max := range cfg.MethodLimits {
+		if max >= 1 {
+			methodLimits[method] = max
+		}
+	}
+
+	var err error
+	if doErr := p.do(func() { err = p.applyConfig(cfg, costs, methodLimits) }); doErr != nil {
+		return doErr
+	}
+	return err
+}
+
+// applyConfig is ApplyConfig run by the dispatcher.
+func (p *Packer) applyConfig(cfg Config, costs, methodLimits map[string]int) error {
+	p.rulesMtx.Lock()
+	defer p.rulesMtx.Unlock()
+	profiles := make(map[string]Profile, len(p.profiles)+len(cfg.Profiles))
+	for name, profile := range p.profiles {
+		profiles[name] = profile
+	}
+	for name, profile := range cfg.Profiles {
+		profiles[name] = profile
+	}
+	setRules := cfg.has("allow") || cfg.has("ignore") || cfg.has("profile")
+	rules := Profile{Allow: cfg.Allow, Ignore: cfg.Ignore}.rules()
+	if setRules && cfg.Profile != "" {
+		profile, ok := profiles[cfg.Profile]
+		if !ok {
+			return fmt.Errorf("packer: unknown rule profile %q", cfg.Profile)
+		}
+		rules = profile.rules()
+	}
+
+	p.profiles = profiles
+	if setRules {
+		p.rules = rules
+		p.profile = cfg.Profile
+	}
+	p.publishRules()
+
+	if cfg.has("max_packed_requests") {
+		p.maxPackedRequests = cfg.MaxPackedRequests
+		if p.maxPackedRequests < 1 || p.maxPackedRequests > 25 {
+			p.maxPackedRequests = 25
+		}
+	}
+	if cfg.has("max_batch_cost") {
+		p.maxCost = cfg.MaxBatchCost
+	}
+	if cfg.has("method_costs") {
+		p.costs = costs
+	}
+	if cfg.has("method_limits") {
+		p.methodLimits = methodLimits
+	}
+
+	p.tuneMtx.Lock()
+	if cfg.has("retries") {
+		p.retries = cfg.Retries
+	}
+	if cfg.has("retry_backoff") {
+		p.retryBackoff = time.Duration(cfg.RetryBackoff)
+	}
+	if cfg.has("rate_limit") || cfg.has("rate_burst") {
+		var (
+			limit rate.Limit
+			burst = 1
+		)
+		if p.limiter != nil {
+			limit, burst = p.limiter.Limit(), p.limiter.Burst()
+		}
+		if cfg.has("rate_limit") {
+			limit = rate.Limit(cfg.RateLimit)
+		}
+		if cfg.has("rate_burst") {
+			burst = maxInt(cfg.RateBurst, 1)
+		}
+		p.limiter = nil
+		if limit > 0 {
+			p.limiter = rate.NewLimiter(limit, burst)
+		}
+	}
+	p.tuneMtx.Unlock()
+
+	p.tokenLimMtx.Lock()
+	limit, burst := p.tokenLimit, p.tokenBurst
+	if cfg.has("token_rate_limit") {
+		limit = 0
+		if cfg.TokenRateLimit > 0 {
+			limit = rate.Limit(cfg.TokenRateLimit)
+		}
+	}
+	if cfg.has("token_rate_burst") {
+		burst = maxInt(cfg.TokenRateBurst, 1)
+	}
+	if limit > 0 {
+		burst = maxInt(burst, 1)
+	}
+	if limit != p.tokenLimit || burst != p.tokenBurst {
+		p.tokenLimit = limit
+		p.tokenBurst = burst
+		p.tokenLimiters = make(map[string]*rate.Limiter)
+	}
+	p.tokenLimMtx.Unlock()
+
+	if cfg.has("flush_interval") {
+		p.setFlushInterval(time.Duration(cfg.FlushInterval))
+	}
+	return nil
+}
+
+// setFlushInterval starts, stops or resets the flush loop.
+// It does not wait for the loop, so it may be called by commands.
+func (p *Packer) setFlushInterval(interval time.Duration) {
+	if interval < 0 {
+		interval = 0
+	}
+	p.flushMtx.Lock()
+	defer p.flushMtx.Unlock()
+	old := p.flushInterval
+	if interval == old || p.deterministic || p.isClosed() {
+		return
+	}
+	p.flushInterval = interval
+	if old == 0 {
+		p.startFlushLoop(interval)
+		return
+	}
+	select {
+	case p.flushWake <- struct{}{}:
+	default:
+	}
+	if interval == 0 {
+		p.flushWake = nil
+	}
+}
+
+// retryPolicy returns the number of retries and the backoff set by Retry.
+func (p *Packer) retryPolicy() (int, time.Duration) {
+	p.tuneMtx.RLock()
+	defer p.tuneMtx.RUnlock()
+	return p.retries, p.retryBackoff
+}
+
+// batchSize returns the maximum number of requests in the batch.
+func (p *Packer) batchSize() int {
+	var n int
+	p.doLate(func() { n = p.maxPackedRequests })
+	return n
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// WatchConfig polls the config file every interval and applies it
+// with ApplyConfig when the file changes, until stop is called
+// or the packer is closed. Errors of loading and applying the config
+// are passed to onError (if not nil), the previous settings are kept.
+// The file should be replaced atomically (written to a temporary file
+// and renamed), otherwise a partially written config may be applied.
+func (p *Packer) WatchConfig(path string, interval time.Duration, onError func(error)) (stop func()) {
+	done := make(chan struct{})
+	stat := func() (time.Time, int64) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, -1
+		}
+		return info.ModTime(), info.Size()
+	}
+	modTime, size := stat()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			case <-p.stop:
+				return
+			}
+
+			mt, sz := stat()
+			if mt.Equal(modTime) && sz == size {
+				continue
+			}
+			modTime, size = mt, sz
+			cfg, err := LoadConfig(path)
+			if err == nil {
+				err = p.ApplyConfig(cfg)
+			}
+			if err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
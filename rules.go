@@ -0,0 +1,254 @@
+package packer
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+// Decision is the result of the rule function.
+type Decision int
+
+const (
+	// NoDecision means that the decision is made by next rules.
+	NoDecision Decision = iota
+	// Pack means that the request is packed.
+	Pack
+	// Bypass means that the request is sent directly.
+	Bypass
+)
+
+// RuleFunc adds the function which decides whether the request is packed.
+// Functions are called in order before static rules, the first decision
+// other than NoDecision is used.
+func RuleFunc(fn func(method string, params api.Params) Decision) Option {
+	return func(p *Packer) {
+		p.ruleFuncs = append(p.ruleFuncs, fn)
+	}
+}
+
+// RulesRegexp works like Rules but matches methods by regular expressions.
+func RulesRegexp(mode FilterMode, res ...*regexp.Regexp) Option {
+	return func(p *Packer) {
+		set := p.rules.list(mode)
+		set.regexps = append(set.regexps, res...)
+	}
+}
+
+// ruleSet holds allowed and ignored methods. Rules are applied in order:
+//
+//  1. exact ignored names
+//  2. exact allowed names
+//  3. ignored patterns
+//  4. allowed patterns
+//  5. the default bypass list (see NoDefaultBypass)
+//
+// Methods matched by none of them are packed unless there are allow rules.
+type ruleSet struct {
+	allowed methodSet
+	ignored methodSet
+}
+
+func newRuleSet() ruleSet {
+	return ruleSet{allowed: newMethodSet(), ignored: newMethodSet()}
+}
+
+func (r ruleSet) clone() ruleSet {
+	return ruleSet{allowed: r.allowed.clone(), ignored: r.ignored.clone()}
+}
+
+func (r *ruleSet) list(mode FilterMode) *methodSet {
+	if mode == Allow {
+		return &r.allowed
+	}
+	return &r.ignored
+}
+
+// bypass reports whether the method must be sent directly.
+func (r *ruleSet) bypass(method string, defaultBypass bool) bool {
+	ignored, ignoredExact := r.ignored.match(method)
+	allowed, allowedExact := r.allowed.match(method)
+	switch {
+	case ignoredExact:
+		return true
+	case allowedExact:
+		return false
+	case ignored:
+		return true
+	case allowed:
+		return false
+	}
+	if defaultBypass {
+		if matched, _ := defaultBypassMethods.match(method); matched {
+			return true
+		}
+	}
+	return !r.allowed.empty()
+}
+
+// bypass reports whether the request must be sent directly.
+func (p *Packer) bypass(method string, params ...api.Params) bool {
+	if len(p.ruleFuncs) > 0 {
+		merged := mergeParams(params...)
+		for _, fn := range p.ruleFuncs {
+			switch fn(method, merged) {
+			case Pack:
+				return false
+			case Bypass:
+				return true
+			}
+		}
+	}
+
+	rules := p.activeRules.Load().(ruleSet)
+	return rules.bypass(method, p.defaultBypass)
+}
+
+// publishRules makes p.rules visible to bypass, which reads them without
+// locking. Published rules are never changed, writers replace them
+// with changed copies. It is called under rulesMtx.
+func (p *Packer) publishRules() {
+	p.activeRules.Store(p.rules)
+}
+
+// defaultBypassMethods are methods which do not work inside execute:
+// stored procedures, streaming and secure API, upload servers
+// which are followed by multipart uploads, methods with quirky responses
+// and long poll setup calls made outside of event handlers.
+var defaultBypassMethods = func() methodSet {
+	s := newMethodSet()
+	for _, m := range []string{
+		"execute.*",
+		"streaming.*",
+		"secure.*",
+		"auth.*",
+		"*.get*UploadServer",
+		"account.getPushSettings",
+		"*.getLongPollServer",
+		"groups.setLongPollSettings",
+	} {
+		s.add(m)
+	}
+	return s
+}()
+
+// NoDefaultBypass disables the default list of methods which are never packed
+// (execute.*, streaming.*, secure.*, auth.*, upload servers, account.getPushSettings
+// and long poll setup).
+func NoDefaultBypass() Option {
+	return func(p *Packer) {
+		p.defaultBypass = false
+	}
+}
+
+// SetRules replaces all batching rules of the running packer
+// with the rules of the mode.
+func (p *Packer) SetRules(mode FilterMode, methods ...string) {
+	rules := newRuleSet()
+	set := rules.list(mode)
+	for _, m := range methods {
+		set.add(m)
+	}
+
+	p.rulesMtx.Lock()
+	p.rules = rules
+	p.profile = ""
+	p.publishRules()
+	p.rulesMtx.Unlock()
+}
+
+// AddAllowedMethod makes the running packer pack the method.
+// If the method is still not packed after its Ignore rule is removed,
+// an Allow rule is added, so methods without rules are no longer packed.
+func (p *Packer) AddAllowedMethod(method string) {
+	p.setAllowed(method, true)
+}
+
+// RemoveAllowedMethod makes the running packer send the method directly.
+func (p *Packer) RemoveAllowedMethod(method string) {
+	p.setAllowed(method, false)
+}
+
+func (p *Packer) setAllowed(method string, allowed bool) {
+	p.rulesMtx.Lock()
+	defer p.rulesMtx.Unlock()
+	rules := p.rules.clone()
+	if allowed {
+		rules.ignored.remove(method)
+	} else {
+		rules.allowed.remove(method)
+	}
+	// add the rule only if removing the opposite one was not enough
+	if rules.bypass(method, p.defaultBypass) == allowed {
+		rules.list(FilterMode(allowed)).add(method)
+	}
+	p.rules = rules
+	p.publishRules()
+}
+
+// methodSet matches method names exactly, by wildcard pattern
+// like "messages.*" or by regular expression.
+type methodSet struct {
+	exact    map[string]struct{}
+	patterns []string
+	regexps  []*regexp.Regexp
+}
+
+func newMethodSet() methodSet {
+	return methodSet{exact: make(map[string]struct{})}
+}
+
+func (s methodSet) clone() methodSet {
+	c := methodSet{
+		exact:    make(map[string]struct{}, len(s.exact)),
+		patterns: append([]string(nil), s.patterns...),
+		regexps:  append([]*regexp.Regexp(nil), s.regexps...),
+	}
+	for method := range s.exact {
+		c.exact[method] = struct{}{}
+	}
+	return c
+}
+
+func (s *methodSet) add(method string) {
+	if strings.ContainsAny(method, "*?[") {
+		s.patterns = append(s.patterns, method)
+		return
+	}
+	s.exact[method] = struct{}{}
+}
+
+func (s *methodSet) remove(method string) {
+	delete(s.exact, method)
+	for i, pattern := range s.patterns {
+		if pattern == method {
+			s.patterns = append(s.patterns[:i:i], s.patterns[i+1:]...)
+			return
+		}
+	}
+}
+
+// match reports whether the method is in the set and whether
+// it is matched by the exact name.
+func (s *methodSet) match(method string) (matched, exact bool) {
+	if _, ok := s.exact[method]; ok {
+		return true, true
+	}
+	for _, pattern := range s.patterns {
+		if ok, _ := path.Match(pattern, method); ok {
+			return true, false
+		}
+	}
+	for _, re := range s.regexps {
+		if re.MatchString(method) {
+			return true, false
+		}
+	}
+	return false, false
+}
+
+func (s *methodSet) empty() bool {
+	return len(s.exact) == 0 && len(s.patterns) == 0 && len(s.regexps) == 0
+}
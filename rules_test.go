@@ -0,0 +1,100 @@
+package packer
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func nopHandler(string, ...api.Params) (api.Response, error) {
+	return api.Response{}, nil
+}
+
+func TestMethodSet(t *testing.T) {
+	s := newMethodSet()
+	s.add("messages.*")
+	s.add("users.get")
+	s.regexps = append(s.regexps, regexp.MustCompile(`^ads\.`))
+
+	match := func(method string) bool {
+		matched, _ := s.match(method)
+		return matched
+	}
+	assert.True(t, match("messages.send"))
+	assert.True(t, match("users.get"))
+	assert.True(t, match("ads.getAccounts"))
+	assert.False(t, match("users.search"))
+	assert.False(t, match("messagesX"))
+
+	_, exact := s.match("users.get")
+	assert.True(t, exact)
+	_, exact = s.match("messages.send")
+	assert.False(t, exact)
+}
+
+func TestRulePrecedence(t *testing.T) {
+	p := MustNew(nopHandler,
+		Rules(Allow, "messages.*", "users.get"),
+		Rules(Ignore, "messages.send", "users.*"),
+	)
+	assert.True(t, p.bypass("messages.send"))
+	assert.False(t, p.bypass("messages.edit"))
+	assert.False(t, p.bypass("users.get"))
+	assert.True(t, p.bypass("users.search"))
+	assert.True(t, p.bypass("photos.get"))
+
+	p = MustNew(nopHandler, Rules(Ignore, "messages.*"))
+	p.AddAllowedMethod("messages.edit")
+	assert.False(t, p.bypass("messages.edit"))
+	assert.True(t, p.bypass("messages.send"))
+	assert.True(t, p.bypass("photos.get"))
+
+	p = MustNew(nopHandler, Rules(Ignore, "users.get"))
+	p.AddAllowedMethod("users.get")
+	assert.False(t, p.bypass("users.get"))
+	assert.False(t, p.bypass("photos.get"))
+
+	p.RemoveAllowedMethod("photos.get")
+	assert.True(t, p.bypass("photos.get"))
+	assert.False(t, p.bypass("wall.get"))
+}
+
+func TestDefaultBypass(t *testing.T) {
+	p := MustNew(nopHandler)
+	assert.True(t, p.bypass("photos.getMessagesUploadServer"))
+	assert.True(t, p.bypass("execute.myProcedure"))
+	assert.False(t, p.bypass("photos.get"))
+
+	p = MustNew(nopHandler, Rules(Allow, "photos.getMessagesUploadServer"))
+	assert.False(t, p.bypass("photos.getMessagesUploadServer"))
+
+	p = MustNew(nopHandler, NoDefaultBypass())
+	assert.False(t, p.bypass("streaming.getSettings"))
+}
+
+func TestUseProfile(t *testing.T) {
+	p := MustNew(nopHandler,
+		RuleProfile("degraded", Profile{Allow: []string{"messages.send"}}),
+		RuleProfile("bulk-export", Profile{Ignore: []string{"messages.*"}}),
+	)
+	assert.False(t, p.bypass("users.get"))
+	assert.Equal(t, "", p.ActiveProfile())
+
+	assert.NoError(t, p.UseProfile("degraded"))
+	assert.Equal(t, "degraded", p.ActiveProfile())
+	assert.True(t, p.bypass("users.get"))
+	assert.False(t, p.bypass("messages.send"))
+
+	p.RemoveAllowedMethod("messages.send")
+	assert.NoError(t, p.UseProfile("bulk-export"))
+	assert.True(t, p.bypass("messages.send"))
+	assert.False(t, p.bypass("users.get"))
+
+	assert.NoError(t, p.UseProfile("degraded"))
+	assert.False(t, p.bypass("messages.send"))
+
+	assert.Error(t, p.UseProfile("unknown"))
+	assert.Equal(t, "degraded", p.ActiveProfile())
+}
@@ -0,0 +1,98 @@
+package packer
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+// Result is the result of the request which was made asynchronously.
+type Result struct {
+	Response api.Response
+	Err      error
+}
+
+// EnqueueAt schedules the request to be passed to Handler at t,
+// so it is packed together with regular requests when due.
+// The result is sent to the returned channel.
+func (p *Packer) EnqueueAt(t time.Time, method string, params ...api.Params) <-chan Result {
+	result := make(chan Result, 1)
+	p.scheduler.add(&scheduled{at: t, run: func() {
+		resp, err := p.Handler(method, params...)
+		result <- Result{resp, err}
+	}})
+	return result
+}
+
+// EnqueueAfter schedules the request to be passed to Handler after d.
+func (p *Packer) EnqueueAfter(d time.Duration, method string, params ...api.Params) <-chan Result {
+	return p.EnqueueAt(time.Now().Add(d), method, params...)
+}
+
+type scheduled struct {
+	at  time.Time
+	run func()
+}
+
+// scheduleHeap orders scheduled requests by time.
+type scheduleHeap []*scheduled
+
+func (h scheduleHeap) Len() int            { return len(h) }
+func (h scheduleHeap) Less(i, j int) bool  { return h[i].at.Before(h[j].at) }
+func (h scheduleHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *scheduleHeap) Push(x interface{}) { *h = append(*h, x.(*scheduled)) }
+func (h *scheduleHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// scheduler runs scheduled requests using a single timer
+// which is set to the earliest one.
+type scheduler struct {
+	queue scheduleHeap
+	timer *time.Timer
+	mtx   sync.Mutex
+}
+
+func (s *scheduler) add(entry *scheduled) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	heap.Push(&s.queue, entry)
+	if s.queue[0] == entry {
+		s.reset()
+	}
+}
+
+// reset sets the timer to the earliest request, must be called with s.mtx held.
+func (s *scheduler) reset() {
+	if len(s.queue) == 0 {
+		return
+	}
+
+	d := time.Until(s.queue[0].at)
+	if s.timer == nil {
+		s.timer = time.AfterFunc(d, s.fire)
+	} else {
+		s.timer.Reset(d)
+	}
+}
+
+func (s *scheduler) fire() {
+	s.mtx.Lock()
+	var due []*scheduled
+	now := time.Now()
+	for len(s.queue) > 0 && !s.queue[0].at.After(now) {
+		due = append(due, heap.Pop(&s.queue).(*scheduled))
+	}
+	s.reset()
+	s.mtx.Unlock()
+
+	for _, entry := range due {
+		go entry.run()
+	}
+}
@@ -0,0 +1,48 @@
+package packer
+
+import (
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/SevereCloud/vksdk/v2/object"
+)
+
+// searchLimits are page sizes and the maximum number
+// of results returned by search methods.
+var searchLimits = map[string]struct{ count, depth int }{
+	"newsfeed.search": {count: 200, depth: 1000},
+	"wall.search":     {count: 100},
+}
+
+// SearchPosts returns the iterator over posts found by newsfeed.search
+// or wall.search (see Iterate). Pages are requested until the depth
+// limit of the method, posts returned by several pages are yielded once.
+func (p *Packer) SearchPosts(method string, params api.Params) func(yield func(object.WallWallpost, error) bool) {
+	limits := searchLimits[method]
+	pageParams := make(api.Params, len(params)+1)
+	if limits.count > 0 {
+		pageParams["count"] = limits.count
+	}
+	for name, value := range params {
+		pageParams[name] = value
+	}
+
+	return func(yield func(object.WallWallpost, error) bool) {
+		seen := make(map[[2]int]struct{})
+		n := 0
+		Iterate[object.WallWallpost](p, method, pageParams, "items")(func(post object.WallWallpost, err error) bool {
+			if err != nil {
+				return yield(post, err)
+			}
+			if limits.depth > 0 && n >= limits.depth {
+				return false
+			}
+			n++
+
+			key := [2]int{post.OwnerID, post.ID}
+			if _, ok := seen[key]; ok {
+				return true
+			}
+			seen[key] = struct{}{}
+			return yield(post, nil)
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package packer
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+// ErrShutdown is returned for requests which were not sent
+// because the packer is closed.
+var ErrShutdown = errors.New("packer: shutdown")
+
+// DrainPolicy defines what happens to pending requests on Close.
+type DrainPolicy int
+
+const (
+	// DrainFlush sends pending requests and waits for their responses.
+	DrainFlush DrainPolicy = iota
+	// DrainFail fails pending requests with ErrShutdown.
+	DrainFail
+	// DrainPersist fails pending requests with ErrShutdown but keeps them
+	// in the queue (see PersistentQueue), so they are sent by Replay after restart.
+	DrainPersist
+)
+
+// Shutdown sets the drain policy used by Close (DrainFlush by default).
+// Requests which are still waiting for the response after the deadline
+// are failed with ErrShutdown. Zero deadline means waiting without limit.
+func Shutdown(policy DrainPolicy, deadline time.Duration) Option {
+	return func(p *Packer) {
+		p.drainPolicy = policy
+		p.drainDeadline = deadline
+	}
+}
+
+// Close stops accepting requests and drains pending ones according
+// to the drain policy. Requests made after Close fail with ErrShutdown.
+func (p *Packer) Close() error {
+	var (
+		batches map[batchKey]*pendingBatch
+		limits  map[batchKey]batchLimits
+	)
+	p.do(func() {
+		if !atomic.CompareAndSwapInt32(&p.closed, 0, 1) {
+			return
+		}
+		close(p.stop)
+		batches = p.batches
+		limits = make(map[batchKey]batchLimits, len(batches))
+		for key := range batches {
+			limits[key] = p.limits(key)
+		}
+		p.batches = make(map[batchKey]*pendingBatch)
+		p.pendingCount = 0
+	})
+	if batches == nil {
+		return nil
+	}
+
+	var err error
+	if p.drainPolicy == DrainPersist && p.queue == nil {
+		err = errors.New("packer: DrainPersist requires PersistentQueue")
+	}
+
+	var snapshot []snapshotBatch
+	for key, pending := range batches {
+		for pending.len() > 0 {
+			bat := pending.take(limits[key])
+			switch {
+			case p.snapshotPath != "":
+				bat = p.unspill(bat)
+				bat.finalize()
+				snapshot = append(snapshot, snapshotBatch{key, p.batchInfo(pending, FlushClose), bat})
+			case p.drainPolicy == DrainFlush:
+				p.dispatchBatch(key, p.batchInfo(pending, FlushClose), bat)
+			default:
+				p.unexpired(p.unspill(bat)).fail(ErrShutdown)
+			}
+		}
+	}
+	if len(snapshot) > 0 {
+		if snapErr := p.saveSnapshot(snapshot); snapErr != nil {
+			err = snapErr
+			for _, sb := range snapshot {
+				p.dispatchBatch(sb.key, sb.info, sb.bat)
+			}
+		} else {
+			for _, sb := range snapshot {
+				p.unexpired(sb.bat).fail(ErrShutdown)
+			}
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.inflight.Wait()
+		close(done)
+	}()
+
+	var timeout <-chan time.Time
+	if p.drainDeadline > 0 {
+		timer := time.NewTimer(p.drainDeadline)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-done:
+	case <-timeout:
+		p.failOutstanding()
+		if err == nil {
+			err = fmt.Errorf("%w: deadline exceeded", ErrShutdown)
+		}
+	}
+	return err
+}
+
+func (p *Packer) isClosed() bool {
+	return atomic.LoadInt32(&p.closed) == 1
+}
+
+// dispatchBatch sends the batch in background, Close waits for it.
+func (p *Packer) dispatchBatch(key batchKey, info BatchInfo, bat batch) {
+	p.inflight.Add(1)
+	go func() {
+		defer p.inflight.Done()
+		p.sendBatch(key, info, bat)
+	}()
+}
+
+// fail completes all requests of the batch with err.
+func (b batch) fail(err error) {
+	b.finalize()
+	for _, request := range b {
+		request.callback(api.Response{}, err)
+	}
+}
+
+// outstanding is the request which can be completed
+// either by its batch or by Close deadline.
+type outstanding struct {
+	once     sync.Once
+	callback func(api.Response, error)
+}
+
+// hold registers the callback so Close can fail it after the deadline.
+// The returned callback is called at most once.
+func (p *Packer) hold(callback func(api.Response, error)) func(api.Response, error) {
+	if p.drainDeadline <= 0 {
+		return callback
+	}
+
+	o := &outstanding{callback: callback}
+	p.outMtx.Lock()
+	p.outstanding[o] = struct{}{}
+	p.outMtx.Unlock()
+
+	return func(resp api.Response, err error) {
+		p.outMtx.Lock()
+		delete(p.outstanding, o)
+		p.outMtx.Unlock()
+		o.once.Do(func() { o.callback(resp, err) })
+	}
+}
+
+func (p *Packer) failOutstanding() {
+	p.outMtx.Lock()
+	list := make([]*outstanding, 0, len(p.outstanding))
+	for o := range p.outstanding {
+		list = append(list, o)
+	}
+	p.outstanding = make(map[*outstanding]struct{})
+	p.outMtx.Unlock()
+
+	for _, o := range list {
+		o.once.Do(func() { o.callback(api.Response{}, ErrShutdown) })
+	}
+}
@@ -0,0 +1,37 @@
+package packer
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// HandleSignals closes the packer when one of the signals
+// (SIGINT and SIGTERM by default) is received: new requests fail
+// with ErrShutdown and pending ones are drained according to Shutdown,
+// which also sets the deadline. The result of Close is sent to the channel,
+// so the application can exit after the packer is drained:
+//
+//	done := packer.HandleSignals(p, syscall.SIGTERM, syscall.SIGINT)
+//	...
+//	if err := <-done; err != nil {
+//		log.Fatal(err)
+//	}
+func HandleSignals(p *Packer, signals ...os.Signal) <-chan error {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, signals...)
+
+	done := make(chan error, 1)
+	go func() {
+		select {
+		case <-sig:
+		case <-p.stop:
+		}
+		signal.Stop(sig)
+		done <- p.Close()
+	}()
+	return done
+}
@@ -0,0 +1,127 @@
+package packer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Sink receives items of bulk fetches, so exports run in constant memory.
+// Implementations must be safe for concurrent use.
+type Sink interface {
+	Write(item interface{}) error
+	// Flush writes buffered items.
+	Flush() error
+}
+
+// WriteTo returns the callback of the bulk fetch which writes each item to the sink:
+//
+//	p.FetchWall(ownerID, packer.WallOptions{OnPost: packer.WriteTo[object.WallWallpost](sink)})
+func WriteTo[T any](s Sink) func(item T) error {
+	return func(item T) error {
+		return s.Write(item)
+	}
+}
+
+// WriteAll works like WriteTo for callbacks which receive pages of items:
+//
+//	p.EnumerateMembers(ctx, groupID, opts, packer.WriteAll[int](sink))
+func WriteAll[T any](s Sink) func(items []T) error {
+	return func(items []T) error {
+		for _, item := range items {
+			if err := s.Write(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+type jsonlSink struct {
+	mtx sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONLSink creates the sink which writes items as JSON lines.
+func NewJSONLSink(w io.Writer) Sink {
+	return &jsonlSink{enc: json.NewEncoder(w)}
+}
+
+func (s *jsonlSink) Write(item interface{}) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.enc.Encode(item)
+}
+
+func (s *jsonlSink) Flush() error {
+	return nil
+}
+
+type csvSink struct {
+	mtx     sync.Mutex
+	w       *csv.Writer
+	columns []string
+	header  bool
+}
+
+// NewCSVSink creates the sink which writes items as CSV rows with the header.
+// Columns are top-level JSON fields of items, nested values are written as JSON.
+// Scalar items like ids are written as a single column.
+func NewCSVSink(w io.Writer, columns ...string) Sink {
+	return &csvSink{w: csv.NewWriter(w), columns: columns}
+}
+
+func (s *csvSink) Write(item interface{}) error {
+	row, err := s.row(item)
+	if err != nil {
+		return err
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if !s.header && len(s.columns) > 0 {
+		s.header = true
+		if err := s.w.Write(s.columns); err != nil {
+			return err
+		}
+	}
+	return s.w.Write(row)
+}
+
+func (s *csvSink) row(item interface{}) ([]string, error) {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return nil, fmt.Errorf("packer: csv: %w", err)
+	}
+
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(data, &fields) != nil || len(s.columns) == 0 {
+		return []string{csvValue(data)}, nil
+	}
+
+	row := make([]string, len(s.columns))
+	for i, column := range s.columns {
+		if raw, ok := fields[column]; ok {
+			row[i] = csvValue(raw)
+		}
+	}
+	return row, nil
+}
+
+// csvValue returns strings unquoted and other values as JSON.
+func csvValue(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	return string(raw)
+}
+
+func (s *csvSink) Flush() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.w.Flush()
+	return s.w.Error()
+}
@@ -0,0 +1,35 @@
+package packer
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSinks(t *testing.T) {
+	type user struct {
+		ID    int      `json:"id"`
+		Name  string   `json:"name"`
+		Langs []string `json:"langs"`
+	}
+	users := []user{{1, "Pavel", []string{"ru"}}, {2, "Nikolai, Jr.", nil}}
+
+	var buf bytes.Buffer
+	sink := NewJSONLSink(&buf)
+	assert.NoError(t, WriteAll[user](sink)(users))
+	assert.NoError(t, sink.Flush())
+	assert.Equal(t, "{\"id\":1,\"name\":\"Pavel\",\"langs\":[\"ru\"]}\n{\"id\":2,\"name\":\"Nikolai, Jr.\",\"langs\":null}\n", buf.String())
+
+	buf.Reset()
+	sink = NewCSVSink(&buf, "id", "name", "langs")
+	assert.NoError(t, WriteAll[user](sink)(users))
+	assert.NoError(t, sink.Flush())
+	assert.Equal(t, "id,name,langs\n1,Pavel,\"[\"\"ru\"\"]\"\n2,\"Nikolai, Jr.\",\n", buf.String())
+
+	buf.Reset()
+	sink = NewCSVSink(&buf)
+	assert.NoError(t, WriteTo[int](sink)(42))
+	assert.NoError(t, sink.Flush())
+	assert.Equal(t, "42\n", buf.String())
+}
@@ -0,0 +1,112 @@
+package packer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+// Snapshot makes Close save requests which are still waiting for their batch
+// to the file at path instead of draining them by the Shutdown policy,
+// their callers fail with ErrShutdown. RestoreSnapshot sends them on the next
+// start, so rolling deploys do not drop requests waiting for the next flush.
+// If the file can not be written, requests are sent as with DrainFlush.
+// Access tokens are not stored, restored requests are sent with tokens
+// of the packer, so with lazy loading (no Tokens option) a token must be
+// loaded before RestoreSnapshot, otherwise they fail.
+func Snapshot(path string) Option {
+	return func(p *Packer) {
+		p.snapshotPath = path
+	}
+}
+
+// snapshotBatch is the batch taken by Close for the snapshot.
+type snapshotBatch struct {
+	key  batchKey
+	info BatchInfo
+	bat  batch
+}
+
+// saveSnapshot appends requests of the batches to the snapshot file.
+func (p *Packer) saveSnapshot(batches []snapshotBatch) error {
+	reqs, err := readSnapshot(p.snapshotPath)
+	if err != nil {
+		return err
+	}
+	for _, sb := range batches {
+		for _, req := range sb.bat {
+			reqs = append(reqs, Request{req.method, p.storedParams(req.params...)})
+		}
+	}
+
+	data, err := json.Marshal(reqs)
+	if err != nil {
+		return fmt.Errorf("packer: snapshot: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p.snapshotPath), filepath.Base(p.snapshotPath)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("packer: snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), p.snapshotPath)
+	}
+	if err != nil {
+		return fmt.Errorf("packer: snapshot: %w", err)
+	}
+	return nil
+}
+
+func readSnapshot(path string) ([]Request, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("packer: snapshot: %w", err)
+	}
+	var reqs []Request
+	if err := json.Unmarshal(data, &reqs); err != nil {
+		return nil, fmt.Errorf("packer: snapshot %s: %w", path, err)
+	}
+	return reqs, nil
+}
+
+// RestoreSnapshot packs requests saved by Close of the previous run
+// and removes the snapshot file, fn is called with the result of each of them.
+// It should be called once on startup.
+func (p *Packer) RestoreSnapshot(fn func(req Request, resp api.Response, err error)) error {
+	if p.snapshotPath == "" {
+		return nil
+	}
+
+	reqs, err := readSnapshot(p.snapshotPath)
+	if err != nil || len(reqs) == 0 {
+		return err
+	}
+	for _, req := range reqs {
+		req := req
+		if err := p.loadToken(req.Params); err != nil {
+			fn(req, api.Response{}, err)
+			continue
+		}
+		p.push(req.Method, []api.Params{req.Params}, func(resp api.Response, err error) {
+			fn(req, resp, err)
+		})
+	}
+	if err := os.Remove(p.snapshotPath); err != nil {
+		return fmt.Errorf("packer: snapshot: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package packer
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+// Spillover makes the packer store params of requests beyond the first limit
+// pending ones in a temporary file in dir (os.TempDir() if empty) and read them
+// back when their batch is sent, so bursts of large requests do not exhaust memory.
+// Callers, callbacks and contexts of spilled requests stay in memory.
+// Requests of methods with mergers (see Coalesce) are never spilled.
+func Spillover(dir string, limit int) Option {
+	return func(p *Packer) {
+		p.spill = &spillFile{dir: dir}
+		p.spillLimit = limit
+	}
+}
+
+// spillRef points to the request stored in the spill file.
+// Internal params like ":context" can not be stored and are kept in memory.
+type spillRef struct {
+	offset   int64
+	length   int
+	internal api.Params
+}
+
+type spillFile struct {
+	dir  string
+	file *os.File
+	size int64
+	live int
+	mtx  sync.Mutex
+}
+
+func (s *spillFile) store(req Request) (*spillRef, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.file == nil {
+		if s.file, err = os.CreateTemp(s.dir, "vk-execute-packer-*.spill"); err != nil {
+			return nil, err
+		}
+		// the file is not needed after restart
+		_ = os.Remove(s.file.Name())
+	}
+
+	if _, err := s.file.WriteAt(data, s.size); err != nil {
+		return nil, err
+	}
+	ref := &spillRef{offset: s.size, length: len(data)}
+	s.size += int64(len(data))
+	s.live++
+	return ref, nil
+}
+
+func (s *spillFile) load(ref *spillRef) (Request, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	data := make([]byte, ref.length)
+	_, err := s.file.ReadAt(data, ref.offset)
+	if truncErr := s.done(); err == nil {
+		err = truncErr
+	}
+	if err != nil {
+		return Request{}, err
+	}
+
+	var req Request
+	err = json.Unmarshal(data, &req)
+	return req, err
+}
+
+// release forgets the request which is not read back, e.g. expired.
+func (s *spillFile) release() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.done()
+}
+
+// done counts the request as read back, the file is reused
+// from the start when all requests are read back.
+func (s *spillFile) done() error {
+	if s.live--; s.live > 0 {
+		return nil
+	}
+	s.size = 0
+	return s.file.Truncate(0)
+}
+
+// spillRequest moves params of the request to the spill file
+// if there are too many pending requests. Runs on the dispatcher.
+func (p *Packer) spillRequest(req request) request {
+	if p.spill == nil || p.pendingCount < p.spillLimit {
+		return req
+	}
+
+	ref, err := p.spill.store(Request{req.method, p.normalize(req.params...)})
+	if err != nil {
+		if p.debug {
+			log.Printf("packer: spill: %v\n", err)
+		}
+		return req
+	}
+	ref.internal = internalParams(req.params)
+	req.params, req.spilled = nil, ref
+	return req
+}
+
+// internalParams returns params like ":context" which are not sent to VK,
+// nil if there are none.
+func internalParams(params []api.Params) api.Params {
+	var internal api.Params
+	iterateAll(func(name string, value interface{}) {
+		if strings.HasPrefix(name, ":") {
+			if internal == nil {
+				internal = api.Params{}
+			}
+			internal[name] = value
+		}
+	}, params...)
+	return internal
+}
+
+// unspill reads params of spilled requests back, requests which cannot be read
+// are failed and expired ones are not read, both are removed from the batch.
+func (p *Packer) unspill(bat batch) batch {
+	if p.spill == nil {
+		return bat
+	}
+
+	loaded := bat[:0]
+	for _, req := range bat {
+		if req.spilled != nil {
+			if req.expiry != nil && atomic.LoadInt32(&req.expiry.state) == expiryExpired {
+				if err := p.spill.release(); err != nil && p.debug {
+					log.Printf("packer: spill: %v\n", err)
+				}
+				continue
+			}
+			stored, err := p.spill.load(req.spilled)
+			if err != nil {
+				req.callback(api.Response{}, fmt.Errorf("packer: spill: %w", err))
+				continue
+			}
+			req.params = []api.Params{stored.Params}
+			if req.spilled.internal != nil {
+				req.params = append(req.params, req.spilled.internal)
+			}
+			req.spilled = nil
+		}
+		loaded = append(loaded, req)
+	}
+	return loaded
+}
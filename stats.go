@@ -0,0 +1,36 @@
+package packer
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// PendingCount returns the number of requests waiting for the batch
+// to be sent, the same as Pending.
+func (p *Packer) PendingCount() int {
+	return p.Pending()
+}
+
+// InFlightBatches returns the number of batches which are being sent.
+func (p *Packer) InFlightBatches() int {
+	return int(atomic.LoadInt32(&p.sending))
+}
+
+// OldestPendingAge returns the time since the oldest pending batch
+// started collecting requests, zero if nothing is pending.
+// Together with PendingCount and InFlightBatches it lets applications
+// adapt to the queue state, e.g. call Send early or shed load.
+func (p *Packer) OldestPendingAge() time.Duration {
+	var oldest time.Time
+	p.do(func() {
+		for _, pending := range p.batches {
+			if pending.len() > 0 && (oldest.IsZero() || pending.created.Before(oldest)) {
+				oldest = pending.created
+			}
+		}
+	})
+	if oldest.IsZero() {
+		return 0
+	}
+	return time.Since(oldest)
+}
@@ -41,6 +41,27 @@ func (tp *tokenPool) Append(token string) {
 	tp.tokens = newChan
 }
 
+// Remove removes the token unless it is the last one.
+func (tp *tokenPool) Remove(token string) bool {
+	tp.mtx.Lock()
+	defer tp.mtx.Unlock()
+	if _, found := tp.tmap[token]; !found || len(tp.tmap) == 1 {
+		return false
+	}
+
+	newChan := make(chan string, len(tp.tokens)-1)
+	close(tp.tokens)
+	for t := range tp.tokens {
+		if t != token {
+			newChan <- t
+		}
+	}
+
+	delete(tp.tmap, token)
+	tp.tokens = newChan
+	return true
+}
+
 func (tp *tokenPool) Get() string {
 	tp.mtx.RLock()
 	defer tp.mtx.RUnlock()
@@ -54,3 +75,13 @@ func (tp *tokenPool) Len() int {
 	defer tp.mtx.RUnlock()
 	return len(tp.tmap)
 }
+
+func (tp *tokenPool) All() []string {
+	tp.mtx.RLock()
+	defer tp.mtx.RUnlock()
+	tokens := make([]string, 0, len(tp.tmap))
+	for t := range tp.tmap {
+		tokens = append(tokens, t)
+	}
+	return tokens
+}
@@ -1,13 +1,20 @@
 package packer
 
-import "github.com/SevereCloud/vksdk/v2/api"
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
 
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+// getTokenFromParams returns access_token, the last one wins
+// like in direct vksdk calls.
 func getTokenFromParams(params ...api.Params) (interface{}, bool) {
-	for _, pmap := range params {
-		for k, v := range pmap {
-			if k == "access_token" {
-				return v, true
-			}
+	for i := len(params) - 1; i >= 0; i-- {
+		if v, ok := params[i]["access_token"]; ok {
+			return v, true
 		}
 	}
 
@@ -21,3 +28,48 @@ func iterateAll(iterFn func(key string, value interface{}), params ...api.Params
 		}
 	}
 }
+
+// mergeParams merges params maps, later maps take precedence
+// like in direct vksdk calls.
+func mergeParams(params ...api.Params) api.Params {
+	merged := make(api.Params)
+	iterateAll(func(key string, value interface{}) {
+		merged[key] = value
+	}, params...)
+	return merged
+}
+
+// requestKey identifies the request by method and encoded params.
+// Tokens and vksdk internal params are ignored since packed requests
+// are sent with tokens of the packer anyway.
+func (p *Packer) requestKey(method string, params ...api.Params) string {
+	merged := mergeParams(params...)
+	names := make([]string, 0, len(merged))
+	for name := range merged {
+		if name == "access_token" || strings.HasPrefix(name, ":") {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	sb.WriteString(method)
+	for _, name := range names {
+		sb.WriteByte('&')
+		sb.WriteString(url.QueryEscape(name))
+		sb.WriteByte('=')
+		sb.WriteString(url.QueryEscape(encodeParam(p.paramEncoders, merged[name])))
+	}
+	return sb.String()
+}
+
+// paramsContext returns the context set by api.Params.WithContext.
+func paramsContext(params ...api.Params) context.Context {
+	for i := len(params) - 1; i >= 0; i-- {
+		if ctx, ok := params[i][":context"].(context.Context); ok {
+			return ctx
+		}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package packer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+// maxExecuteCalls is the maximum number of API calls inside one execute.
+const maxExecuteCalls = 25
+
+// ValidateBatch generates the code of the batch made of reqs without sending it
+// and returns the first error which would fail the batch: bad method names,
+// params which can't be safely encoded (with ParamEncoders of the packer),
+// references to pipeline steps or too many calls for one execute.
+func (p *Packer) ValidateBatch(reqs []Request) error {
+	if len(reqs) > maxExecuteCalls {
+		return fmt.Errorf("packer: batch of %d requests exceeds %d calls per execute", len(reqs), maxExecuteCalls)
+	}
+
+	bat := make(batch, len(reqs))
+	for i, req := range reqs {
+		if err := p.validateCall(req.Method, req.Params); err != nil {
+			return fmt.Errorf("packer: request %d (%s): %w", i, req.Method, err)
+		}
+		for name, value := range req.Params {
+			if _, ok := value.(Ref); ok {
+				return fmt.Errorf("packer: request %d (%s): param %s references a pipeline step", i, req.Method, name)
+			}
+		}
+		bat[i] = request{method: req.Method, params: []api.Params{req.Params}}
+	}
+
+	w := p.codeWriter()
+	defer w.release()
+	_, err := bat.code(w)
+	return err
+}
+
+// validateOptions returns the first error of the packer configured by options.
+func (p *Packer) validateOptions() error {
+	if p.vkHandler == nil {
+		return errors.New("packer: nil handler")
+	}
+	if p.maxPackedRequests < 1 || p.maxPackedRequests > maxExecuteCalls {
+		return fmt.Errorf("packer: max packed requests must be from 1 to %d, got %d", maxExecuteCalls, p.maxPackedRequests)
+	}
+	for class, max := range p.classMax {
+		if max < 1 || max > maxExecuteCalls {
+			return fmt.Errorf("packer: max packed requests of class %d must be from 1 to %d, got %d", class, maxExecuteCalls, max)
+		}
+	}
+	for class, interval := range p.classFlush {
+		if interval < 0 {
+			return fmt.Errorf("packer: negative flush interval of class %d", class)
+		}
+		if p.classify == nil {
+			return errors.New("packer: ClassFlushInterval requires SeparateClasses")
+		}
+	}
+
+	if p.version == "" {
+		return errors.New("packer: empty api version")
+	}
+	if p.execMethod == "" {
+		return errors.New("packer: empty execute method")
+	}
+	if !p.tokenLazyLoading && p.tokenPool.Len() == 0 {
+		return errors.New("packer: no tokens")
+	}
+	for _, token := range p.tokenPool.All() {
+		if token == "" || strings.IndexFunc(token, func(r rune) bool {
+			return unicode.IsSpace(r) || !unicode.IsPrint(r)
+		}) >= 0 {
+			return fmt.Errorf("packer: bad token %s", tokenAlias(token))
+		}
+	}
+
+	for method := range p.rules.allowed.exact {
+		if _, ok := p.rules.ignored.exact[method]; ok {
+			return fmt.Errorf("packer: method %s is both allowed and ignored", method)
+		}
+	}
+	for method, cost := range p.costs {
+		if cost < 0 {
+			return fmt.Errorf("packer: negative cost of %s", method)
+		}
+	}
+	if p.maxCost < 0 {
+		return errors.New("packer: negative max batch cost")
+	}
+	if normal, bulk := p.shares[PriorityNormal.index()], p.shares[PriorityBulk.index()]; normal < 0 || bulk < 0 {
+		return fmt.Errorf("packer: negative priority shares %d:%d", normal, bulk)
+	}
+
+	switch {
+	case p.flushInterval < 0:
+		return fmt.Errorf("packer: negative flush interval %s", p.flushInterval)
+	case p.retries < 0 || p.retryBackoff < 0:
+		return fmt.Errorf("packer: bad retry policy: %d attempts, backoff %s", p.retries, p.retryBackoff)
+	case p.drainDeadline < 0:
+		return fmt.Errorf("packer: negative shutdown deadline %s", p.drainDeadline)
+	case p.replyTimeout < 0:
+		return fmt.Errorf("packer: negative distributed reply timeout %s", p.replyTimeout)
+	case p.tokenLimit < 0 || p.tokenLimit > 0 && p.tokenBurst < 1:
+		return fmt.Errorf("packer: bad token rate limit %v with burst %d", p.tokenLimit, p.tokenBurst)
+	}
+	for method, ttl := range p.ttls {
+		if ttl < 0 {
+			return fmt.Errorf("packer: negative ttl of %s", method)
+		}
+	}
+
+	if p.largePolicy != LargeBypass && p.largePolicy != LargeSolo {
+		return fmt.Errorf("packer: unknown large request policy %d", p.largePolicy)
+	}
+	if p.drainPolicy < DrainFlush || p.drainPolicy > DrainPersist {
+		return fmt.Errorf("packer: unknown drain policy %d", p.drainPolicy)
+	}
+	if p.memory != nil && p.memory.max < 1 {
+		return fmt.Errorf("packer: max pending bytes must be positive, got %d", p.memory.max)
+	}
+	if p.spill != nil && p.spillLimit < 1 {
+		return fmt.Errorf("packer: spillover limit must be positive, got %d", p.spillLimit)
+	}
+	return nil
+}
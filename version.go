@@ -0,0 +1,57 @@
+package packer
+
+import (
+	"fmt"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+)
+
+// InjectVersion adds the "v" param set by Version to requests without it,
+// packed and sent directly, so the handler and hooks see the same version
+// as the one used for the batch. Default and Wrap use vk.Version.
+func InjectVersion() Option {
+	return func(p *Packer) {
+		p.injectVersion = true
+	}
+}
+
+// StrictVersion rejects requests with the "v" param other than
+// the version set by Version instead of packing them into separate batches.
+func StrictVersion() Option {
+	return func(p *Packer) {
+		p.strictVersion = true
+	}
+}
+
+// versionOf returns the version of requests made by vk.
+func versionOf(vk *api.VK) string {
+	if vk.Version == "" {
+		return api.Version
+	}
+	return vk.Version
+}
+
+// withVersion injects or checks the version of the request,
+// params of the caller are not modified.
+func (p *Packer) withVersion(method string, params []api.Params) ([]api.Params, error) {
+	var (
+		version interface{}
+		found   bool
+	)
+	iterateAll(func(name string, value interface{}) {
+		if name == "v" {
+			version, found = value, true
+		}
+	}, params...)
+
+	if !found {
+		if !p.injectVersion {
+			return params, nil
+		}
+		return append(params[:len(params):len(params)], api.Params{"v": p.version}), nil
+	}
+	if v := encodeParam(p.paramEncoders, version); p.strictVersion && v != p.version {
+		return nil, fmt.Errorf("packer: %s: api version %s differs from %s", method, v, p.version)
+	}
+	return params, nil
+}
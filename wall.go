@@ -0,0 +1,91 @@
+package packer
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/SevereCloud/vksdk/v2/api"
+	"github.com/SevereCloud/vksdk/v2/object"
+)
+
+// WallOptions - FetchWall options
+type WallOptions struct {
+	// Offset is the offset of the first post, e.g. the last checkpoint.
+	Offset int
+	// Filter is the wall.get filter param ("owner", "others", ...).
+	Filter string
+	// Pages is the number of pages of 100 posts fetched by one execute
+	// (MaxPages by default).
+	Pages int
+	// OnPost is called for each post in order,
+	// returned error stops fetching.
+	OnPost func(post object.WallWallpost) error
+	// Checkpoint is called with the offset of the next post
+	// after all posts before it were passed to OnPost.
+	Checkpoint func(offset int)
+	// Checkpointer saves the offset of the next post, FetchWall starts
+	// from the saved offset instead of Offset if there is one.
+	Checkpointer Checkpointer
+}
+
+// FetchWall downloads all posts of the wall starting from opts.Offset
+// using execute-side loops (see FetchPages) and streams them to opts.OnPost.
+// It returns the offset of the next post which was not fetched.
+func (p *Packer) FetchWall(ownerID int, opts WallOptions) (int, error) {
+	params := api.Params{"owner_id": ownerID, "count": 100}
+	if opts.Filter != "" {
+		params["filter"] = opts.Filter
+	}
+
+	cp, err := loadCheckpoint(opts.Checkpointer)
+	if err != nil {
+		return opts.Offset, err
+	}
+	checkpoint := func(offset int) error {
+		if opts.Checkpoint != nil {
+			opts.Checkpoint(offset)
+		}
+		return cp.saveOffset(offset)
+	}
+
+	return p.fetchAll("wall.get", params, cp.offset(opts.Offset), opts.Pages, checkpoint, func(raw json.RawMessage) error {
+		var post object.WallWallpost
+		if err := p.decoder.Unmarshal(raw, &post); err != nil {
+			return fmt.Errorf("packer: wall: %w", err)
+		}
+		if opts.OnPost != nil {
+			return opts.OnPost(post)
+		}
+		return nil
+	})
+}
+
+// fetchAll fetches all items of the method starting from offset
+// by pages execute loops and passes them to fn.
+// checkpoint is called with the offset of the next item after each execute.
+func (p *Packer) fetchAll(method string, params api.Params, offset, pages int,
+	checkpoint func(offset int) error, fn func(item json.RawMessage) error) (int, error) {
+	for {
+		params["offset"] = offset
+		page, err := p.FetchPages(method, params, pages)
+		if err != nil {
+			return offset, err
+		}
+
+		for _, raw := range page.Items {
+			if err := fn(raw); err != nil {
+				return offset, err
+			}
+			offset++
+		}
+		if checkpoint != nil {
+			if err := checkpoint(offset); err != nil {
+				return offset, err
+			}
+		}
+
+		if len(page.Items) == 0 || page.Done() {
+			return offset, nil
+		}
+	}
+}
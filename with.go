@@ -0,0 +1,41 @@
+package packer
+
+// With creates a sibling packer with options of p followed by opts,
+// e.g. with another batch size or rules for bulk jobs next to interactive
+// requests. The sibling shares the handler and the token pool of p
+// (tokens added or evicted in one of them are seen by the other one)
+// unless opts contain Tokens. Settings changed at runtime (ApplyConfig,
+// SetMaxPackedRequests, UseProfile) are not copied. Options which own
+// storage (Snapshot, Spillover, PersistentQueue, WriteAheadLog and
+// Distributed) are not inherited, since two packers must not write
+// the same files or queues; pass them in opts to give the sibling its own.
+// Both packers must be closed.
+//
+//	bulk, err := p.With(packer.MaxPackedRequests(25), packer.FlushInterval(5*time.Second))
+func (p *Packer) With(opts ...Option) (*Packer, error) {
+	all := make([]Option, 0, len(p.options)+len(opts)+1)
+	all = append(all, p.options...)
+	all = append(all, shareTokens(p), dropStorage())
+	all = append(all, opts...)
+	return New(p.baseHandler, all...)
+}
+
+// shareTokens makes the packer use the token pool of parent.
+func shareTokens(parent *Packer) Option {
+	return func(p *Packer) {
+		p.tokenPool = parent.tokenPool
+		p.tokenLazyLoading = parent.tokenLazyLoading
+	}
+}
+
+// dropStorage clears options inherited by With which own storage.
+func dropStorage() Option {
+	return func(p *Packer) {
+		p.snapshotPath = ""
+		p.spill = nil
+		p.spillLimit = 0
+		p.queue = nil
+		p.journal = nil
+		p.redis = nil
+	}
+}